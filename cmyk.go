@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+)
+
+// convertirCMYK pasa img a CMYK con color.RGBToCMYK. Es la conversión
+// ingenua, sin perfil ICC: el negro sale solo en K y los azules y verdes
+// saturados pueden imprimirse corridos, así que conviene una prueba de color
+// en la imprenta. La transparencia se ignora; el talonario ya es opaco.
+func convertirCMYK(img *image.RGBA) *image.CMYK {
+	dst := image.NewCMYK(img.Bounds())
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		origen := img.Pix[img.PixOffset(img.Rect.Min.X, y):]
+		destino := dst.Pix[dst.PixOffset(dst.Rect.Min.X, y):]
+		for i := 0; i < img.Rect.Dx()*4; i += 4 {
+			c, m, amarillo, k := color.RGBToCMYK(origen[i], origen[i+1], origen[i+2])
+			destino[i], destino[i+1], destino[i+2], destino[i+3] = c, m, amarillo, k
+		}
+	}
+	return dst
+}
+
+// Etiquetas TIFF del IFD que escribe escribirTIFFCMYK, en orden creciente
+// como exige el formato.
+const (
+	tiffAncho            = 256
+	tiffAlto             = 257
+	tiffBitsPorMuestra   = 258
+	tiffCompresion       = 259
+	tiffFotometrica      = 262
+	tiffDesplazamientos  = 273
+	tiffMuestras         = 277
+	tiffFilasPorBanda    = 278
+	tiffBytesPorBanda    = 279
+	tiffResolucionX      = 282
+	tiffResolucionY      = 283
+	tiffPlanar           = 284
+	tiffUnidadResolucion = 296
+	tiffTintas           = 332
+)
+
+// escribirTIFFCMYK escribe img como TIFF de una sola banda, con
+// PhotometricInterpretation Separated e InkSet CMYK, que golang.org/x/image/tiff
+// no sabe codificar. Con deflate la banda se comprime con zlib (Compression 8).
+func escribirTIFFCMYK(w io.Writer, img *image.CMYK, dpi int, deflate bool) error {
+	ancho, alto := img.Rect.Dx(), img.Rect.Dy()
+
+	var datos bytes.Buffer
+	var banda io.Writer = &datos
+	var zw *zlib.Writer
+	if deflate {
+		zw = zlib.NewWriter(&datos)
+		banda = zw
+	}
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		i := img.PixOffset(img.Rect.Min.X, y)
+		banda.Write(img.Pix[i : i+ancho*4])
+	}
+	compresion := uint32(1)
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		compresion = 8
+	}
+
+	// Cabecera, IFD y, detrás, los valores que no caben en una entrada:
+	// BitsPerSample, las dos resoluciones y la banda.
+	const entradas = 14
+	finIFD := uint32(8 + 2 + entradas*12 + 4)
+	bits, resX, resY := finIFD, finIFD+8, finIFD+16
+	inicioBanda := finIFD + 24
+
+	le := binary.LittleEndian
+	b := []byte("II")
+	b = le.AppendUint16(b, 42)
+	b = le.AppendUint32(b, 8)
+	b = le.AppendUint16(b, entradas)
+	entrada := func(etiqueta, tipo uint16, cantidad, valor uint32) {
+		b = le.AppendUint16(b, etiqueta)
+		b = le.AppendUint16(b, tipo)
+		b = le.AppendUint32(b, cantidad)
+		if tipo == 3 && cantidad == 1 {
+			// Un SHORT va alineado a la izquierda del campo de 4 bytes
+			b = le.AppendUint16(b, uint16(valor))
+			b = le.AppendUint16(b, 0)
+			return
+		}
+		b = le.AppendUint32(b, valor)
+	}
+	const corto, largo, racional = 3, 4, 5
+	entrada(tiffAncho, largo, 1, uint32(ancho))
+	entrada(tiffAlto, largo, 1, uint32(alto))
+	entrada(tiffBitsPorMuestra, corto, 4, bits)
+	entrada(tiffCompresion, corto, 1, compresion)
+	entrada(tiffFotometrica, corto, 1, 5)
+	entrada(tiffDesplazamientos, largo, 1, inicioBanda)
+	entrada(tiffMuestras, corto, 1, 4)
+	entrada(tiffFilasPorBanda, largo, 1, uint32(alto))
+	entrada(tiffBytesPorBanda, largo, 1, uint32(datos.Len()))
+	entrada(tiffResolucionX, racional, 1, resX)
+	entrada(tiffResolucionY, racional, 1, resY)
+	entrada(tiffPlanar, corto, 1, 1)
+	entrada(tiffUnidadResolucion, corto, 1, 2)
+	entrada(tiffTintas, corto, 1, 1)
+	b = le.AppendUint32(b, 0)
+
+	for range 4 {
+		b = le.AppendUint16(b, 8)
+	}
+	for range 2 {
+		b = le.AppendUint32(b, uint32(dpi))
+		b = le.AppendUint32(b, 1)
+	}
+
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	_, err := w.Write(datos.Bytes())
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+func TestConvertirCMYK(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{0, 0, 0, 255})
+
+	cmyk := convertirCMYK(img)
+	if got, want := cmyk.CMYKAt(0, 0), (color.CMYK{0, 255, 255, 0}); got != want {
+		t.Errorf("rojo = %v, se esperaba %v", got, want)
+	}
+	if got, want := cmyk.CMYKAt(1, 0), (color.CMYK{0, 0, 0, 255}); got != want {
+		t.Errorf("negro = %v, se esperaba %v", got, want)
+	}
+}
+
+func TestEscribirTIFFCMYK(t *testing.T) {
+	img := image.NewCMYK(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+
+	for _, deflate := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := escribirTIFFCMYK(&buf, img, 300, deflate); err != nil {
+			t.Fatal(err)
+		}
+		datos := buf.Bytes()
+		if !bytes.HasPrefix(datos, []byte("II*\x00")) {
+			t.Fatalf("cabecera = %q", datos[:4])
+		}
+
+		le := binary.LittleEndian
+		ifd := le.Uint32(datos[4:])
+		entradas := map[uint16]uint32{}
+		for i := range int(le.Uint16(datos[ifd:])) {
+			e := datos[ifd+2+uint32(i)*12:]
+			valor := le.Uint32(e[8:])
+			if le.Uint16(e[2:]) == 3 && le.Uint32(e[4:]) == 1 {
+				valor = uint32(le.Uint16(e[8:]))
+			}
+			entradas[le.Uint16(e)] = valor
+		}
+		if entradas[tiffFotometrica] != 5 || entradas[tiffMuestras] != 4 || entradas[tiffTintas] != 1 {
+			t.Errorf("deflate=%v: etiquetas de color inesperadas: %v", deflate, entradas)
+		}
+		if entradas[tiffAncho] != 3 || entradas[tiffAlto] != 2 {
+			t.Errorf("deflate=%v: tamaño = %dx%d", deflate, entradas[tiffAncho], entradas[tiffAlto])
+		}
+		if le.Uint32(datos[entradas[tiffResolucionX]:]) != 300 {
+			t.Errorf("deflate=%v: se esperaban 300 ppp", deflate)
+		}
+
+		inicio := entradas[tiffDesplazamientos]
+		banda := datos[inicio : inicio+entradas[tiffBytesPorBanda]]
+		if deflate {
+			if entradas[tiffCompresion] != 8 {
+				t.Errorf("compresión = %d, se esperaba 8", entradas[tiffCompresion])
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(banda))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if banda, err = io.ReadAll(zr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(banda, img.Pix) {
+			t.Errorf("deflate=%v: la banda no coincide con los píxeles", deflate)
+		}
+	}
+}
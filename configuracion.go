@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// camposRequeridos deben aparecer en todo archivo de configuración; las
+// dimensiones pueden omitirse si se indica TamanoPagina.
+var camposRequeridos = []string{
+	"NumeroMaximo",
+	"BoletasPorPagina",
+	"CantidadPaginas",
+	"BoletasPorFila",
+	"AnchoTalonario",
+	"AltoTalonario",
+	"CarpetaSalida",
+}
+
+// CargarConfig lee una configuración desde un archivo JSON (.json) o YAML
+// (.yaml, .yml). Las claves son los nombres de los campos de Config (sin
+// distinguir mayúsculas) y los colores se escriben en hexadecimal, "#RRGGBB"
+// o "#RRGGBBAA". La configuración resultante pasa por ValidarConfig.
+func CargarConfig(ruta string) (Config, error) {
+	valores, err := leerValores(ruta)
+	if err != nil {
+		return Config{}, err
+	}
+
+	config, err := decodificarConfig(valores, camposRequeridos)
+	if err != nil {
+		return Config{}, fmt.Errorf("error en %s: %v", ruta, err)
+	}
+	return config, nil
+}
+
+// leerValores lee un archivo JSON (.json) o YAML (.yaml, .yml) como valores
+// genéricos, con las claves de YAML convertidas a texto.
+func leerValores(ruta string) (map[string]any, error) {
+	datos, err := os.ReadFile(ruta)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo archivo de configuración: %v", err)
+	}
+
+	var valores map[string]any
+	switch ext := strings.ToLower(filepath.Ext(ruta)); ext {
+	case ".json":
+		err = decodificarJSON(datos, &valores)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(datos, &valores)
+		if err == nil {
+			valores = claveTexto(valores).(map[string]any)
+		}
+	default:
+		return nil, fmt.Errorf("formato de configuración no soportado: %q (use .json, .yaml o .yml)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error interpretando %s: %v", ruta, err)
+	}
+	return valores, nil
+}
+
+// decodificarConfig convierte los valores genéricos de un archivo en Config,
+// exigiendo los campos de requeridos, y la valida.
+func decodificarConfig(valores map[string]any, requeridos []string) (Config, error) {
+	config, err := convertirConfig(valores, requeridos)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := ValidarConfig(config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// convertirConfig hace la conversión de decodificarConfig sin validar, para
+// quien deba revisar límites propios antes de que ValidarConfig recorra el
+// rango de números.
+func convertirConfig(valores map[string]any, requeridos []string) (Config, error) {
+	if valores == nil {
+		return Config{}, errors.New("la configuración está vacía")
+	}
+
+	_, conPreset := buscarClave(valores, "TamanoPagina")
+	for _, campo := range requeridos {
+		if conPreset && (campo == "AnchoTalonario" || campo == "AltoTalonario") {
+			continue
+		}
+		if _, ok := buscarClave(valores, campo); !ok {
+			return Config{}, fmt.Errorf("falta el campo requerido %q", campo)
+		}
+	}
+
+	if err := normalizarColores(valores, reflect.TypeOf(Config{})); err != nil {
+		return Config{}, err
+	}
+
+	normalizado, err := json.Marshal(valores)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+	dec := json.NewDecoder(bytes.NewReader(normalizado))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// claveTexto convierte los mapas con claves no textuales que produce YAML
+// (p. ej. las de MapaEtiquetas) en mapas con claves de texto, como en JSON.
+func claveTexto(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, sub := range t {
+			t[k] = claveTexto(sub)
+		}
+		return t
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, sub := range t {
+			m[fmt.Sprint(k)] = claveTexto(sub)
+		}
+		return m
+	case []any:
+		for i, sub := range t {
+			t[i] = claveTexto(sub)
+		}
+		return t
+	}
+	return v
+}
+
+// decodificarJSON conserva los números como json.Number para no perder
+// precisión en enteros grandes como la semilla.
+func decodificarJSON(datos []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(datos))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func buscarClave(valores map[string]any, nombre string) (string, bool) {
+	for clave := range valores {
+		if strings.EqualFold(clave, nombre) {
+			return clave, true
+		}
+	}
+	return "", false
+}
+
+// normalizarColores reemplaza los colores hexadecimales por la forma que
+// entiende encoding/json para color.RGBA, también dentro de listas de structs.
+func normalizarColores(valores map[string]any, t reflect.Type) error {
+	tipoColor := reflect.TypeOf(color.RGBA{})
+
+	for i := range t.NumField() {
+		campo := t.Field(i)
+		clave, ok := buscarClave(valores, campo.Name)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case campo.Type == tipoColor:
+			texto, ok := valores[clave].(string)
+			if !ok {
+				continue
+			}
+			c, err := parsearColorHex(texto)
+			if err != nil {
+				return fmt.Errorf("campo %s: %v", campo.Name, err)
+			}
+			valores[clave] = map[string]uint8{"R": c.R, "G": c.G, "B": c.B, "A": c.A}
+
+		case campo.Type.Kind() == reflect.Slice && campo.Type.Elem() == tipoColor:
+			lista, ok := valores[clave].([]any)
+			if !ok {
+				continue
+			}
+			for j, elem := range lista {
+				texto, ok := elem.(string)
+				if !ok {
+					continue
+				}
+				c, err := parsearColorHex(texto)
+				if err != nil {
+					return fmt.Errorf("%s[%d]: %v", campo.Name, j, err)
+				}
+				lista[j] = map[string]uint8{"R": c.R, "G": c.G, "B": c.B, "A": c.A}
+			}
+
+		case campo.Type.Kind() == reflect.Slice && campo.Type.Elem().Kind() == reflect.Struct:
+			lista, ok := valores[clave].([]any)
+			if !ok {
+				continue
+			}
+			for j, elem := range lista {
+				sub, ok := elem.(map[string]any)
+				if !ok {
+					continue
+				}
+				if err := normalizarColores(sub, campo.Type.Elem()); err != nil {
+					return fmt.Errorf("%s[%d]: %v", campo.Name, j, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// parsearColorHex interpreta "#RRGGBB" o "#RRGGBBAA"; sin alfa se asume opaco.
+func parsearColorHex(texto string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(texto), "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.RGBA{}, fmt.Errorf("color inválido %q: se espera #RRGGBB o #RRGGBBAA", texto)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("color inválido %q: %v", texto, err)
+	}
+
+	return color.RGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// formatearColorHex es la inversa de parsearColorHex.
+func formatearColorHex(c color.RGBA) string {
+	if c.A == 0xff {
+		return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02X%02X%02X%02X", c.R, c.G, c.B, c.A)
+}
+
+// configAMapa serializa la configuración con el mismo formato que acepta
+// CargarConfig, con los colores en hexadecimal.
+func configAMapa(config Config) (map[string]any, error) {
+	datos, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var valores map[string]any
+	if err := decodificarJSON(datos, &valores); err != nil {
+		return nil, err
+	}
+
+	colorizarHex(valores, reflect.ValueOf(config))
+	return valores, nil
+}
+
+func colorizarHex(valores map[string]any, v reflect.Value) {
+	tipoColor := reflect.TypeOf(color.RGBA{})
+	t := v.Type()
+
+	for i := range t.NumField() {
+		campo := t.Field(i)
+		if _, ok := valores[campo.Name]; !ok {
+			continue
+		}
+
+		switch {
+		case campo.Type == tipoColor:
+			valores[campo.Name] = formatearColorHex(v.Field(i).Interface().(color.RGBA))
+		case campo.Type.Kind() == reflect.Slice && campo.Type.Elem() == tipoColor:
+			lista, ok := valores[campo.Name].([]any)
+			if !ok {
+				continue
+			}
+			for j := range lista {
+				lista[j] = formatearColorHex(v.Field(i).Index(j).Interface().(color.RGBA))
+			}
+		case campo.Type.Kind() == reflect.Slice && campo.Type.Elem().Kind() == reflect.Struct:
+			lista, ok := valores[campo.Name].([]any)
+			if !ok {
+				continue
+			}
+			for j, elem := range lista {
+				if sub, ok := elem.(map[string]any); ok {
+					colorizarHex(sub, v.Field(i).Index(j))
+				}
+			}
+		}
+	}
+}
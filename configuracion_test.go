@@ -0,0 +1,173 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func escribirArchivo(t *testing.T, nombre, contenido string) string {
+	t.Helper()
+	ruta := filepath.Join(t.TempDir(), nombre)
+	if err := os.WriteFile(ruta, []byte(contenido), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return ruta
+}
+
+func TestCargarConfigYAMLyJSON(t *testing.T) {
+	yamlRuta := escribirArchivo(t, "rifa.yaml", `
+# rifa de prueba
+NumeroMinimo: 0
+NumeroMaximo: 999
+BoletasPorPagina: 10
+CantidadPaginas: 5
+BoletasPorFila: 2
+AnchoTalonario: 400
+AltoTalonario: 600
+CarpetaSalida: salida
+ColorTexto: "#F8DCBF"
+ColorBorde: "#10203080"
+TamanoFuente: 24
+OrientacionBoletas: 1
+Tandas:
+  - Nombre: azul
+    ColorTexto: "#0000FF"
+`)
+	jsonRuta := escribirArchivo(t, "rifa.json", `{
+		"NumeroMinimo": 0, "NumeroMaximo": 999, "BoletasPorPagina": 10, "CantidadPaginas": 5,
+		"BoletasPorFila": 2, "AnchoTalonario": 400, "AltoTalonario": 600, "CarpetaSalida": "salida",
+		"ColorTexto": "#F8DCBF", "ColorBorde": "#10203080", "TamanoFuente": 24, "OrientacionBoletas": 1,
+		"Tandas": [{"Nombre": "azul", "ColorTexto": "#0000FF"}]
+	}`)
+
+	for _, ruta := range []string{yamlRuta, jsonRuta} {
+		config, err := CargarConfig(ruta)
+		if err != nil {
+			t.Fatalf("CargarConfig(%s): %v", filepath.Base(ruta), err)
+		}
+		if config.NumeroMaximo != 999 || config.BoletasPorFila != 2 || config.TamanoFuente != 24 {
+			t.Errorf("%s: campos numéricos mal cargados: %+v", filepath.Base(ruta), config)
+		}
+		if config.ColorTexto != (color.RGBA{0xF8, 0xDC, 0xBF, 0xFF}) {
+			t.Errorf("%s: ColorTexto = %v", filepath.Base(ruta), config.ColorTexto)
+		}
+		if config.ColorBorde != (color.RGBA{0x10, 0x20, 0x30, 0x80}) {
+			t.Errorf("%s: ColorBorde = %v", filepath.Base(ruta), config.ColorBorde)
+		}
+		if config.OrientacionBoletas != OrientacionCentro {
+			t.Errorf("%s: OrientacionBoletas = %v", filepath.Base(ruta), config.OrientacionBoletas)
+		}
+		if len(config.Tandas) != 1 || config.Tandas[0].ColorTexto != (color.RGBA{0, 0, 0xFF, 0xFF}) {
+			t.Errorf("%s: Tandas = %+v", filepath.Base(ruta), config.Tandas)
+		}
+		if config.IgnorarEXIF {
+			t.Errorf("%s: IgnorarEXIF debería ser false por defecto", filepath.Base(ruta))
+		}
+	}
+}
+
+func TestCargarConfigErrores(t *testing.T) {
+	casos := map[string]struct {
+		nombre, contenido, mensaje string
+	}{
+		"campo faltante": {"a.yaml", "NumeroMaximo: 99\n", "BoletasPorPagina"},
+		"campo desconocido": {"b.json", `{"NumeroMaximo": 99, "BoletasPorPagina": 1, "CantidadPaginas": 1,
+			"BoletasPorFila": 1, "AnchoTalonario": 10, "AltoTalonario": 10, "CarpetaSalida": "x", "Colr": 1}`, "Colr"},
+		"color inválido": {"c.yml", `NumeroMaximo: 99
+BoletasPorPagina: 1
+CantidadPaginas: 1
+BoletasPorFila: 1
+AnchoTalonario: 10
+AltoTalonario: 10
+CarpetaSalida: x
+ColorTexto: "#12"
+`, "ColorTexto"},
+		"validación": {"d.yaml", `NumeroMaximo: 9
+BoletasPorPagina: 10
+CantidadPaginas: 2
+BoletasPorFila: 1
+AnchoTalonario: 10
+AltoTalonario: 10
+CarpetaSalida: x
+`, "no hay suficientes números"},
+		"extensión": {"e.toml", "", "formato"},
+	}
+
+	for nombre, c := range casos {
+		_, err := CargarConfig(escribirArchivo(t, c.nombre, c.contenido))
+		if err == nil || !strings.Contains(err.Error(), c.mensaje) {
+			t.Errorf("%s: error = %v, se esperaba que mencionara %q", nombre, err, c.mensaje)
+		}
+	}
+}
+
+func TestCargarConfigMapaEtiquetasYAML(t *testing.T) {
+	ruta := escribirArchivo(t, "etiquetas.yaml", `
+NumeroMaximo: 19
+BoletasPorPagina: 5
+CantidadPaginas: 2
+BoletasPorFila: 1
+AnchoTalonario: 100
+AltoTalonario: 100
+CarpetaSalida: salida
+MapaEtiquetas:
+  0: BRONCE
+  10: PLATA
+`)
+	config, err := CargarConfig(ruta)
+	if err != nil {
+		t.Fatalf("CargarConfig: %v", err)
+	}
+	if config.MapaEtiquetas[0] != "BRONCE" || config.MapaEtiquetas[10] != "PLATA" {
+		t.Errorf("MapaEtiquetas = %v", config.MapaEtiquetas)
+	}
+}
+
+func TestManifiestoSePuedeCargar(t *testing.T) {
+	config := configPrueba(t)
+	config.Semilla = 0
+	config.ColorBorde = color.RGBA{0x10, 0x20, 0x30, 0x80}
+	config.ColoresAlternos = []color.RGBA{{0xFF, 0, 0, 0xFF}, {0, 0, 0xFF, 0xFF}}
+	config.Tandas = []TemaConfig{{Nombre: "roja", ColorTexto: color.RGBA{0xFF, 0, 0, 0xFF}}}
+	gen := nuevoGeneradorPrueba(t, config)
+
+	ruta := filepath.Join(config.CarpetaSalida, "manifiesto.json")
+	if err := gen.EscribirManifiesto(ruta); err != nil {
+		t.Fatalf("EscribirManifiesto: %v", err)
+	}
+
+	datos, err := os.ReadFile(ruta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct {
+		Semilla int64
+		Config  map[string]any
+	}
+	if err := decodificarJSON(datos, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Semilla == 0 || m.Semilla != gen.semilla {
+		t.Errorf("semilla del manifiesto = %d, se esperaba %d", m.Semilla, gen.semilla)
+	}
+	if m.Config["ColorBorde"] != "#10203080" {
+		t.Errorf("ColorBorde = %v, se esperaba hexadecimal", m.Config["ColorBorde"])
+	}
+	if alternos, _ := m.Config["ColoresAlternos"].([]any); len(alternos) != 2 || alternos[1] != "#0000FF" {
+		t.Errorf("ColoresAlternos = %v, se esperaban colores hexadecimales", m.Config["ColoresAlternos"])
+	}
+
+	cargada, err := decodificarConfig(m.Config, camposRequeridos)
+	if err != nil {
+		t.Fatalf("la configuración del manifiesto no se pudo cargar: %v", err)
+	}
+	if cargada.Semilla != gen.semilla || cargada.ColorBorde != config.ColorBorde ||
+		cargada.Tandas[0].ColorTexto != config.Tandas[0].ColorTexto || cargada.NumeroMaximo != config.NumeroMaximo ||
+		!slices.Equal(cargada.ColoresAlternos, config.ColoresAlternos) {
+		t.Errorf("configuración recargada distinta: %+v", cargada)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// espacioLibre no está disponible en este sistema operativo.
+func espacioLibre(ruta string) int64 {
+	return -1
+}
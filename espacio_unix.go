@@ -0,0 +1,15 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// espacioLibre devuelve los bytes disponibles en el sistema de archivos que
+// contiene ruta, o -1 si no se pueden consultar.
+func espacioLibre(ruta string) int64 {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(ruta, &st); err != nil {
+		return -1
+	}
+	return int64(st.Bavail) * int64(st.Bsize)
+}
@@ -2,6 +2,10 @@ module github.com/juanpcastano/rafflemaker
 
 go 1.24.4
 
-require golang.org/x/image v0.28.0
-
-require golang.org/x/text v0.26.0 // indirect
+require (
+	github.com/boombuler/barcode v1.1.0
+	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
+	golang.org/x/image v0.28.0
+	golang.org/x/text v0.26.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -1,375 +1,4758 @@
 package main
 
 import (
+	"bytes"
+	"container/list"
+	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"hash/crc32"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/jpeg"
 	"image/png"
+	"io"
+	"io/fs"
+	"iter"
 	"log"
+	"log/slog"
+	"math"
 	"math/rand"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/code39"
+	"github.com/rwcarlsen/goexif/exif"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/basicfont"
 	"golang.org/x/image/font/opentype"
 	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/vector"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
 )
 
+type Orientacion int
+
+const (
+	OrientacionIzquierda Orientacion = iota
+	OrientacionCentro
+	OrientacionDerecha
+)
+
+func (o Orientacion) String() string {
+	switch o {
+	case OrientacionIzquierda:
+		return "izquierda"
+	case OrientacionCentro:
+		return "centro"
+	case OrientacionDerecha:
+		return "derecha"
+	}
+	return fmt.Sprintf("Orientacion(%d)", int(o))
+}
+
 type Config struct {
-	ImagenBase         string
-	BoletasPorFila     int
-	NumeroMinimo       int
-	NumeroMaximo       int
-	BoletasPorPagina   int
-	CantidadPaginas    int
-	CarpetaSalida      string
-	AnchoTalonario     int
-	AltoTalonario      int
-	MargenSuperior     int
-	MargenInferior     int
-	MargenIzquierdo    int
-	MargenDerecho      int
-	ColorTexto         color.RGBA
-	ColorBorde         color.RGBA
-	Fuente             font.Face
-	RutaFuente         string
-	TamanoFuente       float64
-	AnchoLineas        int
-	OrientacionBoletas int // 0: izquierda, 1: centro, 2: derecha
+	ImagenBase             string // ruta local, "embed:<ruta>" dentro de Recursos o URL http(s)://
+	BoletasPorFila         int
+	NumeroMinimo           int
+	NumeroMaximo           int
+	BoletasPorPagina       int
+	CantidadPaginas        int
+	CarpetaSalida          string // "-" escribe la única imagen en la salida estándar
+	AnchoTalonario         int
+	AltoTalonario          int
+	MargenSuperior         int
+	MargenInferior         int
+	MargenIzquierdo        int
+	MargenDerecho          int
+	ColorTexto             color.RGBA
+	ColorBorde             color.RGBA
+	ColorLinea             color.RGBA // si no se define se usa ColorBorde
+	Fuente                 font.Face  `json:"-"`
+	RutaFuente             string
+	TamanoFuente           float64
+	AnchoLineas            int
+	OrientacionBoletas     Orientacion
+	CentrarGrid            bool
+	IgnorarEXIF            bool // no aplica la orientación EXIF de los JPEG
+	SeriePrefijo           string
+	Tandas                 []TemaConfig
+	CompartirNumeros       bool // las tandas comparten el mismo conjunto de números usados
+	DigitoControl          bool // agrega un dígito verificador Luhn, p. ej. "0042-2"
+	RotarSalida            int  // 0, 90, 180 o 270 grados en sentido horario
+	TalonariosPorHoja      int  // >1 combina varios talonarios en una sola imagen
+	ColumnasHoja           int  // 0: se calcula automáticamente
+	EspaciadoHoja          int
+	Logger                 *slog.Logger `json:"-"` // nil: slog.Default()
+	TextoPie               string       // admite {id}, {total}, {fecha}, {suma} y {paridad}
+	TamanoFuentePie        float64      // 0: mismo tamaño que TamanoFuente
+	OrdenarDentroTalonario bool         // muestra las boletas de cada talonario en orden ascendente
+	TamanoCacheImagenes    int          // imágenes escaladas en caché; 0: 8, negativo: sin caché
+	Semilla                int64        // 0: semilla aleatoria
+	// Márgenes como porcentaje (0-100) del ancho o alto del talonario. Si son
+	// mayores que 0 tienen prioridad sobre el margen en píxeles correspondiente.
+	MargenSuperiorPct       float64
+	MargenInferiorPct       float64
+	MargenIzquierdoPct      float64
+	MargenDerechoPct        float64
+	GuiasCorte              bool       // líneas finas en todos los bordes de corte entre boletas
+	ColorGuia               color.RGBA // si no se define se usa gris
+	SeparadorMiles          string     // p. ej. "." para mostrar "123.456"
+	AjustarFuenteAutomatico bool       // calcula TamanoFuente para que el número quepa en la boleta
+	FraccionAjusteFuente    float64    // fracción de la boleta que puede ocupar el número; 0: 0.8
+	// ComenzarDesde reanuda una corrida interrumpida: los talonarios con ID menor
+	// no se dibujan ni se escriben, pero sus números se siguen sorteando para que
+	// los siguientes reciban los mismos que en la corrida original. Solo es
+	// reproducible con la misma Semilla y la misma configuración de números.
+	ComenzarDesde          int
+	OpacidadImagenBase     float64        // 0-1; 0 equivale a 1 (opaca)
+	ArchivoJSON            string         // si se define, GenerarTodos escribe ahí los números en JSON
+	JSONLegible            bool           // JSON con sangría
+	MapaEtiquetas          map[int]string // etiqueta que se imprime en lugar del número, p. ej. 7: "BRONCE"
+	TamanoPagina           string         // "A4", "A5" o "Letter"; si se define reemplaza AnchoTalonario y AltoTalonario
+	PaginaHorizontal       bool
+	DPI                    int          // resolución para TamanoPagina; 0: 300
+	VerificarDuplicados    bool         // al terminar, falla si algún número aparece más de una vez
+	FondoTexto             color.RGBA   // caja detrás de cada número; alfa no premultiplicado, 0: sin caja
+	PaddingFondoTexto      int          // 0: 4 píxeles
+	FormatoSalida          string       // "png" (por defecto) o "tiff"
+	CompresionTIFF         string       // "ninguna" (por defecto) o "deflate"
+	NumeroEnEsquinas       bool         // dibuja el número en las cuatro esquinas de cada boleta
+	SoloPrimera            bool         // GenerarTodos escribe solo el talonario 1, para revisar el diseño
+	ExcluirRepetidos       bool         // descarta números con todos los dígitos iguales, p. ej. 1111
+	ExcluirSecuenciales    bool         // descarta números de dígitos consecutivos, p. ej. 1234 o 4321
+	Precio                 float64      // 0: no se imprime precio
+	Moneda                 string       // símbolo antepuesto al precio, p. ej. "$"
+	TextoPrecio            string       // admite {precio}; vacío: "{precio}"
+	TamanoFuentePrecio     float64      // 0: mismo tamaño que TamanoFuente
+	Manifiesto             bool         // al terminar escribe manifiesto.json en CarpetaSalida
+	GenerarCodigoBarras    bool         // dibuja Formateado como código de barras en una franja de la boleta
+	SimbologiaCodigo       string       // "code128" (por defecto) o "code39"
+	AltoCodigoBarras       int          // 0: un cuarto del alto de la boleta
+	PosicionCodigoBarras   string       // "abajo" (por defecto) o "arriba", a todo el ancho; "sup-izq", "sup-der", "inf-izq", "inf-der" o "xy" (XCodigoBarras, YCodigoBarras)
+	Decoraciones           []Decoracion // figuras fijas dibujadas una vez por talonario sobre la cuadrícula
+	DigitosFormato         int          // ancho con ceros a la izquierda; 0: los dígitos de NumeroMaximo
+	EstrategiaNumeros      string       // "rechazo" o "permutacion" (baraja una vez los disponibles); vacío: según fraccionDensa
+	AlineacionVertical     string       // "arriba", "centro" (por defecto) o "abajo"
+	ContornoTexto          color.RGBA   // color del contorno de los números; si no se define se usa negro
+	GrosorContorno         int          // píxeles de contorno alrededor de cada número; 0: sin contorno
+	CopiasPorNumero        int          // boletas consecutivas del mismo talonario que comparten número; 0: 1
+	ImagenEncabezado       string       // imagen escalada dentro de MargenSuperior, sobre la imagen base y bajo la cuadrícula
+	AvisarDesborde         bool         // si un número no cabe en la boleta solo se avisa; si no, se reduce la fuente de esa boleta
+	SegundaRepresentacion  string       // "arabe", "persa" o "devanagari": repite el número debajo con esos dígitos
+	TablaDigitos           string       // diez caracteres para los dígitos 0-9; reemplaza la tabla de SegundaRepresentacion
+	RutaFuenteSegunda      string       // fuente con los dígitos de la segunda representación; vacío: la principal
+	CorreccionAspecto      float64      // DPI horizontal / DPI vertical de la impresora; escala el ancho al guardar; 0: 1
+	OrdenCapas             string       // "imagen-fondo" (por defecto) o "imagen-frente": la imagen base sobre la cuadrícula; requiere transparencia u OpacidadImagenBase
+	Locale                 string       // p. ej. "es-CO" o "en-US": separadores, moneda y decimales de {precio}; vacío o desconocido: formato propio
+	ReintentosEscritura    int          // reintentos ante errores de E/S transitorios al guardar una imagen; 0: ninguno
+	ArchivoIndice          string       // si se define, GenerarTodos escribe ahí una imagen con una miniatura de cada talonario
+	AnchoMiniatura         int          // ancho de cada miniatura del índice; 0: 120
+	EtiquetarIndice        bool         // imprime el ID de cada talonario bajo su miniatura en el índice
+	ModoSalida             string       // si CarpetaSalida ya tiene talonarios: vacío avisa y sobrescribe, "sobrescribir", "error-si-existe" o "subcarpeta-timestamp"
+	FormaBoleta            string       // "rectangulo" (por defecto), "circulo" o "elipse": borde de cada boleta inscrito en su celda
+	IDCorrida              string       // identifica la corrida en el manifiesto y los metadatos; vacío: un UUID aleatorio
+	IDCorridaEnNombres     bool         // agrega IDCorrida a los nombres de archivo, p. ej. talonario_001_<id>.png
+	MetadatosPNG           bool         // guarda IDCorrida como texto tEXt en cada PNG
+	Recursos               fs.FS        `json:"-"` // archivos para las rutas "embed:" de ImagenBase e ImagenEncabezado, p. ej. un embed.FS
+	EspaciadoLetras        int          // píxeles extra entre los caracteres de cada número; 0: el espaciado de la fuente
+	ColoresAlternos        []color.RGBA // bordes que se alternan por fila o por columna; vacío: ColorBorde
+	AlternarPor            string       // "fila" (por defecto) o "columna": qué índice recorre ColoresAlternos
+	FondoAlterno           bool         // tiñe detrás del número con el color alterno, con la opacidad de FondoTexto o 96 si no se definió
+	NumerosPorBoleta       int          // números independientes por boleta, uno por nivel de premio, en líneas separadas; 0: 1
+	ContinuarEnError       bool         // si un talonario u hoja no se puede guardar, sigue con los demás y al final devuelve todos los errores
+	TexturaFondo           string       // imagen repetida en mosaico sobre el talonario, sobre la imagen base y bajo la cuadrícula; admite las mismas rutas que ImagenBase
+	OpacidadTextura        float64      // 0-1; 0 equivale a 1 (opaca)
+	MostrarRango           bool         // escribe en MargenInferior, a la derecha, el menor y el mayor número del talonario
+	RepartirSobrante       bool         // da un píxel más a las primeras celdas para que la cuadrícula llene exactamente el área entre márgenes
+	NumeroTalonarioVisible bool         // dibuja "Talonario N° 012" con el ID del talonario, aparte de los números de las boletas
+	XNumeroTalonario       int          // posición de la línea base del número de talonario; X e Y en 0: arriba a la derecha, dentro de MargenSuperior
+	YNumeroTalonario       int          // en píxeles desde el borde superior
+	TamanoFuenteTalonario  float64      // 0: mismo tamaño que TamanoFuente
+	ImagenSoloEn           string       // talonarios con imagen base: "todos" (por defecto), "primero" o "ultimo"; los demás quedan con el fondo liso
+	NivelCompresion        string       // compresión PNG: "defecto" (por defecto), "ninguna", "rapida" o "maxima"
+	GenerarReverso         bool         // escribe además talonario_NNN_reverso con el reverso de cada boleta, en espejo para imprimir a doble cara
+	TextoReverso           string       // texto de cada boleta del reverso, en líneas separadas por \n; admite {numero}, {id} y {fecha}
+	ImagenReverso          string       // fondo del reverso; vacío: fondo liso
+	TamanoFuenteReverso    float64      // 0: mismo tamaño que TamanoFuente
+	DecoracionesReverso    []Decoracion // figuras fijas del reverso, como Decoraciones
+	NumerosPredefinidos    []int        // números a usar en orden en lugar de sortearlos, p. ej. para reimprimir una corrida; uno por grupo de CopiasPorNumero
+	FuenteNumero           FuenteConfig // fuente de los números de las boletas; Ruta vacía: RutaFuente y TamanoFuente
+	FuenteEtiqueta         FuenteConfig // fuente de pie, precio, rango, número de talonario, reverso y decoraciones; Ruta vacía: la del número
+	DistribuirUltimoDigito bool         // dentro de cada talonario prefiere números con últimos dígitos distintos; es un esfuerzo razonable y cae al sorteo normal si no lo logra
+	LineasColumna          bool         // traza líneas de corte verticales entre columnas, de MargenSuperior a AltoTalonario - MargenInferior, en ColorLinea
+	EstiloLineasColumna    string       // "continua" (por defecto) o "discontinua"
+	SombraTexto            bool         // dibuja bajo cada texto una sombra desplazada
+	ColorSombra            color.RGBA   // vacío: negro semitransparente
+	DesplazamientoSombraX  int          // píxeles hacia la derecha; X e Y en 0: 2 y 2
+	DesplazamientoSombraY  int          // píxeles hacia abajo
+	BaseNumerica           int          // base de 2 a 36 en que se imprimen los números, con letras mayúsculas; 0: 10
+	ImagenEstricta         bool         // falla en vez de avisar si la imagen base es mucho menor que el talonario o de otra proporción
+	EspacioColor           string       // "rgb" (por defecto) o "cmyk", solo con FormatoSalida tiff; la conversión es ingenua, sin perfil ICC, y puede correr los tonos
+	NumerosDisponibles     []int        // únicos números que se pueden sortear, p. ej. los del papel ya numerado; vacío: todo el rango
+	UnArchivoPorBoleta     bool         // escribe cada boleta como boleta_NNN, con su recorte de la imagen base, en lugar del talonario completo
+	DesplazamientoGridX    int          // corre toda la cuadrícula de boletas en píxeles, sin tocar los márgenes, p. ej. para calzar con el marco de la imagen base
+	DesplazamientoGridY    int
+	FuenteRespaldo         string  // TTF/OTF para los caracteres que le faltan a la fuente de etiquetas, p. ej. emoji, que salen monocromos y no en color
+	FraccionAnchoCodigo    float64 // ancho del código de barras en las esquinas y con "xy", como fracción del ancho de la boleta; 0: la mitad
+	MargenCodigoBarras     int     // separación entre el código y el borde de la boleta; 0: AnchoLineas + 2
+	XCodigoBarras          int     // esquina superior izquierda del código respecto de la boleta con PosicionCodigoBarras "xy"
+	YCodigoBarras          int
+	Paso                   int          // solo se sortean NumeroMinimo, NumeroMinimo+Paso, NumeroMinimo+2·Paso… hasta NumeroMaximo; 0: 1
+	GradienteTexto         []color.RGBA // colores que recorre el número de boleta de izquierda a derecha, uno por runa según su centro; vacío: ColorTexto
+	BloqueReservado        [2]int       // números desde y hasta, inclusive, que el sorteo nunca asigna, p. ej. para cortesías que luego se generan con GenerarReservados; {0, 0}: ninguno
+	Supersampling          int          // dibuja cada talonario a 2, 3 o 4 veces su tamaño y lo reduce promediando, para suavizar bordes y texto; usa factor² de memoria y tiempo por talonario y requiere fuente TrueType; 0 o 1: desactivado
+	ModoRollo              bool         // para impresoras de rollo: escribe rollo.png con todas las boletas una debajo de la otra, sin paginar en talonarios; se escribe fila por fila, sin tener la imagen entera en memoria
+	ParidadNumeros         string       // "todos" (por defecto), "pares" o "impares": solo se sortean números de esa paridad
+	PaddingInterno         int          // separación entre el borde de cada boleta y su número, igual en los cuatro lados; 0: el ancho de un "0" a los lados, como antes
+	Tema                   string       // nombre de un tema de RegistrarTema o CargarTemas que completa los colores y fuentes que quedaron vacíos
+	// PostProcesar, si se define, recibe en GenerarTodos cada talonario ya
+	// dibujado, antes de guardarlo, p. ej. para estampar un sello o aplicar un
+	// filtro. Puede modificar img; si devuelve un error la corrida se detiene.
+	// Con UnArchivoPorBoleta y ModoRollo no hay imagen del talonario y no se
+	// llama.
+	PostProcesar func(id int, img *image.RGBA) error `json:"-"`
+}
+
+type claveEscalado struct {
+	hash        [sha256.Size]byte
+	ancho, alto int
+}
+
+type entradaEscalado struct {
+	clave  claveEscalado
+	imagen image.Image
+}
+
+// cacheEscalado guarda las últimas imágenes escaladas, identificadas por el
+// contenido de la imagen original y el tamaño destino, y descarta la menos
+// usada recientemente al superar su capacidad.
+type cacheEscalado struct {
+	mu        sync.Mutex
+	capacidad int
+	orden     *list.List
+	entradas  map[claveEscalado]*list.Element
+}
+
+func nuevoCacheEscalado(capacidad int) *cacheEscalado {
+	return &cacheEscalado{
+		capacidad: capacidad,
+		orden:     list.New(),
+		entradas:  make(map[claveEscalado]*list.Element),
+	}
+}
+
+func (c *cacheEscalado) obtener(clave claveEscalado) (image.Image, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entradas[clave]
+	if !ok {
+		return nil, false
+	}
+	c.orden.MoveToFront(elem)
+	return elem.Value.(*entradaEscalado).imagen, true
+}
+
+func (c *cacheEscalado) guardar(clave claveEscalado, imagen image.Image) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entradas[clave]; ok {
+		elem.Value.(*entradaEscalado).imagen = imagen
+		c.orden.MoveToFront(elem)
+		return
+	}
+
+	c.entradas[clave] = c.orden.PushFront(&entradaEscalado{clave: clave, imagen: imagen})
+	for c.orden.Len() > c.capacidad {
+		ultimo := c.orden.Back()
+		c.orden.Remove(ultimo)
+		delete(c.entradas, ultimo.Value.(*entradaEscalado).clave)
+	}
+}
+
+// hashImagen resume el contenido de la imagen; usa los píxeles crudos cuando
+// el tipo los expone y si no, recorre la imagen píxel a píxel.
+func hashImagen(img image.Image) [sha256.Size]byte {
+	h := sha256.New()
+	b := img.Bounds()
+	fmt.Fprintf(h, "%d,%d,%d,%d;", b.Min.X, b.Min.Y, b.Max.X, b.Max.Y)
+
+	switch src := img.(type) {
+	case *image.RGBA:
+		h.Write(src.Pix)
+	case *image.NRGBA:
+		h.Write(src.Pix)
+	case *image.Gray:
+		h.Write(src.Pix)
+	default:
+		var buf [8]byte
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, gr, bl, a := img.At(x, y).RGBA()
+				buf[0], buf[1] = byte(r>>8), byte(r)
+				buf[2], buf[3] = byte(gr>>8), byte(gr)
+				buf[4], buf[5] = byte(bl>>8), byte(bl)
+				buf[6], buf[7] = byte(a>>8), byte(a)
+				h.Write(buf[:])
+			}
+		}
+	}
+
+	var suma [sha256.Size]byte
+	copy(suma[:], h.Sum(nil))
+	return suma
+}
+
+// TemaConfig describe una tanda: un juego de talonarios con sus propios colores
+// y prefijo de serie. Los campos vacíos heredan el valor de Config.
+type TemaConfig struct {
+	Nombre       string
+	ColorTexto   color.RGBA
+	ColorBorde   color.RGBA
+	ColorLinea   color.RGBA
+	SeriePrefijo string
+	Precio       float64
+}
+
+// FuenteConfig es un archivo de fuente TrueType u OpenType con su tamaño; 0
+// usa TamanoFuente.
+type FuenteConfig struct {
+	Ruta   string
+	Tamano float64
+}
+
+// Decoracion es una figura fija sobre el lienzo del talonario. Tipo puede ser
+// "rect" (X, Y, Ancho, Alto; Relleno para pintarlo completo), "linea" (de X,Y a
+// X2,Y2) o "texto" (Texto con su inicio en X y su centro vertical en Y, de
+// tamaño Tamano o el de su fuente si es 0, con Fuente "etiqueta", la de
+// FuenteEtiqueta y por defecto, o "numero"). Grosor 0 equivale a 1.
+type Decoracion struct {
+	Tipo    string
+	X, Y    int
+	X2, Y2  int
+	Ancho   int
+	Alto    int
+	Texto   string
+	Tamano  float64
+	Fuente  string
+	Color   color.RGBA
+	Grosor  int
+	Relleno bool
 }
 
 type Boleta struct {
-	Numero     int
-	Formateado string
+	Numero     int    `json:"numero"`
+	Formateado string `json:"formateado"`
+	// Adicionales son los números de los niveles 2 en adelante con
+	// NumerosPorBoleta > 1, en orden de nivel y sin Adicionales propios.
+	Adicionales []Boleta `json:"adicionales,omitempty"`
 }
 
 type Talonario struct {
-	ID      int
-	Boletas []Boleta
+	ID      int      `json:"id"`
+	Boletas []Boleta `json:"boletas"`
+	Suma    int      `json:"suma"`    // de todos los números impresos, copias y adicionales incluidos, como control de auditoría
+	Paridad string   `json:"paridad"` // "par" o "impar", de Suma
+}
+
+// sumaNumeros suma los números de boletas, con sus adicionales.
+func sumaNumeros(boletas []Boleta) int {
+	suma := 0
+	for _, boleta := range boletas {
+		suma += boleta.Numero + sumaNumeros(boleta.Adicionales)
+	}
+	return suma
+}
+
+// paridad devuelve "par" o "impar" según n.
+func paridad(n int) string {
+	if n%2 == 0 {
+		return "par"
+	}
+	return "impar"
+}
+
+type TalonarioResultado struct {
+	Talonario Talonario
+	Imagen    *image.RGBA
+	Err       error
+}
+
+type GeneradorTalonarios struct {
+	config          Config
+	logger          *slog.Logger
+	numerosUsados   *registroNumeros
+	imagenBase      image.Image
+	encabezado      image.Image
+	textura         *image.RGBA // TexturaFondo ya repetida al tamaño del talonario
+	digitosFormato  int
+	base            int // BaseNumerica resuelta
+	fuenteOT        *opentype.Font
+	etiquetaOT      *opentype.Font // FuenteEtiqueta, o fuenteOT si no tiene Ruta
+	respaldoOT      *opentype.Font // FuenteRespaldo; nil si no hay
+	fuenteEtiqueta  font.Face
+	fuentePie       font.Face
+	fuentePrecio    font.Face
+	fuenteTalonario font.Face
+	textoPrecio     string
+	fuentesDecor    []font.Face
+	fuenteReverso   font.Face
+	fuentesReverso  []font.Face
+	imagenReverso   image.Image
+	tablaDigitos    []rune           // dígitos 0-9 de la segunda representación; nil: desactivada
+	impresora       *message.Printer // formato de Locale; nil: formato propio
+	unidadMoneda    currency.Unit
+	monedaDespues   bool // el símbolo va después del importe, p. ej. "5.000,00 €"
+	fuenteSegunda   font.Face
+	// fuentesReducidas guarda por tamaño las fuentes con que se achican los
+	// números que no caben en su boleta.
+	fuentesReducidas map[float64]font.Face
+	desbordeAvisado  bool
+	fecha            string
+	cache            *cacheEscalado
+	codificadorPNG   *png.Encoder
+	rng              *rand.Rand
+	semilla          int64
+	idCorrida        string
+	disponibles      int
+	disponiblesCota  bool   // disponibles es una cota: se dejó de contar al llegar al tope
+	estrategia       string // EstrategiaNumeros resuelta: "rechazo" o "permutacion"
+	pendientes       []int  // números aún no sorteados, ya barajados (estrategia "permutacion")
+	niveles          []nivelNumeros
+	talonarios       []Talonario
+	generado         bool // ya se sorteó con GenerarTodos, GenerarStream o Talonarios
+	estadisticas     EstadisticasGeneracion
+	permitidos       map[int]bool // NumerosDisponibles como conjunto; nil: todo el rango
+	// supermuestreo dibuja los talonarios a Supersampling veces el tamaño;
+	// nil: desactivado.
+	supermuestreo *GeneradorTalonarios
+}
+
+var ErrNumerosAgotados = errors.New("no quedan números disponibles en el rango")
+
+// ErrGeneradorUsado lo devuelven GenerarTodos, GenerarStream y Talonarios
+// cuando el generador ya sorteó sus talonarios.
+var ErrGeneradorUsado = errors.New("el generador ya generó sus talonarios; cree otro con NewGeneradorTalonarios")
+
+// localesMonedaDespues son los idiomas, o idioma-región, que escriben el
+// símbolo de la moneda después del importe. golang.org/x/text no expone el
+// patrón de moneda de CLDR, así que se listan los casos comunes.
+var localesMonedaDespues = map[string]bool{
+	"de":    true,
+	"fr":    true,
+	"it":    true,
+	"ca":    true,
+	"es-ES": true,
+	"pt-PT": true,
+}
+
+// tablasDigitos son los dígitos 0-9 de cada SegundaRepresentacion.
+var tablasDigitos = map[string]string{
+	"arabe":      "٠١٢٣٤٥٦٧٨٩",
+	"persa":      "۰۱۲۳۴۵۶۷۸۹",
+	"devanagari": "०१२३४५६७८९",
+}
+
+// fraccionDensa es la fracción de los números disponibles a partir de la cual
+// un sorteo se considera denso y, sin EstrategiaNumeros, usa la permutación.
+// Desde ahí el mapa del muestreo por rechazo (unos 50 bytes por número usado)
+// ocupa más que la permutación (8 bytes por número disponible) más el bitset,
+// y los reintentos del rechazo empiezan a crecer.
+const fraccionDensa = 0.25
+
+// maxRangoDenso es el rango más grande, de NumeroMinimo a NumeroMaximo, con
+// que se usa la permutación: su bitset y su lista de disponibles crecen con el
+// rango completo, y con 1<<24 números ya ocupan unos 130 MB.
+const maxRangoDenso = 1 << 24
+
+// registroNumeros lleva los números ya sorteados: en un mapa para sorteos
+// dispersos o en un bitset sobre el rango completo para sorteos densos.
+type registroNumeros struct {
+	minimo   int
+	mapa     map[int]bool
+	bits     []uint64
+	cantidad int
+}
+
+func nuevoRegistroNumeros(minimo, maximo int, denso bool) *registroNumeros {
+	r := &registroNumeros{minimo: minimo}
+	if denso {
+		r.bits = make([]uint64, (maximo-minimo)/64+1)
+	} else {
+		r.mapa = make(map[int]bool)
+	}
+	return r
+}
+
+func (r *registroNumeros) contiene(numero int) bool {
+	if r.bits != nil {
+		i := numero - r.minimo
+		return r.bits[i/64]&(1<<(i%64)) != 0
+	}
+	return r.mapa[numero]
+}
+
+func (r *registroNumeros) marcar(numero int) {
+	if r.contiene(numero) {
+		return
+	}
+	if r.bits != nil {
+		i := numero - r.minimo
+		r.bits[i/64] |= 1 << (i % 64)
+	} else {
+		r.mapa[numero] = true
+	}
+	r.cantidad++
+}
+
+func (r *registroNumeros) desmarcar(numero int) {
+	if !r.contiene(numero) {
+		return
+	}
+	if r.bits != nil {
+		i := numero - r.minimo
+		r.bits[i/64] &^= 1 << (i % 64)
+	} else {
+		delete(r.mapa, numero)
+	}
+	r.cantidad--
+}
+
+// nivelNumeros es el sorteo propio de uno de los niveles adicionales de
+// NumerosPorBoleta; el nivel 1 usa numerosUsados y pendientes del generador.
+type nivelNumeros struct {
+	usados     *registroNumeros
+	pendientes []int
+}
+
+func NewGeneradorTalonarios(config Config) (*GeneradorTalonarios, error) {
+	config, err := aplicarTema(config)
+	if err != nil {
+		return nil, err
+	}
+
+	gen := &GeneradorTalonarios{
+		config: config,
+		logger: loggerOPorDefecto(config.Logger),
+		fecha:  time.Now().Format("2006-01-02"),
+	}
+
+	semilla := config.Semilla
+	if semilla == 0 {
+		semilla = time.Now().UnixNano()
+	}
+	gen.semilla = semilla
+	gen.rng = rand.New(rand.NewSource(semilla))
+
+	gen.idCorrida = config.IDCorrida
+	if gen.idCorrida == "" {
+		gen.idCorrida = nuevoUUID()
+	}
+
+	switch {
+	case config.TamanoCacheImagenes == 0:
+		gen.cache = nuevoCacheEscalado(8)
+	case config.TamanoCacheImagenes > 0:
+		gen.cache = nuevoCacheEscalado(config.TamanoCacheImagenes)
+	}
+
+	gen.codificadorPNG = &png.Encoder{
+		CompressionLevel: nivelesCompresionPNG[strings.ToLower(config.NivelCompresion)],
+		BufferPool:       &poolBuffersPNG{},
+	}
+
+	if err := gen.resolverConfig(); err != nil {
+		return nil, err
+	}
+
+	if gen.config.ColorLinea == (color.RGBA{}) {
+		gen.config.ColorLinea = gen.config.ColorBorde
+	}
+
+	if err := gen.validarConfig(); err != nil {
+		return nil, err
+	}
+	// Alcanza con saber si hay más de los que hacen denso al sorteo
+	tope := int(float64(gen.numerosNecesarios())/fraccionDensa) + 1
+	gen.disponibles = gen.contarDisponibles(tope)
+	gen.disponiblesCota = gen.disponibles == tope
+	gen.estrategia = gen.elegirEstrategia()
+	if gen.estrategia == "permutacion" && gen.disponiblesCota {
+		// La permutación recorre el rango entero de todos modos
+		gen.disponibles, gen.disponiblesCota = gen.contarDisponibles(math.MaxInt), false
+	}
+	gen.numerosUsados = gen.nuevoRegistro()
+	gen.niveles = gen.nuevosNiveles()
+
+	if config.RutaFuente != "" {
+		if err := gen.cargarFuentePersonalizada(); err != nil {
+			gen.logger.Warn("no se pudo cargar la fuente personalizada, usando fuente por defecto", "error", err)
+			gen.config.Fuente = basicfont.Face7x13
+		}
+	} else {
+		gen.config.Fuente = basicfont.Face7x13
+	}
+
+	if config.AjustarFuenteAutomatico {
+		if gen.fuenteOT == nil {
+			gen.logger.Warn("el ajuste automático de fuente requiere una fuente personalizada, se usa el tamaño fijo")
+		} else if err := gen.ajustarTamanoFuente(); err != nil {
+			return nil, fmt.Errorf("error ajustando tamaño de fuente: %v", err)
+		}
+	}
+
+	if gen.fuenteOT != nil {
+		gen.avisarAltoFuente()
+	}
+
+	if err := gen.cargarFuenteEtiqueta(); err != nil {
+		gen.logger.Warn("no se pudo cargar la fuente de etiquetas, se usa la del número", "error", err)
+		gen.etiquetaOT, gen.fuenteEtiqueta = gen.fuenteOT, gen.config.Fuente
+	}
+	if config.FuenteRespaldo != "" {
+		if gen.respaldoOT, err = leerFuente(config.FuenteRespaldo); err != nil {
+			gen.logger.Warn("no se pudo cargar la fuente de respaldo, los caracteres que falten saldrán en blanco", "error", err)
+		} else {
+			gen.logger.Info("fuente de respaldo cargada", "ruta", config.FuenteRespaldo)
+			gen.fuenteEtiqueta = gen.conRespaldo(gen.fuenteEtiqueta, gen.tamanoEtiqueta())
+		}
+	}
+
+	if gen.fuentePie, err = gen.faceSecundaria(config.TamanoFuentePie); err != nil {
+		return nil, fmt.Errorf("error creando fuente del pie: %v", err)
+	}
+	if gen.fuentePrecio, err = gen.faceSecundaria(config.TamanoFuentePrecio); err != nil {
+		return nil, fmt.Errorf("error creando fuente del precio: %v", err)
+	}
+	if gen.fuenteTalonario, err = gen.faceSecundaria(config.TamanoFuenteTalonario); err != nil {
+		return nil, fmt.Errorf("error creando fuente del número de talonario: %v", err)
+	}
+
+	if config.Locale != "" {
+		gen.prepararLocale()
+	}
+
+	if config.Precio > 0 {
+		plantilla := config.TextoPrecio
+		if plantilla == "" {
+			plantilla = "{precio}"
+		}
+		gen.textoPrecio = strings.ReplaceAll(plantilla, "{precio}", gen.formatearPrecio(config.Precio))
+	}
+
+	if err := gen.prepararSegundaRepresentacion(); err != nil {
+		return nil, err
+	}
+
+	if gen.fuentesDecor, err = gen.fuentesDecoraciones(config.Decoraciones); err != nil {
+		return nil, err
+	}
+
+	if config.GenerarReverso {
+		if err := gen.prepararReverso(); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.GenerarCodigoBarras {
+		if err := gen.validarCodigoBarras(); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.ImagenBase != "" {
+		if err := gen.cargarImagenBase(); err != nil {
+			return nil, fmt.Errorf("error cargando imagen base: %v", err)
+		}
+	}
+
+	if config.OrdenCapas == "imagen-frente" && gen.imagenBase != nil {
+		op := config.OpacidadImagenBase
+		if opaca, ok := gen.imagenBase.(interface{ Opaque() bool }); ok && opaca.Opaque() && (op == 0 || op == 1) {
+			gen.logger.Warn("la imagen base es opaca y con OrdenCapas imagen-frente tapará los números; use transparencia u OpacidadImagenBase")
+		}
+	}
+
+	if config.TexturaFondo != "" {
+		if err := gen.prepararTextura(); err != nil {
+			return nil, fmt.Errorf("error cargando textura de fondo %s: %v", config.TexturaFondo, err)
+		}
+	}
+
+	if config.ImagenEncabezado != "" {
+		var err error
+		if gen.encabezado, err = gen.cargarImagen(config.ImagenEncabezado); err != nil {
+			return nil, fmt.Errorf("error cargando imagen de encabezado %s: %v", config.ImagenEncabezado, err)
+		}
+	}
+
+	if config.Supersampling > 1 {
+		if err := gen.prepararSupermuestreo(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sin carpeta de salida el generador solo se usa en memoria (GenerarStream).
+	if config.CarpetaSalida != "" && config.CarpetaSalida != salidaEstandar {
+		if err := gen.prepararCarpetaSalida(); err != nil {
+			return nil, err
+		}
+	}
+
+	return gen, nil
+}
+
+// prepararCarpetaSalida crea la carpeta de salida y aplica ModoSalida si ya
+// contiene imágenes de una corrida anterior. Con "subcarpeta-timestamp" la
+// corrida se escribe en una subcarpeta nueva, que pasa a ser CarpetaSalida.
+func (g *GeneradorTalonarios) prepararCarpetaSalida() error {
+	if err := os.MkdirAll(g.config.CarpetaSalida, 0755); err != nil {
+		return fmt.Errorf("error creando carpeta de salida: %v", err)
+	}
+
+	existentes, err := g.imagenesExistentes()
+	if err != nil {
+		return fmt.Errorf("error revisando carpeta de salida: %v", err)
+	}
+	if existentes == 0 {
+		return nil
+	}
+
+	switch g.config.ModoSalida {
+	case "sobrescribir":
+	case "error-si-existe":
+		return fmt.Errorf("la carpeta de salida %s ya contiene %d imágenes de talonarios", g.config.CarpetaSalida, existentes)
+	case "subcarpeta-timestamp":
+		carpeta := filepath.Join(g.config.CarpetaSalida, time.Now().Format("20060102-150405"))
+		if err := os.Mkdir(carpeta, 0755); err != nil {
+			return fmt.Errorf("error creando subcarpeta de salida: %v", err)
+		}
+		g.logger.Info("la carpeta de salida ya tiene talonarios, se usa una subcarpeta", "carpeta", carpeta, "existentes", existentes)
+		g.config.CarpetaSalida = carpeta
+	default:
+		// Al reanudar con ComenzarDesde las imágenes anteriores son esperadas.
+		if g.config.ComenzarDesde <= 1 {
+			g.logger.Warn("la carpeta de salida ya tiene talonarios y se sobrescribirán; use ModoSalida para evitarlo",
+				"carpeta", g.config.CarpetaSalida, "existentes", existentes)
+		}
+	}
+	return nil
+}
+
+// imagenesExistentes cuenta los talonarios y hojas con el formato de salida
+// actual que ya hay en CarpetaSalida.
+func (g *GeneradorTalonarios) imagenesExistentes() (int, error) {
+	total := 0
+	for _, patron := range []string{"talonario_*", "hoja_*", "boleta_*", "rollo*"} {
+		coincidencias, err := filepath.Glob(filepath.Join(g.config.CarpetaSalida, patron+g.extensionSalida()))
+		if err != nil {
+			return 0, err
+		}
+		total += len(coincidencias)
+	}
+	return total, nil
+}
+
+// CarpetaSalida devuelve la carpeta donde se escriben las imágenes, que con
+// ModoSalida "subcarpeta-timestamp" puede diferir de Config.CarpetaSalida.
+func (g *GeneradorTalonarios) CarpetaSalida() string {
+	return g.config.CarpetaSalida
+}
+
+// tamanosPagina en milímetros, en orientación vertical.
+var tamanosPagina = map[string][2]float64{
+	"A4":     {210, 297},
+	"A5":     {148, 210},
+	"LETTER": {215.9, 279.4},
+}
+
+// resolverConfig calcula los valores derivados de la configuración: primero
+// las dimensiones de TamanoPagina y después los márgenes en porcentaje.
+func (g *GeneradorTalonarios) resolverConfig() error {
+	if g.config.FuenteNumero.Ruta != "" {
+		g.config.RutaFuente = g.config.FuenteNumero.Ruta
+		if g.config.FuenteNumero.Tamano > 0 {
+			g.config.TamanoFuente = g.config.FuenteNumero.Tamano
+		}
+	}
+	g.base = g.config.BaseNumerica
+	if g.base == 0 {
+		g.base = 10
+	}
+	if g.base < 2 || g.base > 36 {
+		return fmt.Errorf("BaseNumerica inválida: %d (valores válidos: 2 a 36)", g.config.BaseNumerica)
+	}
+	g.digitosFormato = len(strconv.FormatInt(int64(g.config.NumeroMaximo), g.base))
+	if g.config.DigitosFormato > 0 {
+		g.digitosFormato = g.config.DigitosFormato
+	}
+	if err := g.resolverDisponibles(); err != nil {
+		return err
+	}
+	if err := g.resolverTamanoPagina(); err != nil {
+		return err
+	}
+	g.resolverMargenesPct()
+	return nil
+}
+
+// resolverDisponibles arma el conjunto de NumerosDisponibles, que deben estar
+// dentro del rango y sin repetir.
+func (g *GeneradorTalonarios) resolverDisponibles() error {
+	if len(g.config.NumerosDisponibles) == 0 {
+		return nil
+	}
+	g.permitidos = make(map[int]bool, len(g.config.NumerosDisponibles))
+	for i, numero := range g.config.NumerosDisponibles {
+		if numero < g.config.NumeroMinimo || numero > g.config.NumeroMaximo {
+			return fmt.Errorf("NumerosDisponibles[%d] = %d está fuera del rango %d-%d", i, numero, g.config.NumeroMinimo, g.config.NumeroMaximo)
+		}
+		if g.permitidos[numero] {
+			return fmt.Errorf("NumerosDisponibles repite el número %d", numero)
+		}
+		g.permitidos[numero] = true
+	}
+	return nil
+}
+
+func (g *GeneradorTalonarios) resolverTamanoPagina() error {
+	if g.config.TamanoPagina == "" {
+		return nil
+	}
+
+	mm, ok := tamanosPagina[strings.ToUpper(g.config.TamanoPagina)]
+	if !ok {
+		return fmt.Errorf("tamaño de página desconocido: %q (valores válidos: A4, A5, Letter)", g.config.TamanoPagina)
+	}
+
+	dpi := g.config.DPI
+	if dpi == 0 {
+		dpi = 300
+	}
+	if dpi < 0 {
+		return fmt.Errorf("DPI inválido: %d", dpi)
+	}
+
+	ancho := int(math.Round(mm[0] / 25.4 * float64(dpi)))
+	alto := int(math.Round(mm[1] / 25.4 * float64(dpi)))
+	if g.config.PaginaHorizontal {
+		ancho, alto = alto, ancho
+	}
+
+	g.config.AnchoTalonario = ancho
+	g.config.AltoTalonario = alto
+	return nil
+}
+
+// resolverMargenesPct convierte los márgenes en porcentaje a píxeles.
+func (g *GeneradorTalonarios) resolverMargenesPct() {
+	aPixeles := func(pct float64, dimension int) int {
+		return int(math.Round(pct / 100 * float64(dimension)))
+	}
+
+	if g.config.MargenSuperiorPct > 0 {
+		g.config.MargenSuperior = aPixeles(g.config.MargenSuperiorPct, g.config.AltoTalonario)
+	}
+	if g.config.MargenInferiorPct > 0 {
+		g.config.MargenInferior = aPixeles(g.config.MargenInferiorPct, g.config.AltoTalonario)
+	}
+	if g.config.MargenIzquierdoPct > 0 {
+		g.config.MargenIzquierdo = aPixeles(g.config.MargenIzquierdoPct, g.config.AnchoTalonario)
+	}
+	if g.config.MargenDerechoPct > 0 {
+		g.config.MargenDerecho = aPixeles(g.config.MargenDerechoPct, g.config.AnchoTalonario)
+	}
+}
+
+func loggerOPorDefecto(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+func (g *GeneradorTalonarios) cargarFuentePersonalizada() error {
+	f, face, err := cargarFuente(g.config.RutaFuente, g.config.TamanoFuente)
+	if err != nil {
+		return err
+	}
+	g.fuenteOT = f
+	g.config.Fuente = face
+	g.logger.Info("fuente personalizada cargada", "ruta", g.config.RutaFuente, "tamano", g.config.TamanoFuente)
+	return nil
+}
+
+// cargarFuenteEtiqueta prepara la fuente de los textos secundarios. Sin Ruta
+// en FuenteEtiqueta se usa la del número, a FuenteEtiqueta.Tamano si se indica.
+func (g *GeneradorTalonarios) cargarFuenteEtiqueta() error {
+	g.etiquetaOT, g.fuenteEtiqueta = g.fuenteOT, g.config.Fuente
+	tamano := g.config.FuenteEtiqueta.Tamano
+	if g.config.FuenteEtiqueta.Ruta == "" {
+		if tamano > 0 && g.fuenteOT != nil {
+			face, err := g.crearFace(tamano)
+			if err != nil {
+				return err
+			}
+			g.fuenteEtiqueta = face
+		}
+		return nil
+	}
+
+	if tamano <= 0 {
+		tamano = g.config.TamanoFuente
+	}
+	f, face, err := cargarFuente(g.config.FuenteEtiqueta.Ruta, tamano)
+	if err != nil {
+		return err
+	}
+	g.etiquetaOT, g.fuenteEtiqueta = f, face
+	g.logger.Info("fuente de etiquetas cargada", "ruta", g.config.FuenteEtiqueta.Ruta, "tamano", tamano)
+	return nil
+}
+
+// cargarFuente lee el archivo de fuente de ruta y crea una cara de tamano.
+func cargarFuente(ruta string, tamano float64) (*opentype.Font, font.Face, error) {
+	f, err := leerFuente(ruta)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	face, err := nuevaFace(f, tamano)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, face, nil
 }
 
-type GeneradorTalonarios struct {
-	config         Config
-	numerosUsados  map[int]bool
-	imagenBase     image.Image
-	digitosFormato int
-}
+func leerFuente(ruta string) (*opentype.Font, error) {
+	if _, err := os.Stat(ruta); os.IsNotExist(err) {
+		return nil, fmt.Errorf("el archivo de fuente no existe: %s", ruta)
+	}
+
+	fontBytes, err := os.ReadFile(ruta)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo archivo de fuente: %v", err)
+	}
+
+	f, err := opentype.Parse(fontBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parseando fuente: %v", err)
+	}
+	return f, nil
+}
+
+// faceSecundaria devuelve la fuente de etiquetas con otro tamaño, o la misma
+// fuente si no se pide tamaño o no hay fuente personalizada que escalar.
+func (g *GeneradorTalonarios) faceSecundaria(tamano float64) (font.Face, error) {
+	if tamano <= 0 || g.etiquetaOT == nil {
+		return g.fuenteEtiqueta, nil
+	}
+	face, err := nuevaFace(g.etiquetaOT, tamano)
+	if err != nil {
+		return nil, err
+	}
+	return g.conRespaldo(face, tamano), nil
+}
+
+// tamanoEtiqueta es el tamaño de fuenteEtiqueta: el de FuenteEtiqueta, el
+// del número o, con basicfont, su alto fijo.
+func (g *GeneradorTalonarios) tamanoEtiqueta() float64 {
+	switch {
+	case g.etiquetaOT == nil:
+		return float64(basicfont.Face7x13.Height)
+	case g.config.FuenteEtiqueta.Tamano > 0:
+		return g.config.FuenteEtiqueta.Tamano
+	}
+	return g.config.TamanoFuente
+}
+
+// conRespaldo completa face con FuenteRespaldo al mismo tamaño; sin fuente de
+// respaldo devuelve face tal cual.
+func (g *GeneradorTalonarios) conRespaldo(face font.Face, tamano float64) font.Face {
+	if g.respaldoOT == nil {
+		return face
+	}
+	respaldo, err := nuevaFace(g.respaldoOT, tamano)
+	if err != nil {
+		g.logger.Warn("no se pudo crear la fuente de respaldo", "tamano", tamano, "error", err)
+		return face
+	}
+	return faceConRespaldo{principal: face, respaldo: respaldo}
+}
+
+// faceConRespaldo elige la fuente runa por runa: principal si tiene el glifo
+// y, si no, respaldo. Las métricas de línea son las de principal. Los
+// selectores de variación, como el U+FE0F que sigue a muchos emoji, se
+// omiten: el glifo sale monocromo de todas formas porque font.Drawer solo
+// dibuja máscaras de un color.
+type faceConRespaldo struct {
+	principal, respaldo font.Face
+}
+
+func (f faceConRespaldo) elegir(r rune) (font.Face, bool) {
+	if unicode.Is(unicode.Variation_Selector, r) {
+		return nil, false
+	}
+	if _, ok := f.principal.GlyphAdvance(r); !ok {
+		if _, ok := f.respaldo.GlyphAdvance(r); ok {
+			return f.respaldo, true
+		}
+	}
+	return f.principal, true
+}
+
+func (f faceConRespaldo) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	face, ok := f.elegir(r)
+	if !ok {
+		return image.Rectangle{}, nil, image.Point{}, 0, false
+	}
+	return face.Glyph(dot, r)
+}
+
+func (f faceConRespaldo) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	face, ok := f.elegir(r)
+	if !ok {
+		return fixed.Rectangle26_6{}, 0, false
+	}
+	return face.GlyphBounds(r)
+}
+
+func (f faceConRespaldo) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	face, ok := f.elegir(r)
+	if !ok {
+		return 0, false
+	}
+	return face.GlyphAdvance(r)
+}
+
+// Kern solo aplica entre runas de la misma fuente.
+func (f faceConRespaldo) Kern(r0, r1 rune) fixed.Int26_6 {
+	a, _ := f.elegir(r0)
+	b, _ := f.elegir(r1)
+	if a == nil || a != b {
+		return 0
+	}
+	return a.Kern(r0, r1)
+}
+
+func (f faceConRespaldo) Metrics() font.Metrics { return f.principal.Metrics() }
+
+func (f faceConRespaldo) Close() error { return nil }
+
+// crearFace crea una cara de la fuente personalizada ya cargada con otro tamaño.
+func (g *GeneradorTalonarios) crearFace(tamano float64) (font.Face, error) {
+	return nuevaFace(g.fuenteOT, tamano)
+}
+
+func nuevaFace(f *opentype.Font, tamano float64) (font.Face, error) {
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    tamano,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creando face de fuente: %v", err)
+	}
+	return face, nil
+}
+
+// ajustarTamanoFuente busca el mayor tamaño de fuente con el que el número más
+// ancho posible cabe en la fracción configurada de la boleta.
+func (g *GeneradorTalonarios) ajustarTamanoFuente() error {
+	fraccion := g.config.FraccionAjusteFuente
+	if fraccion <= 0 || fraccion > 1 {
+		fraccion = 0.8
+	}
+
+	anchoBoleta, altoBoleta, _ := g.dimensionesBoleta()
+	anchoMax := float64(anchoBoleta) * fraccion
+	altoMax := float64(altoBoleta) * fraccion
+	texto := g.textoMasAncho()
+
+	cabe := func(tamano float64) (font.Face, bool, error) {
+		face, err := g.crearFace(tamano)
+		if err != nil {
+			return nil, false, err
+		}
+		ancho := g.anchoNumero(face, texto)
+		alto := face.Metrics().Height.Round() * g.numerosPorBoleta()
+		return face, float64(ancho) <= anchoMax && float64(alto) <= altoMax, nil
+	}
+
+	bajo, alto := 1.0, 1000.0
+	mejor, ok, err := cabe(bajo)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("el número no cabe en una boleta de %dx%d ni con tamaño %.0f", anchoBoleta, altoBoleta, bajo)
+	}
+
+	for alto-bajo > 0.5 {
+		medio := (bajo + alto) / 2
+		face, ok, err := cabe(medio)
+		if err != nil {
+			return err
+		}
+		if ok {
+			bajo, mejor = medio, face
+		} else {
+			alto = medio
+		}
+	}
+
+	g.config.TamanoFuente = math.Floor(bajo*10) / 10
+	g.config.Fuente = mejor
+	g.logger.Info("tamaño de fuente ajustado", "tamano", g.config.TamanoFuente)
+	return nil
+}
+
+// avisarAltoFuente avisa si el número, con la fuente ya cargada, es más alto
+// que toda la boleta: con un TamanoFuente así cada celda sale con un glifo
+// gigante recortado. Se descuenta el achique por ancho de fuenteQueCabe, que
+// reduce el alto en la misma proporción.
+func (g *GeneradorTalonarios) avisarAltoFuente() {
+	metrics := g.config.Fuente.Metrics()
+	altoTexto := (metrics.Ascent + metrics.Descent).Ceil()
+	anchoBoleta, altoBoleta, _ := g.dimensionesBoleta()
+	anchoDisponible := anchoBoleta - 2*(g.config.AnchoLineas+g.config.GrosorContorno)
+	if anchoTexto := g.anchoNumero(g.config.Fuente, g.textoMasAncho()); !g.config.AvisarDesborde && anchoTexto > anchoDisponible {
+		altoTexto = altoTexto * anchoDisponible / anchoTexto
+	}
+	if disponible := altoBoleta - 2*g.config.AnchoLineas; altoTexto > disponible {
+		g.logger.Warn("el tamaño de fuente es más alto que la boleta", "tamano", g.config.TamanoFuente,
+			"alto_texto", altoTexto, "alto_disponible", disponible)
+	}
+}
+
+// InformeFuente es el resultado de VerificarFuente.
+type InformeFuente struct {
+	Fuente          string          // RutaFuente, o vacío para la fuente incorporada
+	Tamano          float64         // TamanoFuente, ya ajustado si AjustarFuenteAutomatico
+	Texto           string          // número formateado más ancho posible
+	Limites         image.Rectangle // caja de tinta del texto respecto de su línea base
+	AnchoTexto      int
+	AltoTexto       int // ascenso más descenso de la fuente
+	AnchoDisponible int // ancho de la boleta sin bordes ni contorno
+	AltoDisponible  int
+	Cabe            bool
+}
+
+// VerificarFuente vuelve a cargar la fuente configurada, sin el respaldo
+// silencioso del constructor, y mide el número más ancho posible para saber
+// si cabe en la boleta antes de dibujar nada.
+func (g *GeneradorTalonarios) VerificarFuente() (InformeFuente, error) {
+	copia := *g
+	if copia.config.RutaFuente != "" {
+		if err := copia.cargarFuentePersonalizada(); err != nil {
+			return InformeFuente{}, err
+		}
+	}
+	face := copia.config.Fuente
+
+	anchoBoleta, altoBoleta, _ := g.dimensionesBoleta()
+	texto := copia.textoMasAncho()
+	limites, _ := font.BoundString(face, texto)
+	metrics := face.Metrics()
+
+	informe := InformeFuente{
+		Fuente: g.config.RutaFuente,
+		Tamano: g.config.TamanoFuente,
+		Texto:  texto,
+		Limites: image.Rect(limites.Min.X.Floor(), limites.Min.Y.Floor(),
+			limites.Max.X.Ceil(), limites.Max.Y.Ceil()),
+		AnchoTexto:      g.anchoNumero(face, texto),
+		AltoTexto:       (metrics.Ascent + metrics.Descent).Ceil() + (g.numerosPorBoleta()-1)*metrics.Height.Round(),
+		AnchoDisponible: anchoBoleta - 2*(g.config.AnchoLineas+g.config.GrosorContorno),
+		AltoDisponible:  altoBoleta - 2*g.config.AnchoLineas,
+	}
+	informe.Cabe = informe.AnchoTexto <= informe.AnchoDisponible && informe.AltoTexto <= informe.AltoDisponible
+	return informe, nil
+}
+
+// textoMasAncho arma el número formateado más ancho posible con la fuente
+// actual: el formato del número máximo con todos sus dígitos reemplazados por
+// el dígito de mayor avance.
+func (g *GeneradorTalonarios) textoMasAncho() string {
+	simbolos := simbolosBase[:max(g.base, 10)]
+	digito := '0'
+	mayor := fixed.Int26_6(0)
+	for _, d := range simbolos {
+		if avance, ok := g.config.Fuente.GlyphAdvance(d); ok && avance > mayor {
+			digito, mayor = d, avance
+		}
+	}
+
+	texto := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(simbolos, r) {
+			return digito
+		}
+		return r
+	}, g.formatearNumero(g.config.NumeroMaximo))
+
+	ancho := g.anchoNumero(g.config.Fuente, texto)
+	for _, etiqueta := range g.config.MapaEtiquetas {
+		if a := g.anchoNumero(g.config.Fuente, etiqueta); a > ancho {
+			texto, ancho = etiqueta, a
+		}
+	}
+	return texto
+}
+
+// dimensionesBoleta calcula el tamaño de cada boleta y la cantidad de filas
+// de la cuadrícula a partir del lienzo y los márgenes.
+func (g *GeneradorTalonarios) dimensionesBoleta() (ancho, alto, filas int) {
+	filas = (g.config.BoletasPorPagina + g.config.BoletasPorFila - 1) / g.config.BoletasPorFila
+	ancho = (g.config.AnchoTalonario - g.config.MargenDerecho - g.config.MargenIzquierdo) / g.config.BoletasPorFila
+	alto = (g.config.AltoTalonario - g.config.MargenSuperior - g.config.MargenInferior) / filas
+	return ancho, alto, filas
+}
+
+// copias devuelve cuántas boletas comparten cada número sorteado.
+func (g *GeneradorTalonarios) copias() int {
+	return max(g.config.CopiasPorNumero, 1)
+}
+
+// ValidarConfig hace sobre config las mismas comprobaciones de números,
+// cuadrícula, márgenes y opciones que NewGeneradorTalonarios, sin cargar
+// fuentes ni imágenes ni crear carpetas, así que sirve para revisar una
+// configuración antes de usarla. Los errores de fuentes, imágenes y código de
+// barras solo aparecen al construir el generador.
+func ValidarConfig(config Config) error {
+	config, err := aplicarTema(config)
+	if err != nil {
+		return err
+	}
+	gen := &GeneradorTalonarios{config: config, logger: loggerOPorDefecto(config.Logger)}
+	if err := gen.resolverConfig(); err != nil {
+		return err
+	}
+	return gen.validarConfig()
+}
+
+// NumerosRequeridos devuelve cuántos números sortea config en total, contando
+// las copias, cada nivel de NumerosPorBoleta y, con CompartirNumeros, todas las
+// tandas, sin generar nada. El error indica que la cuenta no cabe en los
+// números disponibles del rango después de Paso, NumerosDisponibles,
+// ExcluirRepetidos y ExcluirSecuenciales. Como ValidarConfig, aplica Tema antes
+// de contar.
+func NumerosRequeridos(config Config) (int, error) {
+	config, err := aplicarTema(config)
+	if err != nil {
+		return 0, err
+	}
+	gen := &GeneradorTalonarios{config: config, logger: loggerOPorDefecto(config.Logger)}
+	if err := gen.resolverConfig(); err != nil {
+		return 0, err
+	}
+	if err := gen.validarCopias(); err != nil {
+		return 0, err
+	}
+	if config.BoletasPorPagina <= 0 || config.CantidadPaginas <= 0 {
+		return 0, errors.New("la cantidad de boletas y páginas debe ser mayor a 0")
+	}
+
+	necesarios := gen.numerosNecesarios()
+	if config.CompartirNumeros && len(config.Tandas) > 0 {
+		necesarios *= len(config.Tandas)
+	}
+	return necesarios * gen.numerosPorBoleta(), gen.comprobarDisponibles(necesarios)
+}
+
+// numerosNecesarios devuelve cuántos números distintos sortea cada nivel.
+func (g *GeneradorTalonarios) numerosNecesarios() int {
+	return g.config.BoletasPorPagina * g.config.CantidadPaginas / g.copias()
+}
+
+// comprobarDisponibles falla si necesarios supera los números disponibles.
+// Cada nivel de NumerosPorBoleta sortea aparte sobre el mismo rango, así que
+// todos necesitan la misma cantidad y basta con comprobar uno.
+func (g *GeneradorTalonarios) comprobarDisponibles(necesarios int) error {
+	if totalNumeros := g.contarDisponibles(necesarios); necesarios > totalNumeros {
+		return fmt.Errorf("no hay suficientes números: necesitas %d pero solo hay %d disponibles",
+			necesarios, totalNumeros)
+	}
+	return nil
+}
+
+func (g *GeneradorTalonarios) validarCopias() error {
+	if g.config.CopiasPorNumero < 0 {
+		return fmt.Errorf("CopiasPorNumero no puede ser negativo: %d", g.config.CopiasPorNumero)
+	}
+	if g.config.BoletasPorPagina%g.copias() != 0 {
+		return fmt.Errorf("BoletasPorPagina (%d) debe ser múltiplo de CopiasPorNumero (%d)",
+			g.config.BoletasPorPagina, g.copias())
+	}
+	return nil
+}
+
+func (g *GeneradorTalonarios) validarConfig() error {
+	if err := g.validarCopias(); err != nil {
+		return err
+	}
+	if err := g.comprobarDisponibles(g.numerosNecesarios()); err != nil {
+		return err
+	}
+
+	if g.config.BoletasPorPagina <= 0 || g.config.CantidadPaginas <= 0 {
+		return errors.New("la cantidad de boletas y páginas debe ser mayor a 0")
+	}
+
+	if g.config.BoletasPorFila <= 0 {
+		return errors.New("el número de boletas por fila debe ser mayor a 0")
+	}
+
+	if g.config.TalonariosPorHoja < 0 || g.config.ColumnasHoja < 0 || g.config.EspaciadoHoja < 0 {
+		return errors.New("los talonarios por hoja, columnas y espaciado deben ser positivos o cero")
+	}
+
+	if g.config.MargenSuperior < 0 || g.config.MargenInferior < 0 ||
+		g.config.MargenIzquierdo < 0 || g.config.MargenDerecho < 0 {
+		return errors.New("los márgenes deben ser positivos o cero")
+	}
+
+	for _, pct := range []float64{g.config.MargenSuperiorPct, g.config.MargenInferiorPct,
+		g.config.MargenIzquierdoPct, g.config.MargenDerechoPct} {
+		if pct < 0 || pct > 100 {
+			return fmt.Errorf("los márgenes en porcentaje deben estar entre 0 y 100: %.2f", pct)
+		}
+	}
+
+	switch strings.ToLower(g.config.FormatoSalida) {
+	case "", "png", "tiff", "tif":
+	default:
+		return fmt.Errorf("formato de salida inválido: %q (valores válidos: png, tiff)", g.config.FormatoSalida)
+	}
+
+	switch strings.ToLower(g.config.EspacioColor) {
+	case "", "rgb":
+	case "cmyk":
+		if f := strings.ToLower(g.config.FormatoSalida); f != "tiff" && f != "tif" {
+			return errors.New("EspacioColor cmyk necesita FormatoSalida tiff: PNG no admite CMYK")
+		}
+	default:
+		return fmt.Errorf("espacio de color inválido: %q (valores válidos: rgb, cmyk)", g.config.EspacioColor)
+	}
+
+	if _, ok := nivelesCompresionPNG[strings.ToLower(g.config.NivelCompresion)]; !ok {
+		return fmt.Errorf("nivel de compresión inválido: %q (valores válidos: defecto, ninguna, rapida, maxima)", g.config.NivelCompresion)
+	}
+
+	switch strings.ToLower(g.config.CompresionTIFF) {
+	case "", "ninguna", "deflate":
+	case "lzw":
+		return errors.New("la compresión LZW no está soportada por el codificador TIFF; use \"deflate\"")
+	default:
+		return fmt.Errorf("compresión TIFF inválida: %q (valores válidos: ninguna, deflate)", g.config.CompresionTIFF)
+	}
+
+	if err := validarDecoraciones(g.config.Decoraciones, "decoración"); err != nil {
+		return err
+	}
+	if err := validarDecoraciones(g.config.DecoracionesReverso, "decoración del reverso"); err != nil {
+		return err
+	}
+	if g.config.GenerarReverso && g.config.TalonariosPorHoja > 1 {
+		return errors.New("GenerarReverso no se admite con TalonariosPorHoja mayor a 1")
+	}
+	if g.config.UnArchivoPorBoleta {
+		switch {
+		case g.config.TalonariosPorHoja > 1:
+			return errors.New("UnArchivoPorBoleta no se admite con TalonariosPorHoja mayor a 1")
+		case g.config.GenerarReverso:
+			return errors.New("UnArchivoPorBoleta no se admite con GenerarReverso")
+		case g.copias() > 1:
+			return errors.New("UnArchivoPorBoleta no se admite con CopiasPorNumero mayor a 1: las copias tendrían el mismo nombre")
+		case g.config.CarpetaSalida == salidaEstandar:
+			return fmt.Errorf("UnArchivoPorBoleta no se admite con CarpetaSalida %q", salidaEstandar)
+		}
+	}
+	if g.config.ModoRollo {
+		switch {
+		case g.config.TalonariosPorHoja > 1:
+			return errors.New("ModoRollo no se admite con TalonariosPorHoja mayor a 1")
+		case g.config.UnArchivoPorBoleta:
+			return errors.New("ModoRollo no se admite con UnArchivoPorBoleta")
+		case g.config.GenerarReverso:
+			return errors.New("ModoRollo no se admite con GenerarReverso")
+		case g.extensionSalida() != ".png":
+			return fmt.Errorf("ModoRollo solo escribe PNG, no %q", g.config.FormatoSalida)
+		case g.config.CorreccionAspecto != 0 && g.config.CorreccionAspecto != 1:
+			return errors.New("ModoRollo no admite CorreccionAspecto")
+		}
+		// El alto va en IHDR y PNG no admite más de math.MaxInt32 filas; se
+		// compara dividiendo para que el producto no desborde
+		if _, alto := g.dimensionesRollo(1); alto > 0 && g.talonariosRollo() > math.MaxInt32/alto {
+			return fmt.Errorf("el rollo tendría %d talonarios de %d píxeles de alto y PNG admite como máximo %d filas",
+				g.talonariosRollo(), alto, math.MaxInt32)
+		}
+	}
+	if g.config.TamanoFuenteReverso < 0 {
+		return fmt.Errorf("TamanoFuenteReverso no puede ser negativo: %v", g.config.TamanoFuenteReverso)
+	}
+
+	if g.config.ImagenEncabezado != "" && g.config.MargenSuperior <= 0 {
+		return errors.New("ImagenEncabezado necesita un MargenSuperior mayor a 0")
+	}
+
+	if g.config.MostrarRango && g.config.MargenInferior <= 0 {
+		return errors.New("MostrarRango necesita un MargenInferior mayor a 0")
+	}
+
+	if g.config.XNumeroTalonario < 0 || g.config.YNumeroTalonario < 0 || g.config.TamanoFuenteTalonario < 0 {
+		return errors.New("la posición y el tamaño del número de talonario deben ser positivos o cero")
+	}
+
+	if g.base != 10 {
+		if g.config.DigitoControl {
+			return errors.New("DigitoControl solo se admite con BaseNumerica 10")
+		}
+		if g.config.SegundaRepresentacion != "" || g.config.TablaDigitos != "" {
+			return errors.New("la segunda representación solo se admite con BaseNumerica 10")
+		}
+	}
+
+	if g.config.TablaDigitos != "" {
+		if n := len([]rune(g.config.TablaDigitos)); n != 10 {
+			return fmt.Errorf("TablaDigitos debe tener 10 caracteres, tiene %d", n)
+		}
+	} else if _, ok := tablasDigitos[g.config.SegundaRepresentacion]; g.config.SegundaRepresentacion != "" && !ok {
+		return fmt.Errorf("segunda representación inválida: %q (valores válidos: arabe, persa, devanagari)", g.config.SegundaRepresentacion)
+	}
+
+	switch g.config.ModoSalida {
+	case "", "sobrescribir", "error-si-existe", "subcarpeta-timestamp":
+	default:
+		return fmt.Errorf("modo de salida inválido: %q (valores válidos: sobrescribir, error-si-existe, subcarpeta-timestamp)", g.config.ModoSalida)
+	}
+
+	if g.config.CarpetaSalida == salidaEstandar {
+		ultimo := g.config.CantidadPaginas
+		if g.config.SoloPrimera {
+			ultimo = 1
+		}
+		// Los talonarios anteriores a ComenzarDesde no se escriben; con
+		// TalonariosPorHoja se rehace la hoja que lo contiene
+		desde := max(g.config.ComenzarDesde, 1)
+		imagenes := ultimo - desde + 1
+		if n := g.config.TalonariosPorHoja; n > 1 {
+			imagenes = (ultimo+n-1)/n - (desde-1)/n
+		}
+		if imagenes > 1 && !g.config.ModoRollo {
+			return fmt.Errorf("CarpetaSalida %q escribe una sola imagen en la salida estándar, pero se escribirían %d; use CantidadPaginas 1, SoloPrimera o ComenzarDesde", salidaEstandar, imagenes)
+		}
+		if g.config.Manifiesto || g.config.GenerarReverso || g.config.ArchivoIndice != "" {
+			return fmt.Errorf("CarpetaSalida %q no admite Manifiesto, GenerarReverso ni ArchivoIndice, que escribirían otra imagen o archivo en la salida estándar", salidaEstandar)
+		}
+	}
+
+	switch g.config.AlternarPor {
+	case "", "fila", "columna":
+	default:
+		return fmt.Errorf("alternancia inválida: %q (valores válidos: fila, columna)", g.config.AlternarPor)
+	}
+
+	switch g.config.FormaBoleta {
+	case "", "rectangulo":
+	case "circulo", "elipse":
+		if g.config.NumeroEnEsquinas {
+			return fmt.Errorf("NumeroEnEsquinas no se admite con FormaBoleta %q", g.config.FormaBoleta)
+		}
+	default:
+		return fmt.Errorf("forma de boleta inválida: %q (valores válidos: rectangulo, circulo, elipse)", g.config.FormaBoleta)
+	}
+
+	switch g.config.OrdenCapas {
+	case "", "imagen-fondo", "imagen-frente":
+	default:
+		return fmt.Errorf("orden de capas inválido: %q (valores válidos: imagen-fondo, imagen-frente)", g.config.OrdenCapas)
+	}
+
+	switch g.config.EstiloLineasColumna {
+	case "", "continua", "discontinua":
+	default:
+		return fmt.Errorf("estilo de líneas de columna inválido: %q (valores válidos: continua, discontinua)", g.config.EstiloLineasColumna)
+	}
+
+	switch g.config.ImagenSoloEn {
+	case "", "todos", "primero", "ultimo":
+	default:
+		return fmt.Errorf("ImagenSoloEn inválido: %q (valores válidos: todos, primero, ultimo)", g.config.ImagenSoloEn)
+	}
+
+	for _, r := range g.config.IDCorrida {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return fmt.Errorf("IDCorrida solo admite letras, dígitos, '-', '_' y '.': %q", g.config.IDCorrida)
+		}
+	}
+
+	if g.config.EspaciadoLetras < 0 {
+		return fmt.Errorf("EspaciadoLetras no puede ser negativo: %d", g.config.EspaciadoLetras)
+	}
+
+	if g.config.NumerosPorBoleta < 0 {
+		return fmt.Errorf("NumerosPorBoleta no puede ser negativo: %d", g.config.NumerosPorBoleta)
+	}
+	if g.config.Paso < 0 {
+		return fmt.Errorf("Paso no puede ser negativo: %d", g.config.Paso)
+	}
+	if b := g.config.BloqueReservado; b != [2]int{} {
+		if b[0] > b[1] {
+			return fmt.Errorf("BloqueReservado %v empieza después de terminar", b)
+		}
+		if b[0] < g.config.NumeroMinimo || b[1] > g.config.NumeroMaximo {
+			return fmt.Errorf("BloqueReservado %v está fuera del rango %d-%d", b, g.config.NumeroMinimo, g.config.NumeroMaximo)
+		}
+	}
+	switch g.config.ParidadNumeros {
+	case "", "todos", "pares", "impares":
+	default:
+		return fmt.Errorf("paridad de números inválida: %q (valores válidos: todos, pares, impares)", g.config.ParidadNumeros)
+	}
+	if err := g.validarPredefinidos(); err != nil {
+		return err
+	}
+
+	if g.config.NumerosPorBoleta > 1 {
+		if g.config.NumeroEnEsquinas {
+			return errors.New("NumeroEnEsquinas no se admite con NumerosPorBoleta mayor a 1")
+		}
+		if g.config.SegundaRepresentacion != "" || g.config.TablaDigitos != "" {
+			return errors.New("la segunda representación no se admite con NumerosPorBoleta mayor a 1")
+		}
+	}
+
+	if g.config.AnchoMiniatura < 0 {
+		return fmt.Errorf("AnchoMiniatura no puede ser negativo: %d", g.config.AnchoMiniatura)
+	}
+
+	if g.config.ReintentosEscritura < 0 {
+		return fmt.Errorf("ReintentosEscritura no puede ser negativo: %d", g.config.ReintentosEscritura)
+	}
+
+	if g.config.CorreccionAspecto < 0 {
+		return fmt.Errorf("la corrección de aspecto no puede ser negativa: %.2f", g.config.CorreccionAspecto)
+	}
+
+	if g.config.GrosorContorno < 0 {
+		return fmt.Errorf("el grosor del contorno no puede ser negativo: %d", g.config.GrosorContorno)
+	}
+
+	if g.config.PaddingInterno < 0 {
+		return fmt.Errorf("PaddingInterno no puede ser negativo: %d", g.config.PaddingInterno)
+	}
+
+	if g.config.Precio < 0 {
+		return fmt.Errorf("el precio no puede ser negativo: %.2f", g.config.Precio)
+	}
+
+	if g.config.OpacidadImagenBase < 0 || g.config.OpacidadImagenBase > 1 {
+		return fmt.Errorf("la opacidad de la imagen base debe estar entre 0 y 1: %.2f", g.config.OpacidadImagenBase)
+	}
+
+	if g.config.OpacidadTextura < 0 || g.config.OpacidadTextura > 1 {
+		return fmt.Errorf("la opacidad de la textura debe estar entre 0 y 1: %.2f", g.config.OpacidadTextura)
+	}
+
+	if g.config.DigitosFormato < 0 {
+		return fmt.Errorf("DigitosFormato no puede ser negativo: %d", g.config.DigitosFormato)
+	}
+	if n := len(strconv.FormatInt(int64(g.config.NumeroMaximo), g.base)); g.config.DigitosFormato > 0 && n > g.config.DigitosFormato {
+		return fmt.Errorf("NumeroMaximo %d tiene %d dígitos y no cabe en DigitosFormato %d",
+			g.config.NumeroMaximo, n, g.config.DigitosFormato)
+	}
+
+	if g.config.ComenzarDesde < 0 || g.config.ComenzarDesde > g.config.CantidadPaginas {
+		return fmt.Errorf("ComenzarDesde debe estar entre 0 y %d: %d", g.config.CantidadPaginas, g.config.ComenzarDesde)
+	}
+
+	switch g.config.AlineacionVertical {
+	case "", "arriba", "centro", "abajo":
+	default:
+		return fmt.Errorf("alineación vertical inválida: %q (valores válidos: arriba, centro, abajo)", g.config.AlineacionVertical)
+	}
+
+	switch g.config.EstrategiaNumeros {
+	case "", "rechazo", "permutacion":
+	default:
+		return fmt.Errorf("estrategia de números inválida: %q (valores válidos: rechazo, permutacion)", g.config.EstrategiaNumeros)
+	}
+	if g.config.EstrategiaNumeros == "permutacion" && g.tamanoRango() > maxRangoDenso {
+		return fmt.Errorf("EstrategiaNumeros permutacion admite hasta %d números en el rango y %d-%d tiene %d",
+			maxRangoDenso, g.config.NumeroMinimo, g.config.NumeroMaximo, g.tamanoRango())
+	}
+
+	switch g.config.OrientacionBoletas {
+	case OrientacionIzquierda, OrientacionCentro, OrientacionDerecha:
+	default:
+		return fmt.Errorf("orientación de boletas inválida: %d (valores válidos: 0 izquierda, 1 centro, 2 derecha)",
+			g.config.OrientacionBoletas)
+	}
+
+	switch g.config.RotarSalida {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("rotación de salida inválida: %d (valores válidos: 0, 90, 180, 270)", g.config.RotarSalida)
+	}
+
+	if dx := g.config.DesplazamientoGridX; g.config.MargenIzquierdo+dx < 0 || g.config.MargenDerecho-dx < 0 {
+		return fmt.Errorf("DesplazamientoGridX %d saca la cuadrícula del talonario (márgenes %d y %d)",
+			dx, g.config.MargenIzquierdo, g.config.MargenDerecho)
+	}
+	if dy := g.config.DesplazamientoGridY; g.config.MargenSuperior+dy < 0 || g.config.MargenInferior-dy < 0 {
+		return fmt.Errorf("DesplazamientoGridY %d saca la cuadrícula del talonario (márgenes %d y %d)",
+			dy, g.config.MargenSuperior, g.config.MargenInferior)
+	}
+
+	if g.config.Supersampling < 0 || g.config.Supersampling > 4 {
+		return fmt.Errorf("Supersampling inválido: %d (valores válidos: 0 a 4)", g.config.Supersampling)
+	}
+
+	return nil
+}
+
+func (g *GeneradorTalonarios) cargarImagenBase() error {
+	var err error
+	if g.imagenBase, err = g.cargarImagen(g.config.ImagenBase); err != nil {
+		return err
+	}
+	return g.revisarImagenBase()
+}
+
+// Límites de revisarImagenBase: la imagen debe medir al menos esta fracción
+// del talonario en cada lado y su proporción no debe alejarse más que esta
+// fracción de la del lienzo.
+const (
+	escalaMinimaImagen = 0.5
+	toleranciaAspecto  = 0.1
+)
+
+// revisarImagenBase avisa si la imagen base, que se estira a todo el
+// talonario, es mucho menor que el lienzo o de otra proporción; con
+// ImagenEstricta es un error.
+func (g *GeneradorTalonarios) revisarImagenBase() error {
+	limites := g.imagenBase.Bounds()
+	ancho, alto := float64(g.config.AnchoTalonario), float64(g.config.AltoTalonario)
+
+	var problema string
+	switch {
+	case float64(limites.Dx()) < escalaMinimaImagen*ancho || float64(limites.Dy()) < escalaMinimaImagen*alto:
+		problema = "la imagen base es mucho menor que el talonario"
+	case math.Abs(float64(limites.Dx())/float64(limites.Dy())/(ancho/alto)-1) > toleranciaAspecto:
+		problema = "la imagen base tiene otra proporción que el talonario y se deformará"
+	default:
+		return nil
+	}
+
+	if g.config.ImagenEstricta {
+		return fmt.Errorf("%s: mide %dx%d y el talonario %dx%d", problema,
+			limites.Dx(), limites.Dy(), g.config.AnchoTalonario, g.config.AltoTalonario)
+	}
+	g.logger.Warn(problema, "imagen", fmt.Sprintf("%dx%d", limites.Dx(), limites.Dy()),
+		"talonario", fmt.Sprintf("%dx%d", g.config.AnchoTalonario, g.config.AltoTalonario))
+	return nil
+}
+
+// cargarImagen decodifica una imagen según su extensión y, salvo con
+// IgnorarEXIF, aplica la orientación EXIF de los JPEG. La ruta se resuelve con
+// leerRecurso.
+func (g *GeneradorTalonarios) cargarImagen(ruta string) (image.Image, error) {
+	datos, nombre, err := g.leerRecurso(ruta)
+	if err != nil {
+		return nil, err
+	}
+	file := bytes.NewReader(datos)
+
+	var img image.Image
+	ext := strings.ToLower(path.Ext(nombre))
+	switch ext {
+	case ".jpg", ".jpeg":
+		img, err = jpeg.Decode(file)
+		if err == nil && !g.config.IgnorarEXIF {
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			img = orientarImagen(img, leerOrientacionEXIF(file))
+		}
+	case ".png":
+		img, err = png.Decode(file)
+	default:
+		img, _, err = image.Decode(file)
+	}
+
+	return img, err
+}
+
+// prefijoEmbebido marca las rutas que se leen de Config.Recursos.
+const prefijoEmbebido = "embed:"
+
+// maxBytesRemoto limita el tamaño de una imagen descargada por URL.
+const maxBytesRemoto = 64 << 20
+
+// clienteRemoto descarga las imágenes dadas por URL.
+var clienteRemoto = &http.Client{Timeout: 30 * time.Second}
+
+// leerRecurso lee el contenido de ruta, que puede ser un archivo local, una
+// entrada "embed:<ruta>" de Config.Recursos o una URL http(s)://. También
+// devuelve el nombre con barras del que sale la extensión.
+func (g *GeneradorTalonarios) leerRecurso(ruta string) (datos []byte, nombre string, err error) {
+	switch {
+	case strings.HasPrefix(ruta, prefijoEmbebido):
+		nombre = strings.TrimPrefix(ruta, prefijoEmbebido)
+		if g.config.Recursos == nil {
+			return nil, "", fmt.Errorf("%s es un recurso embebido pero Config.Recursos no está definido", ruta)
+		}
+		if datos, err = fs.ReadFile(g.config.Recursos, nombre); err != nil {
+			return nil, "", fmt.Errorf("error leyendo el recurso embebido %s: %v", nombre, err)
+		}
+		return datos, nombre, nil
+
+	case strings.HasPrefix(ruta, "http://") || strings.HasPrefix(ruta, "https://"):
+		u, err := url.Parse(ruta)
+		if err != nil {
+			return nil, "", fmt.Errorf("URL inválida %s: %v", ruta, err)
+		}
+		resp, err := clienteRemoto.Get(ruta)
+		if err != nil {
+			return nil, "", fmt.Errorf("error descargando %s: %v", ruta, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("error descargando %s: estado HTTP %s", ruta, resp.Status)
+		}
+		if datos, err = io.ReadAll(io.LimitReader(resp.Body, maxBytesRemoto+1)); err != nil {
+			return nil, "", fmt.Errorf("error descargando %s: %v", ruta, err)
+		}
+		if len(datos) > maxBytesRemoto {
+			return nil, "", fmt.Errorf("la imagen de %s supera %d MB", ruta, maxBytesRemoto>>20)
+		}
+		return datos, u.Path, nil
+	}
+
+	datos, err = os.ReadFile(ruta)
+	return datos, filepath.ToSlash(ruta), err
+}
+
+// leerOrientacionEXIF devuelve la etiqueta de orientación EXIF (1-8) o 1 si no existe.
+func leerOrientacionEXIF(r io.Reader) int {
+	x, err := exif.Decode(r)
+	if err != nil {
+		return 1
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+	orientacion, err := tag.Int(0)
+	if err != nil {
+		return 1
+	}
+	return orientacion
+}
+
+// orientarImagen aplica la transformación indicada por una orientación EXIF (1-8).
+func orientarImagen(src image.Image, orientacion int) image.Image {
+	if orientacion < 2 || orientacion > 8 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	var dst *image.RGBA
+	if orientacion >= 5 {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientacion {
+			case 2: // espejo horizontal
+				dx, dy = w-1-x, y
+			case 3: // 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // espejo vertical
+				dx, dy = x, h-1-y
+			case 5: // transpuesta
+				dx, dy = y, x
+			case 6: // 90° horario
+				dx, dy = h-1-y, x
+			case 7: // transversa
+				dx, dy = h-1-y, w-1-x
+			case 8: // 90° antihorario
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return dst
+}
+
+// contarDisponibles devuelve cuántos números del rango, o de
+// NumerosDisponibles si hay, pasan los filtros, hasta tope: con filtros hay que
+// recorrer el rango y con rangos de miles de millones no terminaría nunca.
+func (g *GeneradorTalonarios) contarDisponibles(tope int) int {
+	totalNumeros := g.numerosEnRango()
+	if g.permitidos == nil && g.config.BloqueReservado == [2]int{} && !g.filtraParidad() &&
+		!g.config.ExcluirRepetidos && !g.config.ExcluirSecuenciales {
+		return min(totalNumeros, tope)
+	}
+
+	disponibles := 0
+	for numero := range g.candidatos() {
+		if disponibles == tope {
+			break
+		}
+		if !g.numeroExcluido(numero) {
+			disponibles++
+		}
+	}
+	return disponibles
+}
+
+// ampliarDisponibles vuelve a contar con el doble de tope si disponibles es
+// una cota, e indica si aparecieron más números.
+func (g *GeneradorTalonarios) ampliarDisponibles() bool {
+	if !g.disponiblesCota {
+		return false
+	}
+	antes := g.disponibles
+	tope := antes * 2
+	if antes > math.MaxInt/2 {
+		tope = math.MaxInt
+	}
+	g.disponibles = g.contarDisponibles(tope)
+	g.disponiblesCota = g.disponibles == tope
+	return g.disponibles > antes
+}
+
+// numeroExcluido aplica los filtros de dígitos sobre el número con el mismo
+// relleno de ceros con que se imprime. Con NumerosDisponibles, los que no
+// están en la lista también quedan excluidos, con Paso los que no caen en
+// uno de sus pasos, los de BloqueReservado y los de la otra paridad.
+func (g *GeneradorTalonarios) numeroExcluido(numero int) bool {
+	if g.permitidos != nil && !g.permitidos[numero] {
+		return true
+	}
+	if (numero-g.config.NumeroMinimo)%g.paso() != 0 {
+		return true
+	}
+	if b := g.config.BloqueReservado; b != [2]int{} && numero >= b[0] && numero <= b[1] {
+		return true
+	}
+	if (g.config.ParidadNumeros == "pares" && numero%2 != 0) || (g.config.ParidadNumeros == "impares" && numero%2 == 0) {
+		return true
+	}
+	if !g.config.ExcluirRepetidos && !g.config.ExcluirSecuenciales {
+		return false
+	}
+
+	digitos := g.digitosNumero(numero)
+	return (g.config.ExcluirRepetidos && DigitosRepetidos(digitos)) ||
+		(g.config.ExcluirSecuenciales && DigitosSecuenciales(digitos))
+}
+
+// filtraParidad indica si ParidadNumeros deja fuera la mitad de los números.
+func (g *GeneradorTalonarios) filtraParidad() bool {
+	return g.config.ParidadNumeros == "pares" || g.config.ParidadNumeros == "impares"
+}
+
+// DigitosRepetidos indica si la cadena tiene dos o más dígitos y todos son
+// iguales, como "1111" o "00".
+func DigitosRepetidos(digitos string) bool {
+	if len(digitos) < 2 {
+		return false
+	}
+	for i := 1; i < len(digitos); i++ {
+		if digitos[i] != digitos[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// DigitosSecuenciales indica si la cadena tiene tres o más dígitos que suben o
+// bajan de uno en uno, como "1234", "0123" o "4321".
+func DigitosSecuenciales(digitos string) bool {
+	if len(digitos) < 3 {
+		return false
+	}
+	paso := int(digitos[1]) - int(digitos[0])
+	if paso != 1 && paso != -1 {
+		return false
+	}
+	for i := 2; i < len(digitos); i++ {
+		if int(digitos[i])-int(digitos[i-1]) != paso {
+			return false
+		}
+	}
+	return true
+}
+
+// paso normaliza Paso: 0 equivale a 1.
+func (g *GeneradorTalonarios) paso() int {
+	return max(g.config.Paso, 1)
+}
+
+// numerosEnRango cuenta los números de NumeroMinimo a NumeroMaximo de Paso en
+// Paso, antes de los filtros.
+func (g *GeneradorTalonarios) numerosEnRango() int {
+	return (g.config.NumeroMaximo-g.config.NumeroMinimo)/g.paso() + 1
+}
+
+// tamanoRango cuenta los números de NumeroMinimo a NumeroMaximo sin Paso ni
+// filtros. Es uint64 porque la resta no cabe en int con rangos extremos.
+func (g *GeneradorTalonarios) tamanoRango() uint64 {
+	return uint64(g.config.NumeroMaximo) - uint64(g.config.NumeroMinimo) + 1
+}
+
+// elegirEstrategia resuelve EstrategiaNumeros; si está vacía usa la
+// permutación cuando el sorteo pide al menos fraccionDensa de los disponibles
+// y el rango no pasa de maxRangoDenso.
+func (g *GeneradorTalonarios) elegirEstrategia() string {
+	if g.config.EstrategiaNumeros != "" {
+		return g.config.EstrategiaNumeros
+	}
+	if g.tamanoRango() <= maxRangoDenso && float64(g.numerosNecesarios()) >= fraccionDensa*float64(g.disponibles) {
+		return "permutacion"
+	}
+	return "rechazo"
+}
+
+// nuevoRegistro crea un registro vacío de números usados acorde a la estrategia.
+func (g *GeneradorTalonarios) nuevoRegistro() *registroNumeros {
+	return nuevoRegistroNumeros(g.config.NumeroMinimo, g.config.NumeroMaximo, g.estrategia == "permutacion")
+}
+
+// numerosPorBoleta normaliza NumerosPorBoleta: 0 equivale a 1.
+func (g *GeneradorTalonarios) numerosPorBoleta() int {
+	return max(g.config.NumerosPorBoleta, 1)
+}
+
+// nuevosNiveles crea los sorteos vacíos de los niveles adicionales. Cada nivel
+// recorre el mismo rango con su propio registro de usados: un número no se
+// repite dentro de su nivel, pero sí puede salir en niveles distintos.
+func (g *GeneradorTalonarios) nuevosNiveles() []nivelNumeros {
+	niveles := make([]nivelNumeros, g.numerosPorBoleta()-1)
+	for i := range niveles {
+		niveles[i].usados = g.nuevoRegistro()
+	}
+	return niveles
+}
+
+func (g *GeneradorTalonarios) generarNumeroAleatorio() (int, error) {
+	if len(g.config.NumerosPredefinidos) > 0 {
+		return g.siguientePredefinido()
+	}
+	return g.sortearEn(g.numerosUsados, &g.pendientes)
+}
+
+// intentosDistribucion es cuántos candidatos se prueban por boleta con
+// DistribuirUltimoDigito antes de aceptar el último sorteado.
+const intentosDistribucion = 20
+
+// sortearDistribuido sortea como generarNumeroAleatorio pero prefiere un
+// número cuyo último dígito sea de los menos repetidos en ultimos, la cuenta
+// por dígito del talonario en curso. Los candidatos descartados vuelven al
+// sorteo. Si en intentosDistribucion candidatos ninguno sirve, o se agotan los
+// números, se acepta el último sorteado.
+func (g *GeneradorTalonarios) sortearDistribuido(ultimos *[10]int) (int, error) {
+	menor := slices.Min(ultimos[:])
+	var descartados []int
+	defer func() {
+		for _, numero := range descartados {
+			g.devolverNumero(numero)
+		}
+	}()
+
+	for intento := 1; ; intento++ {
+		numero, err := g.generarNumeroAleatorio()
+		if err != nil {
+			if len(descartados) == 0 {
+				return 0, err
+			}
+			numero = descartados[len(descartados)-1]
+			descartados = descartados[:len(descartados)-1]
+		} else if ultimos[abs(numero)%10] != menor && intento < intentosDistribucion {
+			descartados = append(descartados, numero)
+			continue
+		}
+		ultimos[abs(numero)%10]++
+		return numero, nil
+	}
+}
+
+// devolverNumero deshace el sorteo de numero: lo quita de los usados y, con
+// la estrategia "permutacion", lo reinserta en una posición al azar de los
+// pendientes.
+func (g *GeneradorTalonarios) devolverNumero(numero int) {
+	g.numerosUsados.desmarcar(numero)
+	if g.estrategia == "permutacion" {
+		g.pendientes = append(g.pendientes, numero)
+		i, j := len(g.pendientes)-1, g.rng.Intn(len(g.pendientes))
+		g.pendientes[i], g.pendientes[j] = g.pendientes[j], g.pendientes[i]
+	}
+}
+
+// siguientePredefinido entrega los NumerosPredefinidos en orden; los ya
+// entregados están marcados en numerosUsados, así que su cantidad es el
+// índice del siguiente.
+func (g *GeneradorTalonarios) siguientePredefinido() (int, error) {
+	i := g.numerosUsados.cantidad
+	if i >= len(g.config.NumerosPredefinidos) {
+		return 0, ErrNumerosAgotados
+	}
+	numero := g.config.NumerosPredefinidos[i]
+	g.numerosUsados.marcar(numero)
+	return numero, nil
+}
+
+// sortearEn sortea un número que no esté en usados y lo marca; pendientes es
+// la permutación de ese mismo sorteo con la estrategia "permutacion".
+func (g *GeneradorTalonarios) sortearEn(usados *registroNumeros, pendientes *[]int) (int, error) {
+	totalNumeros := g.numerosEnRango()
+	for usados.cantidad >= g.disponibles {
+		if !g.ampliarDisponibles() {
+			return 0, ErrNumerosAgotados
+		}
+	}
+
+	if g.estrategia == "permutacion" {
+		return g.siguientePermutado(usados, pendientes)
+	}
+
+	for {
+		numero := g.rng.Intn(totalNumeros)*g.paso() + g.config.NumeroMinimo
+		if g.permitidos != nil {
+			numero = g.config.NumerosDisponibles[g.rng.Intn(len(g.config.NumerosDisponibles))]
+		}
+		if !usados.contiene(numero) && !g.numeroExcluido(numero) {
+			usados.marcar(numero)
+			return numero, nil
+		}
+	}
+}
+
+// candidatos recorre NumerosDisponibles en orden o, si no hay, todo el rango
+// de Paso en Paso.
+func (g *GeneradorTalonarios) candidatos() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		if g.permitidos != nil {
+			for _, numero := range g.config.NumerosDisponibles {
+				if !yield(numero) {
+					return
+				}
+			}
+			return
+		}
+		for numero := g.config.NumeroMinimo; numero <= g.config.NumeroMaximo; numero += g.paso() {
+			if !yield(numero) {
+				return
+			}
+		}
+	}
+}
+
+// siguientePermutado entrega los números de una permutación de todos los
+// disponibles. La permutación se arma en el primer sorteo con Fisher-Yates:
+// para i desde el final hasta 1 se intercambia la posición i con una posición
+// j elegida con g.rng.Intn(i+1), y luego se toman los números desde el
+// final. Con la misma Semilla el orden es siempre el mismo.
+func (g *GeneradorTalonarios) siguientePermutado(usados *registroNumeros, pendientes *[]int) (int, error) {
+	if *pendientes == nil {
+		p := make([]int, 0, g.disponibles-usados.cantidad)
+		for numero := range g.candidatos() {
+			if !usados.contiene(numero) && !g.numeroExcluido(numero) {
+				p = append(p, numero)
+			}
+		}
+		for i := len(p) - 1; i > 0; i-- {
+			j := g.rng.Intn(i + 1)
+			p[i], p[j] = p[j], p[i]
+		}
+		*pendientes = p
+	}
+
+	// Los números usados desde que se armó la permutación (p. ej. por otra
+	// tanda con CompartirNumeros) se descartan.
+	for len(*pendientes) > 0 {
+		numero := (*pendientes)[len(*pendientes)-1]
+		*pendientes = (*pendientes)[:len(*pendientes)-1]
+		if !usados.contiene(numero) {
+			usados.marcar(numero)
+			return numero, nil
+		}
+	}
+	return 0, ErrNumerosAgotados
+}
+
+func (g *GeneradorTalonarios) formatearNumero(numero int) string {
+	if etiqueta, ok := g.config.MapaEtiquetas[numero]; ok {
+		return etiqueta
+	}
+
+	digitos := g.digitosNumero(numero)
+	texto := agruparMiles(digitos, g.config.SeparadorMiles)
+	if g.config.DigitoControl {
+		// El signo de los negativos no entra en la cuenta
+		texto += "-" + strconv.Itoa(digitoLuhn(strings.TrimPrefix(digitos, "-")))
+	}
+	return g.config.SeriePrefijo + texto
+}
+
+// simbolosBase son los dígitos de las bases hasta 36, en el orden de
+// strconv.FormatInt pero en mayúsculas.
+const simbolosBase = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// digitosNumero escribe numero en la base configurada, con ceros a la
+// izquierda hasta digitosFormato.
+func (g *GeneradorTalonarios) digitosNumero(numero int) string {
+	if g.base == 10 {
+		return fmt.Sprintf("%0*d", g.digitosFormato, numero)
+	}
+	digitos := strings.ToUpper(strconv.FormatInt(int64(abs(numero)), g.base))
+	if relleno := g.digitosFormato - len(digitos); relleno > 0 {
+		digitos = strings.Repeat("0", relleno) + digitos
+	}
+	if numero < 0 {
+		digitos = "-" + digitos
+	}
+	return digitos
+}
+
+// formatearPrecio antepone la moneda y agrupa los miles con SeparadorMiles
+// (punto si no se define); los centavos solo se muestran si existen.
+//
+// Con Locale el formato sale de golang.org/x/text: separadores del idioma,
+// los decimales propios de la moneda y el símbolo de la moneda de la región si
+// no se define Moneda.
+func (g *GeneradorTalonarios) formatearPrecio(precio float64) string {
+	if g.impresora != nil {
+		escala, _ := currency.Standard.Rounding(g.unidadMoneda)
+		importe := g.impresora.Sprint(number.Decimal(precio, number.Scale(escala)))
+		simbolo := g.config.Moneda
+		if simbolo == "" {
+			simbolo = g.impresora.Sprint(currency.Symbol(g.unidadMoneda))
+		}
+		if g.monedaDespues {
+			return importe + " " + simbolo
+		}
+		return simbolo + importe
+	}
+
+	sepMiles, sepDecimal := g.config.SeparadorMiles, ","
+	if sepMiles == "" {
+		sepMiles = "."
+	}
+	if sepMiles == "," {
+		sepDecimal = "."
+	}
+
+	centavos := int64(math.Round(precio * 100))
+	texto := agruparMiles(strconv.FormatInt(centavos/100, 10), sepMiles)
+	if resto := centavos % 100; resto != 0 {
+		texto += fmt.Sprintf("%s%02d", sepDecimal, resto)
+	}
+	return g.config.Moneda + texto
+}
+
+// prepararLocale interpreta Locale; si no es un idioma conocido se avisa y se
+// conserva el formato propio.
+func (g *GeneradorTalonarios) prepararLocale() {
+	tag, err := language.Parse(g.config.Locale)
+	if err != nil {
+		g.logger.Warn("locale desconocido, se usa el formato propio", "locale", g.config.Locale, "error", err)
+		return
+	}
+
+	g.impresora = message.NewPrinter(tag)
+	g.unidadMoneda, _ = currency.FromTag(tag)
+	base, _ := tag.Base()
+	region, _ := tag.Region()
+	g.monedaDespues = localesMonedaDespues[base.String()] || localesMonedaDespues[base.String()+"-"+region.String()]
+}
+
+// agruparMiles inserta sep cada tres dígitos contando desde la derecha. El
+// signo de los negativos queda adelante y no cuenta como dígito.
+func agruparMiles(digitos, sep string) string {
+	if signo, resto, ok := strings.Cut(digitos, "-"); ok && signo == "" {
+		return "-" + agruparMiles(resto, sep)
+	}
+	if sep == "" || len(digitos) <= 3 {
+		return digitos
+	}
+
+	var b strings.Builder
+	primero := len(digitos) % 3
+	if primero > 0 {
+		b.WriteString(digitos[:primero])
+	}
+	for i := primero; i < len(digitos); i += 3 {
+		if b.Len() > 0 {
+			b.WriteString(sep)
+		}
+		b.WriteString(digitos[i : i+3])
+	}
+	return b.String()
+}
+
+// digitoLuhn calcula el dígito verificador Luhn (mod 10) de una cadena de
+// dígitos: desde la derecha se duplica uno de cada dos dígitos (restando 9 si
+// pasa de 9), se suma todo y el verificador es lo que falta para llegar al
+// siguiente múltiplo de 10. Detecta cualquier error de un solo dígito y la
+// mayoría de transposiciones de dígitos adyacentes.
+func digitoLuhn(digitos string) int {
+	suma := 0
+	duplicar := true
+	for i := len(digitos) - 1; i >= 0; i-- {
+		d := int(digitos[i] - '0')
+		if duplicar {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		suma += d
+		duplicar = !duplicar
+	}
+	return (10 - suma%10) % 10
+}
+
+// ValidarNumero comprueba el dígito verificador de un número formateado con
+// DigitoControl (p. ej. "0042-2", "A-0042-2" o "-0042-2"). Cualquier prefijo
+// no numérico antes de los dígitos se ignora, así como el signo y los
+// separadores de miles.
+func ValidarNumero(formateado string) bool {
+	sep := strings.LastIndex(formateado, "-")
+	if sep < 0 || sep == len(formateado)-1 {
+		return false
+	}
+
+	control, err := strconv.Atoi(formateado[sep+1:])
+	if err != nil || control < 0 || control > 9 {
+		return false
+	}
+
+	var digitos []byte
+	for i := sep - 1; i >= 0; i-- {
+		c := formateado[i]
+		if c >= '0' && c <= '9' {
+			digitos = append([]byte{c}, digitos...)
+		} else if !strings.ContainsRune(".,' _", rune(c)) {
+			break
+		}
+	}
+	if len(digitos) == 0 {
+		return false
+	}
+
+	return digitoLuhn(string(digitos)) == control
+}
+
+// crearTalonario sortea los números de un talonario. Con CopiasPorNumero = k
+// cada número sorteado ocupa k boletas consecutivas (0..k-1, k..2k-1, ...),
+// así que las copias siempre quedan juntas en el mismo talonario.
+func (g *GeneradorTalonarios) crearTalonario(id int) (Talonario, error) {
+	talonario := Talonario{
+		ID:      id,
+		Boletas: make([]Boleta, g.config.BoletasPorPagina),
+	}
+
+	copias := g.copias()
+	var ultimos [10]int
+	for i := 0; i < g.config.BoletasPorPagina; i += copias {
+		var numero int
+		var err error
+		if g.config.DistribuirUltimoDigito {
+			numero, err = g.sortearDistribuido(&ultimos)
+		} else {
+			numero, err = g.generarNumeroAleatorio()
+		}
+		if err != nil {
+			return Talonario{}, fmt.Errorf("error asignando números al talonario %d: %w", id, err)
+		}
+		boleta := Boleta{
+			Numero:     numero,
+			Formateado: g.formatearNumero(numero),
+		}
+		for k := range g.niveles {
+			adicional, err := g.sortearEn(g.niveles[k].usados, &g.niveles[k].pendientes)
+			if err != nil {
+				return Talonario{}, fmt.Errorf("error asignando números del nivel %d al talonario %d: %w", k+2, id, err)
+			}
+			boleta.Adicionales = append(boleta.Adicionales, Boleta{Numero: adicional, Formateado: g.formatearNumero(adicional)})
+		}
+		for j := range copias {
+			talonario.Boletas[i+j] = boleta
+		}
+	}
+
+	if g.config.OrdenarDentroTalonario {
+		slices.SortFunc(talonario.Boletas, func(a, b Boleta) int {
+			return a.Numero - b.Numero
+		})
+	}
+
+	talonario.Suma = sumaNumeros(talonario.Boletas)
+	talonario.Paridad = paridad(talonario.Suma)
+	return talonario, nil
+}
+
+func (g *GeneradorTalonarios) crearImagenTalonario(talonario Talonario) *image.RGBA {
+	if g.supermuestreo != nil {
+		return reducirImagen(g.supermuestreo.crearImagenTalonario(talonario), g.config.Supersampling)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, g.config.AnchoTalonario, g.config.AltoTalonario))
+
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0, 0, 0, 255}}, image.Point{}, draw.Src)
+
+	imagenAlFrente := g.config.OrdenCapas == "imagen-frente"
+	conImagen := g.imagenBase != nil && g.llevaImagenBase(talonario.ID)
+	if conImagen && !imagenAlFrente {
+		g.dibujarImagenBase(img, image.Point{})
+	}
+
+	if g.textura != nil {
+		g.dibujarTextura(img)
+	}
+
+	if g.encabezado != nil {
+		g.dibujarEncabezado(img)
+	}
+
+	origenX, origenY, anchoGrid, bordesX, bordesY := g.cuadricula()
+
+	g.dibujarLineaSuperior(img, origenX, origenY, anchoGrid, g.config.ColorLinea)
+
+	for i, boleta := range talonario.Boletas {
+		fila := i / g.config.BoletasPorFila
+		columna := i % g.config.BoletasPorFila
+
+		x := bordesX[columna] + origenX
+		y := bordesY[fila] + origenY
+
+		g.dibujarBoleta(img, boleta, fila, columna, x, y, bordesX[columna+1]-bordesX[columna], bordesY[fila+1]-bordesY[fila])
+	}
+
+	if g.config.LineasColumna {
+		g.dibujarLineasColumna(img, origenX, bordesX)
+	}
+
+	if g.config.GuiasCorte {
+		g.dibujarGuiasCorte(img, origenX, origenY, bordesX, bordesY)
+	}
+
+	for i, decoracion := range g.config.Decoraciones {
+		g.dibujarDecoracion(img, decoracion, g.fuentesDecor[i])
+	}
+
+	if g.config.TextoPie != "" {
+		g.dibujarPie(img, talonario)
+	}
+
+	if g.config.MostrarRango && len(talonario.Boletas) > 0 {
+		g.dibujarRango(img, talonario)
+	}
+
+	if g.config.NumeroTalonarioVisible {
+		g.dibujarNumeroTalonario(img, talonario)
+	}
+
+	if conImagen && imagenAlFrente {
+		g.dibujarImagenBase(img, image.Point{})
+	}
+
+	return rotarImagen(img, g.config.RotarSalida)
+}
+
+// prepararSupermuestreo arma el generador que dibuja los talonarios con todas
+// las medidas en píxeles y los tamaños de fuente multiplicados por
+// Supersampling. Comparte el sorteo con g porque solo se usa para dibujar.
+// Las fuentes que no son TrueType no se pueden ampliar, así que con ellas el
+// supermuestreo se desactiva.
+func (g *GeneradorTalonarios) prepararSupermuestreo() error {
+	if g.fuenteOT == nil {
+		g.logger.Warn("Supersampling requiere una fuente TrueType, se dibuja sin supermuestreo")
+		return nil
+	}
+
+	f := g.config.Supersampling
+	c := g.config
+	c.Supersampling = 0
+	c.Tema = ""
+	c.Fuente = nil
+	c.Logger = slog.New(slog.DiscardHandler)
+	c.CarpetaSalida = ""
+	c.GenerarReverso = false
+	c.AjustarFuenteAutomatico = false
+	c.TamanoPagina = ""
+	c.ImagenEstricta = false
+	c.MargenSuperiorPct, c.MargenInferiorPct, c.MargenIzquierdoPct, c.MargenDerechoPct = 0, 0, 0, 0
+	c.Semilla, c.IDCorrida = g.semilla, g.idCorrida
+
+	// Los valores por defecto en píxeles se fijan antes de ampliarlos.
+	if c.PaddingFondoTexto == 0 {
+		c.PaddingFondoTexto = 4
+	}
+	if c.DesplazamientoSombraX == 0 && c.DesplazamientoSombraY == 0 {
+		c.DesplazamientoSombraX, c.DesplazamientoSombraY = 2, 2
+	}
+	if c.MargenCodigoBarras == 0 {
+		c.MargenCodigoBarras = c.AnchoLineas + 2
+	}
+	for _, v := range []*int{
+		&c.AnchoTalonario, &c.AltoTalonario,
+		&c.MargenSuperior, &c.MargenInferior, &c.MargenIzquierdo, &c.MargenDerecho,
+		&c.AnchoLineas, &c.PaddingFondoTexto, &c.PaddingInterno, &c.AltoCodigoBarras, &c.GrosorContorno,
+		&c.EspaciadoLetras, &c.XNumeroTalonario, &c.YNumeroTalonario,
+		&c.DesplazamientoSombraX, &c.DesplazamientoSombraY,
+		&c.DesplazamientoGridX, &c.DesplazamientoGridY,
+		&c.MargenCodigoBarras, &c.XCodigoBarras, &c.YCodigoBarras,
+	} {
+		*v *= f
+	}
+	// El tamaño de la fuente del número ya está resuelto, p. ej. por el ajuste
+	// automático; los demás en 0 siguen tomándolo de TamanoFuente.
+	c.FuenteNumero.Tamano = 0
+	for _, v := range []*float64{
+		&c.TamanoFuente, &c.TamanoFuentePie, &c.TamanoFuentePrecio,
+		&c.TamanoFuenteTalonario, &c.FuenteEtiqueta.Tamano,
+	} {
+		*v *= float64(f)
+	}
+	c.Decoraciones = slices.Clone(c.Decoraciones)
+	for i := range c.Decoraciones {
+		d := &c.Decoraciones[i]
+		d.X, d.Y, d.X2, d.Y2 = d.X*f, d.Y*f, d.X2*f, d.Y2*f
+		d.Ancho, d.Alto, d.Grosor = d.Ancho*f, d.Alto*f, d.Grosor*f
+		d.Tamano *= float64(f)
+	}
+
+	sub, err := NewGeneradorTalonarios(c)
+	if err != nil {
+		return fmt.Errorf("error preparando Supersampling: %v", err)
+	}
+	sub.fecha = g.fecha
+	g.supermuestreo = sub
+	return nil
+}
+
+// reducirImagen achica img a 1/f de su tamaño promediando cada bloque de f×f
+// píxeles, el filtro de caja que corresponde a un factor entero.
+func reducirImagen(img *image.RGBA, f int) *image.RGBA {
+	limites := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, limites.Dx()/f, limites.Dy()/f))
+	n := uint32(f * f)
+	for y := range dst.Rect.Dy() {
+		for x := range dst.Rect.Dx() {
+			var suma [4]uint32
+			for dy := range f {
+				i := img.PixOffset(limites.Min.X+x*f, limites.Min.Y+y*f+dy)
+				for dx := range f {
+					for c := range 4 {
+						suma[c] += uint32(img.Pix[i+dx*4+c])
+					}
+				}
+			}
+			j := dst.PixOffset(x, y)
+			for c := range 4 {
+				dst.Pix[j+c] = uint8((suma[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// cuadricula devuelve el origen y el ancho de la cuadrícula de boletas y los
+// bordes de sus celdas, relativos al origen. DesplazamientoGridX/Y corren el
+// origen después de centrar.
+func (g *GeneradorTalonarios) cuadricula() (origenX, origenY, anchoGrid int, bordesX, bordesY []int) {
+	anchoBoleta, altoBoleta, filas := g.dimensionesBoleta()
+
+	origenX = g.config.MargenIzquierdo
+	origenY = g.config.MargenSuperior
+	anchoGrid = g.config.AnchoTalonario - g.config.MargenIzquierdo - g.config.MargenDerecho
+	altoGrid := g.config.AltoTalonario - g.config.MargenSuperior - g.config.MargenInferior
+	bordesX = g.bordesCeldas(anchoGrid, g.config.BoletasPorFila, anchoBoleta)
+	bordesY = g.bordesCeldas(altoGrid, filas, altoBoleta)
+
+	if g.config.CentrarGrid {
+		// Reparte por igual los píxeles que sobran de la división entera
+		sobranteX := anchoGrid - bordesX[len(bordesX)-1]
+		sobranteY := altoGrid - bordesY[len(bordesY)-1]
+		origenX += sobranteX / 2
+		origenY += sobranteY / 2
+		anchoGrid = bordesX[len(bordesX)-1]
+	}
+	origenX += g.config.DesplazamientoGridX
+	origenY += g.config.DesplazamientoGridY
+	return origenX, origenY, anchoGrid, bordesX, bordesY
+}
+
+// llevaImagenBase indica si ImagenSoloEn incluye al talonario id.
+func (g *GeneradorTalonarios) llevaImagenBase(id int) bool {
+	switch g.config.ImagenSoloEn {
+	case "primero":
+		return id == 1
+	case "ultimo":
+		return id == g.config.CantidadPaginas
+	}
+	return true
+}
+
+// prepararReverso carga la fuente, las decoraciones y la imagen del reverso.
+func (g *GeneradorTalonarios) prepararReverso() error {
+	var err error
+	if g.fuenteReverso, err = g.faceSecundaria(g.config.TamanoFuenteReverso); err != nil {
+		return fmt.Errorf("error creando fuente del reverso: %v", err)
+	}
+	if g.fuentesReverso, err = g.fuentesDecoraciones(g.config.DecoracionesReverso); err != nil {
+		return fmt.Errorf("reverso: %v", err)
+	}
+	if g.config.ImagenReverso != "" {
+		if g.imagenReverso, err = g.cargarImagen(g.config.ImagenReverso); err != nil {
+			return fmt.Errorf("error cargando imagen del reverso %s: %v", g.config.ImagenReverso, err)
+		}
+	}
+	return nil
+}
+
+// crearImagenReverso dibuja el reverso del talonario sobre la cuadrícula del
+// frente en espejo horizontal, para que al imprimir a doble cara volteando
+// por el lado largo cada reverso quede detrás de su boleta.
+func (g *GeneradorTalonarios) crearImagenReverso(talonario Talonario) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, g.config.AnchoTalonario, g.config.AltoTalonario))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0, 0, 0, 255}}, image.Point{}, draw.Src)
+	if g.imagenReverso != nil {
+		escalada := g.escalarConCache(g.imagenReverso, g.config.AnchoTalonario, g.config.AltoTalonario)
+		draw.Draw(img, img.Bounds(), escalada, image.Point{}, draw.Over)
+	}
+
+	origenX, origenY, anchoGrid, bordesX, bordesY := g.cuadricula()
+	espejo := g.config.AnchoTalonario - origenX
+	g.dibujarLineaSuperior(img, espejo-anchoGrid, origenY, anchoGrid, g.config.ColorLinea)
+
+	for i, boleta := range talonario.Boletas {
+		fila := i / g.config.BoletasPorFila
+		columna := i % g.config.BoletasPorFila
+
+		// La celda termina donde empieza la del frente, medido desde el otro borde
+		x := espejo - bordesX[columna+1]
+		y := bordesY[fila] + origenY
+		borde, _ := g.coloresBoleta(fila, columna)
+		x, y, ancho, alto := g.dibujarContorno(img, x, y, bordesX[columna+1]-bordesX[columna], bordesY[fila+1]-bordesY[fila], borde)
+		if g.config.TextoReverso != "" {
+			g.dibujarTextoReverso(img, boleta, talonario.ID, x, y, ancho, alto)
+		}
+	}
+
+	for i, decoracion := range g.config.DecoracionesReverso {
+		g.dibujarDecoracion(img, decoracion, g.fuentesReverso[i])
+	}
+
+	return rotarImagen(img, g.config.RotarSalida)
+}
+
+// dibujarTextoReverso escribe TextoReverso centrado en la boleta, una línea
+// debajo de otra.
+func (g *GeneradorTalonarios) dibujarTextoReverso(img *image.RGBA, boleta Boleta, id, x, y, ancho, alto int) {
+	texto := strings.NewReplacer(
+		"{numero}", boleta.Formateado,
+		"{id}", strconv.Itoa(id),
+		"{fecha}", g.fecha,
+	).Replace(g.config.TextoReverso)
+	lineas := strings.Split(texto, "\n")
+
+	metricas := g.fuenteReverso.Metrics()
+	altoLinea := metricas.Height.Ceil()
+	yLinea := y + (alto-altoLinea*len(lineas))/2 + metricas.Ascent.Ceil()
+	for _, linea := range lineas {
+		xLinea := x + (ancho-g.anchoNumero(g.fuenteReverso, linea))/2
+		g.dibujarTexto(img, g.fuenteReverso, linea, xLinea, yLinea, g.config.ColorTexto)
+		yLinea += altoLinea
+	}
+}
+
+// dibujarImagenBase compone la imagen base escalada a todo el talonario, con
+// OpacidadImagenBase si se definió. desde es el punto del talonario que cae en
+// la esquina de img, para dibujar solo el recorte de una boleta.
+func (g *GeneradorTalonarios) dibujarImagenBase(img *image.RGBA, desde image.Point) {
+	imagenEscalada := g.escalarConCache(g.imagenBase, g.config.AnchoTalonario, g.config.AltoTalonario)
+	if op := g.config.OpacidadImagenBase; op > 0 && op < 1 {
+		mascara := &image.Uniform{color.Alpha{uint8(math.Round(op * 255))}}
+		draw.DrawMask(img, img.Bounds(), imagenEscalada, desde, mascara, image.Point{}, draw.Over)
+	} else {
+		draw.Draw(img, img.Bounds(), imagenEscalada, desde, draw.Over)
+	}
+}
+
+// crearImagenBoleta dibuja sola la boleta i del talonario, del tamaño de su
+// celda, sobre el recorte de la imagen base que le toca en la cuadrícula.
+func (g *GeneradorTalonarios) crearImagenBoleta(talonario Talonario, i int) *image.RGBA {
+	origenX, origenY, _, bordesX, bordesY := g.cuadricula()
+	fila := i / g.config.BoletasPorFila
+	columna := i % g.config.BoletasPorFila
+	ancho := bordesX[columna+1] - bordesX[columna]
+	alto := bordesY[fila+1] - bordesY[fila]
+	celda := image.Pt(bordesX[columna]+origenX, bordesY[fila]+origenY)
+
+	img := image.NewRGBA(image.Rect(0, 0, ancho, alto))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0, 0, 0, 255}}, image.Point{}, draw.Src)
+
+	imagenAlFrente := g.config.OrdenCapas == "imagen-frente"
+	conImagen := g.imagenBase != nil && g.llevaImagenBase(talonario.ID)
+	if conImagen && !imagenAlFrente {
+		g.dibujarImagenBase(img, celda)
+	}
+	g.dibujarBoleta(img, talonario.Boletas[i], fila, columna, 0, 0, ancho, alto)
+	if conImagen && imagenAlFrente {
+		g.dibujarImagenBase(img, celda)
+	}
+
+	return rotarImagen(img, g.config.RotarSalida)
+}
+
+// guardarBoletas escribe cada boleta del talonario en su propio archivo con
+// UnArchivoPorBoleta.
+func (g *GeneradorTalonarios) guardarBoletas(talonario Talonario) (nombreArchivo string, err error) {
+	for i, boleta := range talonario.Boletas {
+		nombreArchivo = g.nombreBoleta(boleta)
+		if err := g.guardarImagen(g.crearImagenBoleta(talonario, i), nombreArchivo); err != nil {
+			return nombreArchivo, err
+		}
+	}
+	return "", nil
+}
+
+// prepararTextura carga TexturaFondo y la repite una sola vez en mosaico,
+// desde la esquina superior izquierda y sin escalar, hasta cubrir el talonario.
+func (g *GeneradorTalonarios) prepararTextura() error {
+	teja, err := g.cargarImagen(g.config.TexturaFondo)
+	if err != nil {
+		return err
+	}
+	limites := teja.Bounds()
+	if limites.Empty() {
+		return errors.New("la textura está vacía")
+	}
+
+	g.textura = image.NewRGBA(image.Rect(0, 0, g.config.AnchoTalonario, g.config.AltoTalonario))
+	for y := 0; y < g.config.AltoTalonario; y += limites.Dy() {
+		for x := 0; x < g.config.AnchoTalonario; x += limites.Dx() {
+			draw.Draw(g.textura, image.Rect(x, y, x+limites.Dx(), y+limites.Dy()), teja, limites.Min, draw.Src)
+		}
+	}
+	return nil
+}
+
+// dibujarTextura compone la textura ya repetida con OpacidadTextura.
+func (g *GeneradorTalonarios) dibujarTextura(img *image.RGBA) {
+	if op := g.config.OpacidadTextura; op > 0 && op < 1 {
+		mascara := &image.Uniform{color.Alpha{uint8(math.Round(op * 255))}}
+		draw.DrawMask(img, img.Bounds(), g.textura, image.Point{}, mascara, image.Point{}, draw.Over)
+	} else {
+		draw.Draw(img, img.Bounds(), g.textura, image.Point{}, draw.Over)
+	}
+}
+
+// bordesCeldas devuelve los n+1 desplazamientos donde empiezan las n celdas
+// de tamaño base y termina la última. Con RepartirSobrante los total-n*base
+// píxeles que deja la división entera se suman de a uno a las primeras
+// celdas, así que el último borde cae justo en total.
+func (g *GeneradorTalonarios) bordesCeldas(total, n, base int) []int {
+	sobrante := 0
+	if g.config.RepartirSobrante {
+		sobrante = total - n*base
+	}
+	bordes := make([]int, n+1)
+	for i := range bordes {
+		bordes[i] = i*base + min(i, sobrante)
+	}
+	return bordes
+}
+
+// Trazos de las líneas de columna discontinuas, en píxeles.
+const (
+	largoGuion   = 12
+	espacioGuion = 8
+)
+
+// dibujarLineasColumna traza una línea vertical de AnchoLineas centrada en
+// cada borde entre columnas, de MargenSuperior a AltoTalonario -
+// MargenInferior, corrida como la cuadrícula por DesplazamientoGridY.
+func (g *GeneradorTalonarios) dibujarLineasColumna(img *image.RGBA, x0 int, bordesX []int) {
+	grosor := max(g.config.AnchoLineas, 1)
+	desde := g.config.MargenSuperior + g.config.DesplazamientoGridY
+	hasta := g.config.AltoTalonario - g.config.MargenInferior + g.config.DesplazamientoGridY
+	paso, largo := hasta-desde, hasta-desde
+	if g.config.EstiloLineasColumna == "discontinua" {
+		paso, largo = largoGuion+espacioGuion, largoGuion
+	}
+
+	for c := 1; c < len(bordesX)-1; c++ {
+		x := x0 + bordesX[c] - grosor/2
+		for y := desde; y < hasta; y += paso {
+			trazo := image.Rect(x, y, x+grosor, min(y+largo, hasta))
+			draw.Draw(img, trazo, &image.Uniform{g.config.ColorLinea}, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// dibujarGuiasCorte traza líneas de un píxel sobre cada límite entre filas y
+// columnas, de lado a lado de la cuadrícula.
+func (g *GeneradorTalonarios) dibujarGuiasCorte(img *image.RGBA, x0, y0 int, bordesX, bordesY []int) {
+	col := g.config.ColorGuia
+	if col == (color.RGBA{}) {
+		col = color.RGBA{128, 128, 128, 255}
+	}
+
+	columnas := len(bordesX) - 1
+	filas := len(bordesY) - 1
+	anchoGrid := bordesX[columnas]
+	altoGrid := bordesY[filas]
+	limites := img.Bounds()
+
+	for c := 0; c <= columnas; c++ {
+		x := x0 + bordesX[c]
+		if c == columnas {
+			x--
+		}
+		for y := y0; y < y0+altoGrid; y++ {
+			if (image.Point{x, y}).In(limites) {
+				img.Set(x, y, col)
+			}
+		}
+	}
+
+	for f := 0; f <= filas; f++ {
+		y := y0 + bordesY[f]
+		if f == filas {
+			y--
+		}
+		for x := x0; x < x0+anchoGrid; x++ {
+			if (image.Point{x, y}).In(limites) {
+				img.Set(x, y, col)
+			}
+		}
+	}
+}
+
+func (g *GeneradorTalonarios) dibujarDecoracion(img *image.RGBA, d Decoracion, face font.Face) {
+	grosor := max(d.Grosor, 1)
+
+	switch d.Tipo {
+	case "rect":
+		if d.Relleno {
+			draw.Draw(img, image.Rect(d.X, d.Y, d.X+d.Ancho, d.Y+d.Alto), &image.Uniform{d.Color}, image.Point{}, draw.Src)
+			return
+		}
+		g.dibujarLineaHorizontal(img, d.X, d.Y, d.Ancho, grosor, d.Color)
+		g.dibujarRectanguloCon(img, d.X, d.Y, d.Ancho, d.Alto, grosor, d.Color)
+	case "linea":
+		dibujarSegmento(img, d.X, d.Y, d.X2, d.Y2, grosor, d.Color)
+	case "texto":
+		g.dibujarTextoCon(img, face, d.Texto, d.X, d.Y, d.Color)
+	}
+}
+
+// fuentesDecoraciones crea la fuente de cada decoración de texto; las demás
+// quedan en nil.
+func (g *GeneradorTalonarios) fuentesDecoraciones(decoraciones []Decoracion) ([]font.Face, error) {
+	fuentes := make([]font.Face, len(decoraciones))
+	for i, d := range decoraciones {
+		if d.Tipo != "texto" {
+			continue
+		}
+		face, err := g.faceSecundaria(d.Tamano)
+		if d.Fuente == "numero" {
+			face, err = g.config.Fuente, nil
+			if d.Tamano > 0 && g.fuenteOT != nil {
+				face, err = g.crearFace(d.Tamano)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error creando fuente de la decoración %d: %v", i, err)
+		}
+		fuentes[i] = face
+	}
+	return fuentes, nil
+}
+
+// validarPredefinidos comprueba que NumerosPredefinidos tenga exactamente un
+// número por cada sorteo de la corrida, sin repetir y dentro del rango y los
+// filtros de dígitos.
+func (g *GeneradorTalonarios) validarPredefinidos() error {
+	predefinidos := g.config.NumerosPredefinidos
+	if len(predefinidos) == 0 {
+		return nil
+	}
+	if g.config.NumerosPorBoleta > 1 {
+		return errors.New("NumerosPredefinidos no se admite con NumerosPorBoleta mayor a 1")
+	}
+	if g.config.DistribuirUltimoDigito {
+		return errors.New("DistribuirUltimoDigito no se admite con NumerosPredefinidos, que fijan el orden")
+	}
+	if necesarios := g.numerosNecesarios(); len(predefinidos) != necesarios {
+		return fmt.Errorf("NumerosPredefinidos tiene %d números pero la configuración necesita %d", len(predefinidos), necesarios)
+	}
+
+	vistos := make(map[int]bool, len(predefinidos))
+	for i, numero := range predefinidos {
+		if numero < g.config.NumeroMinimo || numero > g.config.NumeroMaximo {
+			return fmt.Errorf("NumerosPredefinidos[%d] = %d está fuera del rango %d-%d", i, numero, g.config.NumeroMinimo, g.config.NumeroMaximo)
+		}
+		if g.numeroExcluido(numero) {
+			return fmt.Errorf("NumerosPredefinidos[%d] = %d está excluido por ExcluirRepetidos, ExcluirSecuenciales, NumerosDisponibles, Paso o ParidadNumeros", i, numero)
+		}
+		if vistos[numero] {
+			return fmt.Errorf("NumerosPredefinidos repite el número %d", numero)
+		}
+		vistos[numero] = true
+	}
+	return nil
+}
+
+func validarDecoraciones(decoraciones []Decoracion, nombre string) error {
+	for i, d := range decoraciones {
+		switch d.Tipo {
+		case "rect", "linea", "texto":
+		default:
+			return fmt.Errorf("%s %d: tipo inválido %q (valores válidos: rect, linea, texto)", nombre, i, d.Tipo)
+		}
+		switch d.Fuente {
+		case "", "etiqueta", "numero":
+		default:
+			return fmt.Errorf("%s %d: fuente inválida %q (valores válidos: etiqueta, numero)", nombre, i, d.Fuente)
+		}
+	}
+	return nil
+}
+
+// dibujarSegmento traza una línea recta (Bresenham) con un pincel cuadrado
+// de grosor píxeles.
+func dibujarSegmento(img *image.RGBA, x0, y0, x1, y1, grosor int, col color.RGBA) {
+	dx := abs(x1 - x0)
+	dy := -abs(y1 - y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	desplazamiento := grosor / 2
+
+	for err := dx + dy; ; {
+		for i := range grosor {
+			for j := range grosor {
+				img.Set(x0+i-desplazamiento, y0+j-desplazamiento, col)
+			}
+		}
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// dibujarPie escribe TextoPie centrado verticalmente en el margen inferior.
+func (g *GeneradorTalonarios) dibujarPie(img *image.RGBA, talonario Talonario) {
+	texto := strings.NewReplacer(
+		"{id}", strconv.Itoa(talonario.ID),
+		"{total}", strconv.Itoa(g.config.CantidadPaginas),
+		"{fecha}", g.fecha,
+		"{suma}", strconv.Itoa(talonario.Suma),
+		"{paridad}", talonario.Paridad,
+	).Replace(g.config.TextoPie)
+
+	y := g.config.AltoTalonario - g.config.MargenInferior/2
+	g.dibujarTextoCon(img, g.fuentePie, texto, g.config.MargenIzquierdo, y, g.config.ColorTexto)
+}
+
+// dibujarRango escribe "Contiene: menor–mayor" alineado a la derecha en la
+// misma línea que el pie. Con OrdenarDentroTalonario son la primera y la
+// última boleta.
+func (g *GeneradorTalonarios) dibujarRango(img *image.RGBA, talonario Talonario) {
+	menor, mayor := talonario.Boletas[0].Numero, talonario.Boletas[0].Numero
+	for _, boleta := range talonario.Boletas[1:] {
+		menor = min(menor, boleta.Numero)
+		mayor = max(mayor, boleta.Numero)
+	}
+
+	texto := fmt.Sprintf("Contiene: %s–%s", g.formatearNumero(menor), g.formatearNumero(mayor))
+	// Mismo trazo que el pie, sin el contorno, la sombra ni el espaciado del número
+	x := g.config.AnchoTalonario - g.config.MargenDerecho - font.MeasureString(g.fuentePie, texto).Round()
+	y := g.config.AltoTalonario - g.config.MargenInferior/2
+	g.dibujarTextoCon(img, g.fuentePie, texto, x, y, g.config.ColorTexto)
+}
+
+// dibujarNumeroTalonario escribe "Talonario N° 012" con el ID del talonario,
+// con tantos dígitos como CantidadPaginas y al menos tres. Sin posición
+// configurada va alineado a la derecha y centrado en MargenSuperior.
+func (g *GeneradorTalonarios) dibujarNumeroTalonario(img *image.RGBA, talonario Talonario) {
+	digitos := max(len(strconv.Itoa(g.config.CantidadPaginas)), 3)
+	texto := fmt.Sprintf("Talonario N° %0*d", digitos, talonario.ID)
+
+	x, y := g.config.XNumeroTalonario, g.config.YNumeroTalonario
+	if x == 0 && y == 0 {
+		x = g.config.AnchoTalonario - g.config.MargenDerecho - g.anchoNumero(g.fuenteTalonario, texto)
+		y = max(g.config.MargenSuperior/2, g.fuenteTalonario.Metrics().Ascent.Ceil())
+	}
+	g.dibujarTexto(img, g.fuenteTalonario, texto, x, y, g.config.ColorTexto)
+}
+
+// rotarImagen gira la imagen ya dibujada en sentido horario; con 90 y 270 se
+// intercambian ancho y alto.
+func rotarImagen(img *image.RGBA, grados int) *image.RGBA {
+	orientaciones := map[int]int{90: 6, 180: 3, 270: 8}
+	orientacion, ok := orientaciones[grados]
+	if !ok {
+		return img
+	}
+	return orientarImagen(img, orientacion).(*image.RGBA)
+}
+
+// dibujarEncabezado escala la imagen de encabezado, sin deformarla, al mayor
+// tamaño que cabe en el ancho del talonario y en MargenSuperior, y la centra
+// en esa franja.
+func (g *GeneradorTalonarios) dibujarEncabezado(img *image.RGBA) {
+	limites := g.encabezado.Bounds()
+	escala := math.Min(float64(g.config.AnchoTalonario)/float64(limites.Dx()),
+		float64(g.config.MargenSuperior)/float64(limites.Dy()))
+	ancho := max(int(float64(limites.Dx())*escala), 1)
+	alto := max(int(float64(limites.Dy())*escala), 1)
+
+	x := (g.config.AnchoTalonario - ancho) / 2
+	y := (g.config.MargenSuperior - alto) / 2
+	escalada := g.escalarConCache(g.encabezado, ancho, alto)
+	draw.Draw(img, image.Rect(x, y, x+ancho, y+alto), escalada, image.Point{}, draw.Over)
+}
+
+// escalarConCache devuelve el resultado de escalarImagen, reutilizando uno ya
+// calculado para una imagen de idéntico contenido y el mismo tamaño destino.
+func (g *GeneradorTalonarios) escalarConCache(src image.Image, ancho, alto int) image.Image {
+	if g.cache == nil {
+		return g.escalarImagen(src, ancho, alto)
+	}
+
+	clave := claveEscalado{hash: hashImagen(src), ancho: ancho, alto: alto}
+	if img, ok := g.cache.obtener(clave); ok {
+		return img
+	}
+
+	img := g.escalarImagen(src, ancho, alto)
+	g.cache.guardar(clave, img)
+	return img
+}
+
+func (g *GeneradorTalonarios) escalarImagen(src image.Image, ancho, alto int) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, ancho, alto))
+
+	scaleX := float64(bounds.Dx()) / float64(ancho)
+	scaleY := float64(bounds.Dy()) / float64(alto)
+
+	for y := range alto {
+		for x := range ancho {
+			srcX := int(float64(x) * scaleX)
+			srcY := int(float64(y) * scaleY)
+			dst.Set(x, y, src.At(bounds.Min.X+srcX, bounds.Min.Y+srcY))
+		}
+	}
+
+	return dst
+}
+
+// dibujarContorno traza el borde de la boleta según FormaBoleta y devuelve el
+// área de la celda o de la caja de la forma.
+func (g *GeneradorTalonarios) dibujarContorno(img *image.RGBA, x, y, ancho, alto int, borde color.RGBA) (int, int, int, int) {
+	if g.config.FormaBoleta == "circulo" || g.config.FormaBoleta == "elipse" {
+		caja := g.cajaForma(x, y, ancho, alto)
+		g.dibujarElipse(img, caja, g.config.AnchoLineas, borde)
+		return caja.Min.X, caja.Min.Y, caja.Dx(), caja.Dy()
+	}
+	g.dibujarRectangulo(img, x, y, ancho, alto, borde)
+	return x, y, ancho, alto
+}
+
+func (g *GeneradorTalonarios) dibujarBoleta(img *image.RGBA, boleta Boleta, fila, columna, x, y, ancho, alto int) {
+
+	advance := font.MeasureString(g.config.Fuente, "0")
+	anchoCaracter := advance.Round()
+
+	// Con NumerosPorBoleta la fuente se elige por el número más ancho
+	textos := []string{boleta.Formateado}
+	masAncho := boleta.Formateado
+	anchoTexto := g.anchoNumero(g.config.Fuente, boleta.Formateado)
+	for _, adicional := range boleta.Adicionales {
+		textos = append(textos, adicional.Formateado)
+		if a := g.anchoNumero(g.config.Fuente, adicional.Formateado); a > anchoTexto {
+			masAncho, anchoTexto = adicional.Formateado, a
+		}
+	}
+	face, anchoTexto := g.fuenteQueCabe(masAncho, ancho, anchoTexto)
+	bordeColor, fondo := g.coloresBoleta(fila, columna)
+	// El texto se ubica dentro de la forma y no de la celda
+	x, y, ancho, alto = g.dibujarContorno(img, x, y, ancho, alto, bordeColor)
+
+	if g.config.GenerarCodigoBarras {
+		g.dibujarCodigoBarras(img, boleta.Formateado, x, y, ancho, alto)
+	}
+
+	if g.config.NumeroEnEsquinas {
+		g.dibujarEsquinas(img, face, fondo, boleta.Formateado, x, y, ancho, alto, anchoTexto, anchoCaracter)
+		if g.textoPrecio != "" {
+			g.dibujarPrecio(img, x, y, ancho, alto, anchoCaracter, true)
+		}
+		return
+	}
+
+	lineas := len(textos)
+	if g.tablaDigitos != nil {
+		lineas = 2
+	}
+	// Sin PaddingInterno se conservan las sangrías de un carácter de siempre
+	izquierda, derecha := anchoCaracter, g.config.AnchoLineas+anchoCaracter
+	margenVertical := g.config.AnchoLineas + anchoCaracter/2
+	if p := g.config.PaddingInterno; p > 0 {
+		izquierda, derecha = g.config.AnchoLineas+p, g.config.AnchoLineas+p
+		margenVertical = g.config.AnchoLineas + p
+	}
+	altoLinea := face.Metrics().Height.Round()
+	yTexto := g.centroTexto(face, y, alto, margenVertical, g.config.AlineacionVertical)
+	// Todas las líneas se alinean como un solo bloque
+	switch g.config.AlineacionVertical {
+	case "abajo":
+		yTexto -= (lineas - 1) * altoLinea
+	case "", "centro":
+		yTexto -= (lineas - 1) * altoLinea / 2
+	}
+	if g.config.FormaBoleta == "circulo" || g.config.FormaBoleta == "elipse" {
+		metrics := face.Metrics()
+		mitadBloque := (lineas - 1) * altoLinea / 2
+		x, ancho = cuerdaElipse(image.Rect(x, y, x+ancho, y+alto), yTexto+mitadBloque,
+			((metrics.Ascent+metrics.Descent)/2).Ceil()+mitadBloque)
+	}
+
+	// El texto nunca empieza ni termina sobre el borde de la boleta
+	borde := g.config.AnchoLineas + g.config.GrosorContorno + g.config.PaddingInterno
+	var xTexto int
+	for k, texto := range textos {
+		anchoLinea := anchoTexto
+		if len(textos) > 1 {
+			anchoLinea = g.anchoNumero(face, texto)
+		}
+
+		var xLinea int
+		switch g.config.OrientacionBoletas {
+		case OrientacionIzquierda:
+			xLinea = x + izquierda
+		case OrientacionCentro:
+			xLinea = x + (ancho-anchoLinea)/2
+		case OrientacionDerecha:
+			xLinea = x + ancho - derecha - anchoLinea
+		}
+		xLinea = max(x+borde, min(xLinea, x+ancho-borde-anchoLinea))
+		yLinea := yTexto + k*altoLinea
+		if k == 0 {
+			xTexto = xLinea
+		}
+
+		if fondo.A > 0 {
+			g.dibujarFondoTexto(img, face, fondo, texto, xLinea, yLinea)
+		}
+		g.dibujarNumero(img, face, texto, xLinea, yLinea)
+	}
+	if g.tablaDigitos != nil {
+		g.dibujarSegundaRepresentacion(img, face, boleta.Formateado, x, ancho, xTexto, anchoTexto, yTexto)
+	}
+
+	if g.textoPrecio != "" {
+		g.dibujarPrecio(img, x, y, ancho, alto, anchoCaracter, false)
+	}
+}
+
+// coloresBoleta devuelve el color del borde y de la caja detrás del número de
+// la boleta en fila y columna. Con ColoresAlternos el borde recorre la lista
+// según AlternarPor y, con FondoAlterno, la caja toma ese mismo color.
+func (g *GeneradorTalonarios) coloresBoleta(fila, columna int) (borde, fondo color.RGBA) {
+	borde, fondo = g.config.ColorBorde, g.config.FondoTexto
+	if len(g.config.ColoresAlternos) == 0 {
+		return borde, fondo
+	}
+
+	indice := fila
+	if g.config.AlternarPor == "columna" {
+		indice = columna
+	}
+	borde = g.config.ColoresAlternos[indice%len(g.config.ColoresAlternos)]
+
+	if g.config.FondoAlterno {
+		alfa := fondo.A
+		if alfa == 0 {
+			alfa = 96
+		}
+		fondo = color.RGBA{borde.R, borde.G, borde.B, alfa}
+	}
+	return borde, fondo
+}
+
+// prepararSegundaRepresentacion resuelve la tabla de dígitos y la fuente de la
+// segunda representación, y comprueba que la fuente tenga todos sus dígitos.
+func (g *GeneradorTalonarios) prepararSegundaRepresentacion() error {
+	tabla := g.config.TablaDigitos
+	if tabla == "" {
+		tabla = tablasDigitos[g.config.SegundaRepresentacion]
+	}
+	if tabla == "" {
+		return nil
+	}
+	g.tablaDigitos = []rune(tabla)
+
+	g.fuenteSegunda = g.config.Fuente
+	if g.config.RutaFuenteSegunda != "" {
+		var err error
+		if _, g.fuenteSegunda, err = cargarFuente(g.config.RutaFuenteSegunda, g.config.TamanoFuente); err != nil {
+			return fmt.Errorf("error cargando fuente de la segunda representación: %v", err)
+		}
+	}
+
+	for _, r := range g.tablaDigitos {
+		if _, ok := g.fuenteSegunda.GlyphAdvance(r); !ok {
+			return fmt.Errorf("la fuente no tiene el dígito %q de la segunda representación; indique RutaFuenteSegunda", r)
+		}
+	}
+	return nil
+}
+
+// segundaRepresentacion reemplaza los dígitos 0-9 de texto por los de la
+// tabla; prefijos, separadores y etiquetas se conservan.
+func (g *GeneradorTalonarios) segundaRepresentacion(texto string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return g.tablaDigitos[r-'0']
+		}
+		return r
+	}, texto)
+}
+
+// dibujarSegundaRepresentacion escribe el número con la tabla secundaria en
+// la línea siguiente al número principal y con su misma alineación.
+func (g *GeneradorTalonarios) dibujarSegundaRepresentacion(img *image.RGBA, face font.Face, texto string, x, ancho, xTexto, anchoTexto, yTexto int) {
+	segundo := g.segundaRepresentacion(texto)
+	anchoSegundo := g.anchoNumero(g.fuenteSegunda, segundo)
+
+	xSegundo := xTexto
+	switch g.config.OrientacionBoletas {
+	case OrientacionCentro:
+		xSegundo = x + (ancho-anchoSegundo)/2
+	case OrientacionDerecha:
+		xSegundo = xTexto + anchoTexto - anchoSegundo
+	}
+	ySegundo := yTexto + face.Metrics().Height.Round()
+
+	g.dibujarTexto(img, g.fuenteSegunda, segundo, xSegundo, ySegundo, g.config.ColorTexto)
+}
+
+// fuenteQueCabe devuelve la fuente con que se dibuja texto en una boleta de
+// ancho píxeles y el ancho que ocupa. Si con TamanoFuente no cabe entre los
+// bordes y el contorno, la reduce de medio punto en medio punto; con
+// AvisarDesborde, o si la fuente no se puede escalar, conserva el tamaño y lo
+// avisa una sola vez por el logger.
+func (g *GeneradorTalonarios) fuenteQueCabe(texto string, ancho, anchoTexto int) (font.Face, int) {
+	disponible := ancho - 2*(g.config.AnchoLineas+g.config.GrosorContorno+g.config.PaddingInterno)
+	if anchoTexto <= disponible {
+		return g.config.Fuente, anchoTexto
+	}
+
+	if !g.config.AvisarDesborde && g.fuenteOT != nil {
+		inicial := math.Floor(g.config.TamanoFuente*float64(disponible)/float64(anchoTexto)*2) / 2
+		for tamano := inicial; tamano >= 1; tamano -= 0.5 {
+			face, ok := g.fuentesReducidas[tamano]
+			if !ok {
+				var err error
+				if face, err = g.crearFace(tamano); err != nil {
+					break
+				}
+				if g.fuentesReducidas == nil {
+					g.fuentesReducidas = make(map[float64]font.Face)
+				}
+				g.fuentesReducidas[tamano] = face
+			}
+			if w := g.anchoNumero(face, texto); w <= disponible {
+				return face, w
+			}
+		}
+	}
+
+	if !g.desbordeAvisado {
+		g.desbordeAvisado = true
+		g.logger.Warn("el número no cabe en la boleta", "numero", texto, "ancho_texto", anchoTexto, "disponible", disponible)
+	}
+	return g.config.Fuente, anchoTexto
+}
+
+// codificarBarras genera el código de barras de texto en la simbología elegida.
+func (g *GeneradorTalonarios) codificarBarras(texto string) (barcode.Barcode, error) {
+	switch strings.ToLower(g.config.SimbologiaCodigo) {
+	case "code39":
+		return code39.Encode(texto, false, true)
+	default:
+		return code128.Encode(texto)
+	}
+}
+
+// franjaCodigoBarras calcula el rectángulo que ocupa el código dentro de la
+// boleta: una franja de lado a lado arriba o abajo, o un recuadro de
+// FraccionAnchoCodigo del ancho en una esquina o en XCodigoBarras,
+// YCodigoBarras.
+func (g *GeneradorTalonarios) franjaCodigoBarras(x, y, ancho, alto int) image.Rectangle {
+	margen := g.config.MargenCodigoBarras
+	if margen <= 0 {
+		margen = g.config.AnchoLineas + 2
+	}
+	altoCodigo := g.config.AltoCodigoBarras
+	if altoCodigo <= 0 {
+		altoCodigo = alto / 4
+	}
+
+	posicion := g.config.PosicionCodigoBarras
+	switch posicion {
+	case "", "abajo":
+		y0 := y + alto - margen - altoCodigo
+		return image.Rect(x+margen, y0, x+ancho-margen, y0+altoCodigo)
+	case "arriba":
+		return image.Rect(x+margen, y+margen, x+ancho-margen, y+margen+altoCodigo)
+	}
+
+	fraccion := g.config.FraccionAnchoCodigo
+	if fraccion <= 0 {
+		fraccion = 0.5
+	}
+	anchoCodigo := int(math.Round(float64(ancho) * fraccion))
+	if posicion == "xy" {
+		x0, y0 := x+g.config.XCodigoBarras, y+g.config.YCodigoBarras
+		return image.Rect(x0, y0, x0+anchoCodigo, y0+altoCodigo)
+	}
+
+	x0, y0 := x+margen, y+margen
+	if strings.HasSuffix(posicion, "-der") {
+		x0 = x + ancho - margen - anchoCodigo
+	}
+	if strings.HasPrefix(posicion, "inf-") {
+		y0 = y + alto - margen - altoCodigo
+	}
+	return image.Rect(x0, y0, x0+anchoCodigo, y0+altoCodigo)
+}
+
+// validarCodigoBarras comprueba de antemano que el número más largo se puede
+// codificar y que sus barras caben a lo ancho de la boleta.
+func (g *GeneradorTalonarios) validarCodigoBarras() error {
+	switch strings.ToLower(g.config.SimbologiaCodigo) {
+	case "", "code128", "code39":
+	default:
+		return fmt.Errorf("simbología de código de barras inválida: %q (valores válidos: code128, code39)", g.config.SimbologiaCodigo)
+	}
+	switch g.config.PosicionCodigoBarras {
+	case "", "abajo", "arriba", "sup-izq", "sup-der", "inf-izq", "inf-der", "xy":
+	default:
+		return fmt.Errorf("posición de código de barras inválida: %q (valores válidos: abajo, arriba, sup-izq, sup-der, inf-izq, inf-der, xy)", g.config.PosicionCodigoBarras)
+	}
+	if f := g.config.FraccionAnchoCodigo; f < 0 || f > 1 {
+		return fmt.Errorf("FraccionAnchoCodigo debe estar entre 0 y 1: %v", f)
+	}
+	if g.config.MargenCodigoBarras < 0 {
+		return fmt.Errorf("MargenCodigoBarras no puede ser negativo: %d", g.config.MargenCodigoBarras)
+	}
+
+	codigo, err := g.codificarBarras(g.formatearNumero(g.config.NumeroMaximo))
+	if err != nil {
+		return fmt.Errorf("error generando código de barras: %v", err)
+	}
+
+	anchoBoleta, altoBoleta, _ := g.dimensionesBoleta()
+	franja := g.franjaCodigoBarras(0, 0, anchoBoleta, altoBoleta)
+	if !franja.In(image.Rect(0, 0, anchoBoleta, altoBoleta)) {
+		return fmt.Errorf("el código de barras %v se sale de la boleta de %dx%d", franja, anchoBoleta, altoBoleta)
+	}
+	if franja.Dx() < codigo.Bounds().Dx() {
+		return fmt.Errorf("la boleta es muy angosta para el código de barras: hay %d píxeles y se necesitan %d",
+			franja.Dx(), codigo.Bounds().Dx())
+	}
+	return nil
+}
+
+// dibujarCodigoBarras pinta el código sobre fondo blanco para que los lectores
+// tengan contraste sin importar el fondo del talonario.
+func (g *GeneradorTalonarios) dibujarCodigoBarras(img *image.RGBA, texto string, x, y, ancho, alto int) {
+	franja := g.franjaCodigoBarras(x, y, ancho, alto)
+
+	codigo, err := g.codificarBarras(texto)
+	if err == nil {
+		codigo, err = barcode.Scale(codigo, franja.Dx(), franja.Dy())
+	}
+	if err != nil {
+		g.logger.Warn("no se pudo dibujar el código de barras", "numero", texto, "error", err)
+		return
+	}
+
+	draw.Draw(img, franja, codigo, codigo.Bounds().Min, draw.Src)
+}
+
+// dibujarPrecio escribe el precio en el cuarto inferior de la boleta con la
+// misma orientación horizontal que el número, o en el centro si centrado.
+func (g *GeneradorTalonarios) dibujarPrecio(img *image.RGBA, x, y, ancho, alto, anchoCaracter int, centrado bool) {
+	anchoPrecio := font.MeasureString(g.fuentePrecio, g.textoPrecio).Round()
+
+	xPrecio := x + (ancho-anchoPrecio)/2
+	yPrecio := y + alto/2
+	if !centrado {
+		// el precio ocupa la mitad de la boleta que no usa el número
+		yPrecio = y + alto*3/4
+		if g.config.AlineacionVertical == "abajo" {
+			yPrecio = y + alto/4
+		}
+		switch g.config.OrientacionBoletas {
+		case OrientacionIzquierda:
+			xPrecio = x + anchoCaracter
+		case OrientacionDerecha:
+			xPrecio = x + ancho - anchoPrecio - anchoCaracter
+		}
+	}
+
+	g.dibujarTextoCon(img, g.fuentePrecio, g.textoPrecio, xPrecio, yPrecio, g.config.ColorTexto)
+}
+
+// dibujarEsquinas escribe el texto en las cuatro esquinas de la boleta,
+// separado del borde por el grosor de línea más medio carácter.
+func (g *GeneradorTalonarios) dibujarEsquinas(img *image.RGBA, face font.Face, fondo color.RGBA, texto string, x, y, ancho, alto, anchoTexto, anchoCaracter int) {
+	margen := g.config.AnchoLineas + anchoCaracter/2
+
+	izquierda := x + margen
+	derecha := x + ancho - margen - anchoTexto
+	arriba := g.centroTexto(face, y, alto, margen, "arriba")
+	abajo := g.centroTexto(face, y, alto, margen, "abajo")
+
+	for _, p := range []image.Point{{izquierda, arriba}, {derecha, arriba}, {izquierda, abajo}, {derecha, abajo}} {
+		if fondo.A > 0 {
+			g.dibujarFondoTexto(img, face, fondo, texto, p.X, p.Y)
+		}
+		g.dibujarNumero(img, face, texto, p.X, p.Y)
+	}
+}
+
+// dibujarFondoTexto rellena con c, de alfa no premultiplicado, una caja del
+// tamaño del texto más el padding, en la misma posición en que dibujarTexto
+// lo va a escribir.
+func (g *GeneradorTalonarios) dibujarFondoTexto(img *image.RGBA, face font.Face, c color.RGBA, texto string, x, y int) {
+	padding := g.config.PaddingFondoTexto
+	if padding == 0 {
+		padding = 4
+	}
+	padding += g.config.GrosorContorno
+
+	limites, _ := font.BoundString(face, texto)
+	base := g.lineaBase(face, y)
+	caja := image.Rect(
+		x+limites.Min.X.Floor()-padding,
+		base+limites.Min.Y.Floor()-padding,
+		x+limites.Max.X.Ceil()+g.espaciadoTotal(texto)+padding,
+		base+limites.Max.Y.Ceil()+padding,
+	)
+
+	relleno := color.NRGBA{c.R, c.G, c.B, c.A}
+	draw.Draw(img, caja.Intersect(img.Bounds()), &image.Uniform{relleno}, image.Point{}, draw.Over)
+}
+
+func (g *GeneradorTalonarios) dibujarLineaSuperior(img *image.RGBA, x, y, ancho int, col color.RGBA) {
+	g.dibujarLineaHorizontal(img, x, y, ancho, g.config.AnchoLineas, col)
+}
+
+func (g *GeneradorTalonarios) dibujarLineaHorizontal(img *image.RGBA, x, y, ancho, grosor int, col color.RGBA) {
+	for i := range ancho {
+		if x+i >= img.Bounds().Max.X {
+			continue
+		}
+		for thick := range grosor {
+			if y+thick < img.Bounds().Max.Y {
+				img.Set(x+i, y+thick, col)
+			}
+		}
+	}
+}
+
+func (g *GeneradorTalonarios) dibujarRectangulo(img *image.RGBA, x, y, ancho, alto int, col color.RGBA) {
+	g.dibujarRectanguloCon(img, x, y, ancho, alto, g.config.AnchoLineas, col)
+}
+
+// dibujarRectanguloCon traza los bordes inferior, izquierdo y derecho; el
+// superior lo aporta la fila anterior o la línea superior de la cuadrícula.
+func (g *GeneradorTalonarios) dibujarRectanguloCon(img *image.RGBA, x, y, ancho, alto, grosor int, col color.RGBA) {
+	for i := range ancho {
+		if x+i >= img.Bounds().Max.X {
+			continue
+		}
+		for thick := range grosor {
+			if y+alto-1-thick < img.Bounds().Max.Y {
+				img.Set(x+i, y+alto-1-thick, col)
+			}
+		}
+	}
+
+	for i := range alto {
+		if y+i >= img.Bounds().Max.Y {
+			continue
+		}
+		for thick := range grosor {
+			if x+thick < img.Bounds().Max.X {
+				img.Set(x+thick, y+i, col)
+			}
+		}
+		for thick := range grosor {
+			if x+ancho-1-thick < img.Bounds().Max.X {
+				img.Set(x+ancho-1-thick, y+i, col)
+			}
+		}
+	}
+}
+
+// cajaForma devuelve el rectángulo que contiene la forma de FormaBoleta: la
+// celda completa para la elipse y el cuadrado centrado más grande para el
+// círculo.
+func (g *GeneradorTalonarios) cajaForma(x, y, ancho, alto int) image.Rectangle {
+	if g.config.FormaBoleta == "circulo" {
+		lado := min(ancho, alto)
+		x += (ancho - lado) / 2
+		y += (alto - lado) / 2
+		ancho, alto = lado, lado
+	}
+	return image.Rect(x, y, x+ancho, y+alto)
+}
+
+// cuerdaElipse devuelve el tramo horizontal [x, x+ancho] de la elipse
+// inscrita en caja que queda libre a lo largo de toda la franja de alto
+// 2*mitad centrada en yCentro, es decir, su cuerda más corta.
+func cuerdaElipse(caja image.Rectangle, yCentro, mitad int) (x, ancho int) {
+	a, b := float64(caja.Dx())/2, float64(caja.Dy())/2
+	cx, cy := float64(caja.Min.X)+a, float64(caja.Min.Y)+b
+
+	dy := math.Max(math.Abs(float64(yCentro-mitad)-cy), math.Abs(float64(yCentro+mitad)-cy))
+	semicuerda := 0.0
+	if dy < b {
+		semicuerda = a * math.Sqrt(1-(dy/b)*(dy/b))
+	}
+	return int(math.Ceil(cx - semicuerda)), int(2 * semicuerda)
+}
+
+// dibujarElipse traza con antialiasing el borde de la elipse inscrita en caja,
+// de grosor píxeles hacia adentro. El anillo se rasteriza como una máscara
+// para que draw.DrawMask recorte lo que quede fuera de img.
+func (g *GeneradorTalonarios) dibujarElipse(img *image.RGBA, caja image.Rectangle, grosor int, col color.RGBA) {
+	r := vector.NewRasterizer(caja.Dx(), caja.Dy())
+	a, b := float32(caja.Dx())/2, float32(caja.Dy())/2
+	trazarElipse(r, a, b, a, b)
+	if ai, bi := a-float32(grosor), b-float32(grosor); ai > 0 && bi > 0 {
+		// En sentido contrario, para que el interior se reste del contorno
+		trazarElipse(r, a, b, ai, -bi)
+	}
+
+	mascara := image.NewAlpha(image.Rect(0, 0, caja.Dx(), caja.Dy()))
+	r.Draw(mascara, mascara.Bounds(), image.Opaque, image.Point{})
+	draw.DrawMask(img, caja, &image.Uniform{col}, image.Point{}, mascara, image.Point{}, draw.Over)
+}
+
+// trazarElipse agrega a r una elipse de centro (cx, cy) con cuatro curvas de
+// Bézier cúbicas; un radio ry negativo invierte el sentido del recorrido.
+func trazarElipse(r *vector.Rasterizer, cx, cy, rx, ry float32) {
+	const k = 0.5522848 // 4/3·(√2−1): el arco cúbico más cercano a un cuarto de círculo
+	r.MoveTo(cx+rx, cy)
+	r.CubeTo(cx+rx, cy+k*ry, cx+k*rx, cy+ry, cx, cy+ry)
+	r.CubeTo(cx-k*rx, cy+ry, cx-rx, cy+k*ry, cx-rx, cy)
+	r.CubeTo(cx-rx, cy-k*ry, cx-k*rx, cy-ry, cx, cy-ry)
+	r.CubeTo(cx+k*rx, cy-ry, cx+rx, cy-k*ry, cx+rx, cy)
+	r.ClosePath()
+}
+
+// dibujarTexto escribe texto como dibujarNumero, en un color fijo.
+func (g *GeneradorTalonarios) dibujarTexto(img *image.RGBA, face font.Face, texto string, x, y int, col color.RGBA) {
+	g.dibujarTextoDegradado(img, face, texto, x, y, col, nil)
+}
+
+// dibujarNumero escribe el número de una boleta con dibujarTextoDegradado,
+// en ColorTexto o con GradienteTexto si se definió.
+func (g *GeneradorTalonarios) dibujarNumero(img *image.RGBA, face font.Face, texto string, x, y int) {
+	g.dibujarTextoDegradado(img, face, texto, x, y, g.config.ColorTexto, g.config.GradienteTexto)
+}
+
+// dibujarTextoDegradado escribe texto con la sombra de SombraTexto, si está
+// activa. Con GrosorContorno primero lo repite desplazado en el color de
+// contorno dentro de un disco de ese radio y luego dibuja el relleno encima,
+// así que el ancho medido no cambia. El relleno es col o, si gradiente no
+// está vacío, el gradiente.
+func (g *GeneradorTalonarios) dibujarTextoDegradado(img *image.RGBA, face font.Face, texto string, x, y int, col color.RGBA, gradiente []color.RGBA) {
+	trazar := g.dibujarTextoCon
+	if g.config.EspaciadoLetras > 0 {
+		trazar = g.dibujarTextoEspaciado
+	}
+	// La sombra copia la silueta del texto con su contorno, desplazada
+	if g.config.SombraTexto {
+		sx, sy := g.config.DesplazamientoSombraX, g.config.DesplazamientoSombraY
+		if sx == 0 && sy == 0 {
+			sx, sy = 2, 2
+		}
+		sombra := g.config.ColorSombra
+		if sombra == (color.RGBA{}) {
+			sombra = color.RGBA{0, 0, 0, 160}
+		}
+		g.trazarContorno(trazar, img, face, texto, x+sx, y+sy, sombra)
+		trazar(img, face, texto, x+sx, y+sy, sombra)
+	}
+	if g.config.GrosorContorno > 0 {
+		contorno := g.config.ContornoTexto
+		if contorno == (color.RGBA{}) {
+			contorno = color.RGBA{0, 0, 0, 255}
+		}
+		g.trazarContorno(trazar, img, face, texto, x, y, contorno)
+	}
+	if len(gradiente) > 0 {
+		g.rellenarGradiente(img, face, texto, x, y, gradiente)
+		return
+	}
+	trazar(img, face, texto, x, y, col)
+}
+
+// rellenarGradiente dibuja texto runa por runa, avanzando como
+// dibujarTextoEspaciado, y pinta cada una del color de gradiente que cae en
+// su centro a lo largo del ancho del texto.
+func (g *GeneradorTalonarios) rellenarGradiente(img *image.RGBA, face font.Face, texto string, x, y int, gradiente []color.RGBA) {
+	ancho := max(g.anchoNumero(face, texto), 1)
+	d := &font.Drawer{
+		Dst:  img,
+		Face: face,
+		Dot:  fixed.P(x, g.lineaBase(face, y)),
+	}
+
+	anterior := rune(-1)
+	for _, r := range texto {
+		if anterior >= 0 {
+			d.Dot.X += face.Kern(anterior, r) + fixed.I(g.config.EspaciadoLetras)
+		}
+		avance, _ := face.GlyphAdvance(r)
+		centro := (d.Dot.X + avance/2).Round() - x
+		d.Src = &image.Uniform{colorEnGradiente(gradiente, float64(centro)/float64(ancho))}
+		d.DrawString(string(r))
+		anterior = r
+	}
+}
+
+// colorEnGradiente interpola linealmente entre los colores de gradiente,
+// repartidos a distancias iguales, en la posición t entre 0 y 1.
+func colorEnGradiente(gradiente []color.RGBA, t float64) color.RGBA {
+	if len(gradiente) == 1 {
+		return gradiente[0]
+	}
+	t = math.Max(0, math.Min(t, 1)) * float64(len(gradiente)-1)
+	i := min(int(t), len(gradiente)-2)
+	f := t - float64(i)
+	a, b := gradiente[i], gradiente[i+1]
+	mezclar := func(p, q uint8) uint8 {
+		return uint8(math.Round(float64(p) + (float64(q)-float64(p))*f))
+	}
+	return color.RGBA{mezclar(a.R, b.R), mezclar(a.G, b.G), mezclar(a.B, b.B), mezclar(a.A, b.A)}
+}
+
+// trazarContorno repite trazar en cada desplazamiento dentro de un círculo
+// de radio GrosorContorno, sin el centro.
+func (g *GeneradorTalonarios) trazarContorno(trazar func(*image.RGBA, font.Face, string, int, int, color.RGBA), img *image.RGBA, face font.Face, texto string, x, y int, col color.RGBA) {
+	r := g.config.GrosorContorno
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			if (dx != 0 || dy != 0) && dx*dx+dy*dy <= r*r {
+				trazar(img, face, texto, x+dx, y+dy, col)
+			}
+		}
+	}
+}
+
+// anchoNumero mide texto como lo dibuja dibujarTexto, con EspaciadoLetras.
+func (g *GeneradorTalonarios) anchoNumero(face font.Face, texto string) int {
+	return font.MeasureString(face, texto).Round() + g.espaciadoTotal(texto)
+}
+
+// espaciadoTotal son los píxeles que EspaciadoLetras agrega a texto: uno por
+// cada hueco entre caracteres.
+func (g *GeneradorTalonarios) espaciadoTotal(texto string) int {
+	return g.config.EspaciadoLetras * max(utf8.RuneCountInString(texto)-1, 0)
+}
+
+// dibujarTextoEspaciado funciona como dibujarTextoCon pero dibuja cada
+// carácter por separado, avanzando lo de la fuente (con su interletraje) más
+// EspaciadoLetras.
+func (g *GeneradorTalonarios) dibujarTextoEspaciado(img *image.RGBA, face font.Face, texto string, x, y int, col color.RGBA) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  &image.Uniform{col},
+		Face: face,
+		Dot:  fixed.P(x, g.lineaBase(face, y)),
+	}
+
+	anterior := rune(-1)
+	for _, r := range texto {
+		if anterior >= 0 {
+			d.Dot.X += face.Kern(anterior, r) + fixed.I(g.config.EspaciadoLetras)
+		}
+		d.DrawString(string(r))
+		anterior = r
+	}
+}
+
+// lineaBase convierte el centro vertical y del texto en su línea base: el
+// centro queda a medio camino entre el ascenso y el descenso de la fuente.
+func (g *GeneradorTalonarios) lineaBase(face font.Face, y int) int {
+	metrics := face.Metrics()
+	return y + ((metrics.Ascent - metrics.Descent) / 2).Round()
+}
+
+// centroTexto devuelve el centro vertical, tal como lo recibe dibujarTexto,
+// para alinear el texto arriba, al centro o abajo del espacio [y, y+alto],
+// separado margen píxeles del borde.
+func (g *GeneradorTalonarios) centroTexto(face font.Face, y, alto, margen int, alineacion string) int {
+	metrics := face.Metrics()
+	mitad := ((metrics.Ascent + metrics.Descent) / 2).Ceil()
+	switch alineacion {
+	case "arriba":
+		return y + margen + mitad
+	case "abajo":
+		return y + alto - margen - mitad
+	}
+	return y + alto/2
+}
+
+func (g *GeneradorTalonarios) dibujarTextoCon(img *image.RGBA, face font.Face, texto string, x, y int, col color.RGBA) {
+
+	yCentrado := g.lineaBase(face, y)
+
+	point := fixed.Point26_6{
+		X: fixed.Int26_6(x * 64),
+		Y: fixed.Int26_6(yCentrado * 64),
+	}
+
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  &image.Uniform{col},
+		Face: face,
+		Dot:  point,
+	}
+
+	d.DrawString(texto)
+}
+
+// componerHoja acomoda varios talonarios ya renderizados en una cuadrícula
+// sobre una sola imagen, separados por EspaciadoHoja píxeles.
+func (g *GeneradorTalonarios) componerHoja(imagenes []*image.RGBA) *image.RGBA {
+	ancho := imagenes[0].Bounds().Dx()
+	alto := imagenes[0].Bounds().Dy()
+	espacio := g.config.EspaciadoHoja
+
+	columnas := g.config.ColumnasHoja
+	if columnas <= 0 {
+		columnas = int(math.Ceil(math.Sqrt(float64(g.config.TalonariosPorHoja))))
+	}
+	filas := (g.config.TalonariosPorHoja + columnas - 1) / columnas
+
+	hoja := image.NewRGBA(image.Rect(0, 0,
+		columnas*ancho+(columnas-1)*espacio,
+		filas*alto+(filas-1)*espacio))
+
+	// El espacio entre talonarios queda en blanco, como el papel
+	draw.Draw(hoja, hoja.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+
+	for i, img := range imagenes {
+		x := (i % columnas) * (ancho + espacio)
+		y := (i / columnas) * (alto + espacio)
+		draw.Draw(hoja, image.Rect(x, y, x+ancho, y+alto), img, img.Bounds().Min, draw.Src)
+	}
+
+	return hoja
+}
+
+// crearArchivo y esperaReintento se reemplazan en las pruebas.
+var (
+	crearArchivo    = func(nombre string) (io.WriteCloser, error) { return os.Create(nombre) }
+	esperaReintento = 200 * time.Millisecond
+)
+
+// guardarImagen escribe img en nombreArchivo. Los errores de E/S se reintentan
+// hasta ReintentosEscritura veces, duplicando la espera entre intentos; los
+// permanentes (permisos, carpeta inexistente) fallan de inmediato.
+func (g *GeneradorTalonarios) guardarImagen(img *image.RGBA, nombreArchivo string) error {
+	// Lo ya escrito en la salida estándar no se puede rehacer: sin reintentos.
+	if g.config.CarpetaSalida == salidaEstandar {
+		return g.codificarImagen(escritorEstandar, img)
+	}
+	espera := esperaReintento
+	for intento := 0; ; intento++ {
+		err := g.escribirImagen(img, nombreArchivo)
+		if err == nil || intento >= g.config.ReintentosEscritura || errorPermanente(err) {
+			return err
+		}
+		g.logger.Warn("error escribiendo imagen, reintentando",
+			"archivo", nombreArchivo, "intento", intento+1, "de", g.config.ReintentosEscritura, "espera", espera, "error", err)
+		time.Sleep(espera)
+		espera *= 2
+	}
+}
+
+func (g *GeneradorTalonarios) escribirImagen(img *image.RGBA, nombreArchivo string) error {
+	file, err := crearArchivo(nombreArchivo)
+	if err != nil {
+		return err
+	}
+	if err := g.codificarImagen(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// salidaEstandar como CarpetaSalida escribe la única imagen de la corrida en
+// escritorEstandar en vez de un archivo, para usarla en una tubería.
+const salidaEstandar = "-"
+
+// escritorEstandar se reemplaza en las pruebas.
+var escritorEstandar io.Writer = os.Stdout
+
+// errorPermanente indica si reintentar la escritura no tiene sentido.
+func errorPermanente(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid)
+}
+
+// codificarImagen escribe img en w con el formato de salida configurado.
+func (g *GeneradorTalonarios) codificarImagen(w io.Writer, img *image.RGBA) error {
+	img = g.corregirAspecto(img)
+	switch strings.ToLower(g.config.FormatoSalida) {
+	case "tiff", "tif":
+		if strings.ToLower(g.config.EspacioColor) == "cmyk" {
+			dpi := g.config.DPI
+			if dpi <= 0 {
+				dpi = 300
+			}
+			return escribirTIFFCMYK(w, convertirCMYK(img), dpi, strings.ToLower(g.config.CompresionTIFF) == "deflate")
+		}
+		compresion := tiff.Uncompressed
+		if strings.ToLower(g.config.CompresionTIFF) == "deflate" {
+			compresion = tiff.Deflate
+		}
+		return tiff.Encode(w, img, &tiff.Options{Compression: compresion})
+	default:
+		if !g.config.MetadatosPNG {
+			return g.codificadorPNG.Encode(w, img)
+		}
+		var buf bytes.Buffer
+		if err := g.codificadorPNG.Encode(&buf, img); err != nil {
+			return err
+		}
+		return escribirPNGConTexto(w, buf.Bytes(), "IDCorrida", g.idCorrida)
+	}
+}
+
+var nivelesCompresionPNG = map[string]png.CompressionLevel{
+	"":        png.DefaultCompression,
+	"defecto": png.DefaultCompression,
+	"ninguna": png.NoCompression,
+	"rapida":  png.BestSpeed,
+	"maxima":  png.BestCompression,
+}
+
+// poolBuffersPNG reutiliza los búferes del codificador PNG entre imágenes.
+type poolBuffersPNG struct {
+	sync.Pool
+}
+
+func (p *poolBuffersPNG) Get() *png.EncoderBuffer {
+	b, _ := p.Pool.Get().(*png.EncoderBuffer)
+	return b
+}
+
+func (p *poolBuffersPNG) Put(b *png.EncoderBuffer) {
+	p.Pool.Put(b)
+}
+
+// escribirPNGConTexto copia en w el PNG codificado datos con un fragmento
+// tEXt clave=valor justo después de IHDR, que png.Encode no permite agregar.
+func escribirPNGConTexto(w io.Writer, datos []byte, clave, valor string) error {
+	// Firma de 8 bytes e IHDR: longitud, tipo, 13 bytes de datos y CRC.
+	const finIHDR = 8 + 4 + 4 + 13 + 4
+	if len(datos) < finIHDR {
+		return errors.New("PNG demasiado corto")
+	}
+
+	contenido := append([]byte("tEXt"+clave+"\x00"), valor...)
+	fragmento := binary.BigEndian.AppendUint32(nil, uint32(len(contenido)-4))
+	fragmento = append(fragmento, contenido...)
+	fragmento = binary.BigEndian.AppendUint32(fragmento, crc32.ChecksumIEEE(contenido))
+
+	for _, parte := range [][]byte{datos[:finIHDR], fragmento, datos[finIHDR:]} {
+		if _, err := w.Write(parte); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nuevoUUID devuelve un UUID aleatorio (versión 4) de crypto/rand.
+func nuevoUUID() string {
+	var b [16]byte
+	crand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// nombreImagen arma la ruta de la imagen numero de tipo "talonario" u "hoja".
+func (g *GeneradorTalonarios) nombreImagen(tipo string, numero int) string {
+	nombre := fmt.Sprintf("%s_%03d", tipo, numero)
+	if g.config.IDCorridaEnNombres {
+		nombre += "_" + g.idCorrida
+	}
+	return filepath.Join(g.config.CarpetaSalida, nombre+g.extensionSalida())
+}
+
+// nombreBoleta arma la ruta de la imagen de una boleta con UnArchivoPorBoleta,
+// con el número rellenado como se imprime.
+func (g *GeneradorTalonarios) nombreBoleta(boleta Boleta) string {
+	nombre := "boleta_" + g.digitosNumero(boleta.Numero)
+	if g.config.IDCorridaEnNombres {
+		nombre += "_" + g.idCorrida
+	}
+	return filepath.Join(g.config.CarpetaSalida, nombre+g.extensionSalida())
+}
+
+// nombreReverso arma la ruta del reverso del talonario numero, junto a la
+// del frente.
+func (g *GeneradorTalonarios) nombreReverso(numero int) string {
+	frente := g.nombreImagen("talonario", numero)
+	return strings.TrimSuffix(frente, g.extensionSalida()) + "_reverso" + g.extensionSalida()
+}
+
+// IDCorrida devuelve el identificador de la corrida, el de Config o el UUID
+// generado al crear el generador.
+func (g *GeneradorTalonarios) IDCorrida() string {
+	return g.idCorrida
+}
+
+// corregirAspecto compensa impresoras de píxeles no cuadrados escalando el
+// ancho por CorreccionAspecto, la resolución horizontal dividida por la
+// vertical. Valores típicos: 1 para impresoras térmicas de 203×203 o 300×300
+// DPI; 2 para modos de 203×101 DPI, con píxeles el doble de altos que anchos;
+// 0.5 para 180×360 DPI.
+func (g *GeneradorTalonarios) corregirAspecto(img *image.RGBA) *image.RGBA {
+	factor := g.config.CorreccionAspecto
+	if factor == 0 || factor == 1 {
+		return img
+	}
+	ancho := max(int(math.Round(float64(img.Bounds().Dx())*factor)), 1)
+	return g.escalarImagen(img, ancho, img.Bounds().Dy()).(*image.RGBA)
+}
+
+func (g *GeneradorTalonarios) extensionSalida() string {
+	switch strings.ToLower(g.config.FormatoSalida) {
+	case "tiff", "tif":
+		return ".tiff"
+	default:
+		return ".png"
+	}
+}
+
+// GenerarTodos sortea, dibuja y escribe todos los talonarios. La generación
+// es secuencial: el registro "números asignados", GenerarJSON y el manifiesto
+// salen siempre en orden de ID, el mismo de los nombres de archivo. Si algún
+// día se dibuja en paralelo, los resultados deben reordenarse antes de
+// registrarse para conservar esa salida. Con ContinuarEnError un talonario
+// que no se puede guardar no detiene la corrida: el error final los reúne con
+// errors.Join y Estadisticas().Fallidos dice cuáles regenerar.
+//
+// Cada generador sirve para una sola corrida: los números sorteados no vuelven
+// al rango, así que una segunda llamada, o una después de GenerarStream o
+// Talonarios, devuelve ErrGeneradorUsado. Un generador no se puede usar desde varias
+// goroutines a la vez.
+func (g *GeneradorTalonarios) GenerarTodos() error {
+	return g.GenerarTodosContext(context.Background())
+}
+
+// GenerarTodosContext funciona como GenerarTodos pero se detiene al cancelarse
+// ctx; los talonarios ya escritos se conservan.
+func (g *GeneradorTalonarios) GenerarTodosContext(ctx context.Context) error {
+	if err := g.empezarSorteo(); err != nil {
+		return err
+	}
+
+	g.logger.Info("generando talonarios", "id_corrida", g.idCorrida,
+		"talonarios", g.config.CantidadPaginas, "boletas_por_talonario", g.config.BoletasPorPagina)
+
+	comienzo := time.Now()
+	var duraciones []time.Duration
+	g.estadisticas = EstadisticasGeneracion{}
+	var errs []error
+
+	var hoja []*image.RGBA
+
+	inicio := g.config.ComenzarDesde
+	if g.config.TalonariosPorHoja > 1 && inicio > 1 {
+		// Se rehace la hoja completa que contiene al talonario pedido
+		inicio = (inicio-1)/g.config.TalonariosPorHoja*g.config.TalonariosPorHoja + 1
+	}
+	if inicio > 1 {
+		if g.config.Semilla == 0 {
+			g.logger.Warn("se reanuda sin Semilla fija: los números no coincidirán con la corrida original")
+		}
+		g.logger.Info("reanudando generación", "desde", inicio)
+	}
+
+	ultimo := g.config.CantidadPaginas
+	if g.config.SoloPrimera {
+		ultimo = 1
+	}
+
+	var rollo *salidaRollo
+	if g.config.ModoRollo {
+		var err error
+		if rollo, err = g.abrirRollo(g.talonariosRollo()); err != nil {
+			g.logger.Error("error creando rollo", "archivo", g.nombreRollo(), "error", err)
+			return err
+		}
+		defer rollo.descartar()
+	}
+
+	for i := 1; i <= ultimo; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if i < inicio {
+			talonario, err := g.crearTalonario(i)
+			if err != nil {
+				g.logger.Error("error creando talonario", "id", i, "error", err)
+				return err
+			}
+			g.talonarios = append(g.talonarios, talonario)
+			continue
+		}
+
+		g.logger.Info("generando talonario", "id", i, "total", g.config.CantidadPaginas)
+
+		talonario, err := g.crearTalonario(i)
+		if err != nil {
+			g.logger.Error("error creando talonario", "id", i, "error", err)
+			return err
+		}
+		g.talonarios = append(g.talonarios, talonario)
+
+		inicioDibujo := time.Now()
+		var img *image.RGBA
+		if !g.config.UnArchivoPorBoleta && rollo == nil {
+			// Con UnArchivoPorBoleta y ModoRollo cada boleta se dibuja al guardarla
+			img = g.crearImagenTalonario(talonario)
+			if g.config.PostProcesar != nil {
+				if err := g.config.PostProcesar(i, img); err != nil {
+					g.logger.Error("error en PostProcesar", "id", i, "error", err)
+					return fmt.Errorf("error en PostProcesar del talonario %d: %v", i, err)
+				}
+			}
+		}
+		dibujo := time.Since(inicioDibujo)
+		inicioGuardado := time.Now()
+
+		if rollo != nil {
+			// El rollo es un solo flujo: un error lo deja inservible
+			if err := rollo.agregarTalonario(g, talonario); err != nil {
+				g.logger.Error("error escribiendo rollo", "id", i, "archivo", rollo.nombre, "error", err)
+				return err
+			}
+		} else if g.config.TalonariosPorHoja > 1 {
+			hoja = append(hoja, img)
+			if len(hoja) == g.config.TalonariosPorHoja || i == ultimo {
+				numeroHoja := (i + g.config.TalonariosPorHoja - 1) / g.config.TalonariosPorHoja
+				nombreArchivo := g.nombreImagen("hoja", numeroHoja)
+				if err := g.guardarImagen(g.componerHoja(hoja), nombreArchivo); err != nil {
+					g.logger.Error("error guardando hoja", "hoja", numeroHoja, "archivo", nombreArchivo, "error", err)
+					err = fmt.Errorf("error guardando hoja %d: %v", numeroHoja, err)
+					if !g.config.ContinuarEnError {
+						return err
+					}
+					errs = append(errs, err)
+					for id := i - len(hoja) + 1; id <= i; id++ {
+						g.estadisticas.Fallidos = append(g.estadisticas.Fallidos, id)
+					}
+				}
+				hoja = nil
+			}
+		} else {
+			nombreArchivo := g.nombreImagen("talonario", i)
+			var err error
+			if g.config.UnArchivoPorBoleta {
+				nombreArchivo, err = g.guardarBoletas(talonario)
+			} else {
+				err = g.guardarImagen(img, nombreArchivo)
+			}
+			if err == nil && g.config.GenerarReverso {
+				nombreArchivo = g.nombreReverso(i)
+				err = g.guardarImagen(g.crearImagenReverso(talonario), nombreArchivo)
+			}
+			if err != nil {
+				g.logger.Error("error guardando talonario", "id", i, "archivo", nombreArchivo, "error", err)
+				err = fmt.Errorf("error guardando talonario %d: %v", i, err)
+				if !g.config.ContinuarEnError {
+					return err
+				}
+				errs = append(errs, err)
+				g.estadisticas.Fallidos = append(g.estadisticas.Fallidos, i)
+			}
+		}
+
+		guardado := time.Since(inicioGuardado)
+		g.estadisticas.Dibujo += dibujo
+		g.estadisticas.Guardado += guardado
+		if d := dibujo + guardado; d > g.estadisticas.DuracionMasLento {
+			g.estadisticas.MasLento, g.estadisticas.DuracionMasLento = i, d
+		}
+		duraciones = append(duraciones, dibujo+guardado)
+
+		numeros := make([]string, len(talonario.Boletas))
+		for j, boleta := range talonario.Boletas {
+			numeros[j] = boleta.Formateado
+		}
+		g.logger.Info("números asignados", "id", i, "numeros", strings.Join(numeros, ", "), "suma", talonario.Suma)
+	}
 
-func NewGeneradorTalonarios(config Config) (*GeneradorTalonarios, error) {
-	gen := &GeneradorTalonarios{
-		config:        config,
-		numerosUsados: make(map[int]bool),
+	if rollo != nil {
+		if err := rollo.terminar(); err != nil {
+			g.logger.Error("error cerrando rollo", "archivo", rollo.nombre, "error", err)
+			return err
+		}
 	}
 
-	gen.digitosFormato = len(strconv.Itoa(config.NumeroMaximo))
+	if g.config.VerificarDuplicados {
+		if duplicados := VerificarCopias(g.talonarios, g.copias()); len(duplicados) > 0 {
+			g.logger.Error("números duplicados en la salida", "duplicados", duplicados, "copias", g.copias())
+			return fmt.Errorf("se encontraron %d números duplicados: %v", len(duplicados), duplicados)
+		}
+		g.logger.Info("verificación de unicidad correcta", "talonarios", len(g.talonarios))
+	}
 
-	if err := gen.validarConfig(); err != nil {
-		return nil, err
+	if g.config.Manifiesto {
+		ruta := filepath.Join(g.config.CarpetaSalida, "manifiesto.json")
+		if err := g.EscribirManifiesto(ruta); err != nil {
+			g.logger.Error("error escribiendo manifiesto", "archivo", ruta, "error", err)
+			return err
+		}
 	}
 
-	if config.RutaFuente != "" {
-		if err := gen.cargarFuentePersonalizada(); err != nil {
-			fmt.Printf("⚠️  Advertencia: No se pudo cargar la fuente personalizada (%v), usando fuente por defecto\n", err)
-			gen.config.Fuente = basicfont.Face7x13
+	if g.config.ArchivoJSON != "" {
+		if err := g.GenerarJSON(g.config.ArchivoJSON); err != nil {
+			g.logger.Error("error escribiendo JSON", "archivo", g.config.ArchivoJSON, "error", err)
+			return err
 		}
-	} else {
-		gen.config.Fuente = basicfont.Face7x13
 	}
 
-	if config.ImagenBase != "" {
-		if err := gen.cargarImagenBase(); err != nil {
-			return nil, fmt.Errorf("error cargando imagen base: %v", err)
+	if g.config.ArchivoIndice != "" {
+		if err := g.GenerarIndice(g.config.ArchivoIndice); err != nil {
+			g.logger.Error("error escribiendo índice", "archivo", g.config.ArchivoIndice, "error", err)
+			return err
 		}
 	}
 
-	if err := os.MkdirAll(config.CarpetaSalida, 0755); err != nil {
-		return nil, fmt.Errorf("error creando carpeta de salida: %v", err)
+	g.estadisticas.completar(duraciones, time.Since(comienzo))
+	e := g.estadisticas
+	if len(e.Fallidos) > 0 {
+		g.logger.Error("talonarios sin escribir", "fallidos", e.Fallidos, "escritos", e.Talonarios-len(e.Fallidos))
+		resumen := fmt.Errorf("no se escribieron %d talonarios: %v", len(e.Fallidos), e.Fallidos)
+		return errors.Join(append([]error{resumen}, errs...)...)
 	}
+	g.logger.Info("todos los talonarios generados", "carpeta", g.config.CarpetaSalida,
+		"duracion", e.Total, "promedio", e.Promedio, "mediana", e.Mediana,
+		"mas_lento", e.MasLento, "duracion_mas_lento", e.DuracionMasLento)
+	return nil
+}
 
-	return gen, nil
+// EstadisticasGeneracion resume los tiempos de la última llamada a
+// GenerarTodos. El tiempo de cada talonario es su dibujo más su guardado;
+// con TalonariosPorHoja el guardado de la hoja se cuenta en el talonario que
+// la completa.
+type EstadisticasGeneracion struct {
+	Talonarios       int           // talonarios dibujados; los saltados por ComenzarDesde no cuentan
+	Total            time.Duration // toda la corrida, incluidos sorteo, JSON y manifiesto
+	Dibujo           time.Duration // suma de crearImagenTalonario
+	Guardado         time.Duration // suma de guardarImagen
+	Promedio         time.Duration
+	Mediana          time.Duration
+	MasLento         int // ID del talonario más lento
+	DuracionMasLento time.Duration
+	Fallidos         []int // con ContinuarEnError, IDs de los talonarios que no se pudieron guardar
 }
 
-func (g *GeneradorTalonarios) cargarFuentePersonalizada() error {
-	if _, err := os.Stat(g.config.RutaFuente); os.IsNotExist(err) {
-		return fmt.Errorf("el archivo de fuente no existe: %s", g.config.RutaFuente)
+func (e *EstadisticasGeneracion) completar(duraciones []time.Duration, total time.Duration) {
+	e.Talonarios = len(duraciones)
+	e.Total = total
+	if len(duraciones) == 0 {
+		return
 	}
+	e.Promedio = (e.Dibujo + e.Guardado) / time.Duration(len(duraciones))
 
-	fontBytes, err := os.ReadFile(g.config.RutaFuente)
-	if err != nil {
-		return fmt.Errorf("error leyendo archivo de fuente: %v", err)
+	ordenadas := slices.Clone(duraciones)
+	slices.Sort(ordenadas)
+	mitad := len(ordenadas) / 2
+	e.Mediana = ordenadas[mitad]
+	if len(ordenadas)%2 == 0 {
+		e.Mediana = (ordenadas[mitad-1] + ordenadas[mitad]) / 2
 	}
+}
 
-	f, err := opentype.Parse(fontBytes)
+// Estadisticas devuelve los tiempos de la última llamada a GenerarTodos.
+func (g *GeneradorTalonarios) Estadisticas() EstadisticasGeneracion {
+	return g.estadisticas
+}
+
+type manifiesto struct {
+	IDCorrida string         `json:"id_corrida"`
+	Version   string         `json:"version"`
+	Generado  string         `json:"generado"`
+	Semilla   int64          `json:"semilla"`
+	Config    map[string]any `json:"config"`
+}
+
+// EscribirManifiesto guarda en ruta la configuración efectiva de la corrida,
+// con la semilla realmente usada, para poder auditarla o repetirla. La
+// fuente se registra por su ruta y tamaño; la sección "config" puede
+// cargarse de nuevo con CargarConfig.
+func (g *GeneradorTalonarios) EscribirManifiesto(ruta string) error {
+	efectiva := g.config
+	efectiva.Semilla = g.semilla
+	// Repetir la corrida desde el manifiesto es otra corrida, con su propio ID
+	efectiva.IDCorrida = ""
+
+	valores, err := configAMapa(efectiva)
 	if err != nil {
-		return fmt.Errorf("error parseando fuente: %v", err)
+		return fmt.Errorf("error serializando configuración: %v", err)
 	}
 
-	face, err := opentype.NewFace(f, &opentype.FaceOptions{
-		Size:    g.config.TamanoFuente,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
+	datos, err := json.MarshalIndent(manifiesto{
+		IDCorrida: g.idCorrida,
+		Version:   versionPrograma(),
+		Generado:  time.Now().Format(time.RFC3339),
+		Semilla:   g.semilla,
+		Config:    valores,
+	}, "", "  ")
 	if err != nil {
-		return fmt.Errorf("error creando face de fuente: %v", err)
+		return fmt.Errorf("error serializando manifiesto: %v", err)
 	}
 
-	g.config.Fuente = face
-	fmt.Printf("✅ Fuente personalizada cargada: %s (tamaño: %.1f)\n", g.config.RutaFuente, g.config.TamanoFuente)
+	if err := os.WriteFile(ruta, append(datos, '\n'), 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %v", ruta, err)
+	}
+
+	g.logger.Info("manifiesto escrito", "archivo", ruta)
 	return nil
 }
 
-func (g *GeneradorTalonarios) validarConfig() error {
-	totalNumeros := g.config.NumeroMaximo - g.config.NumeroMinimo + 1
-	numerosNecesarios := g.config.BoletasPorPagina * g.config.CantidadPaginas
+func versionPrograma() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
 
-	if numerosNecesarios > totalNumeros {
-		return fmt.Errorf("no hay suficientes números: necesitas %d pero solo hay %d disponibles",
-			numerosNecesarios, totalNumeros)
+// VerificarUnicidad devuelve, en orden ascendente, los números que aparecen en
+// más de una boleta de los talonarios dados.
+func VerificarUnicidad(talonarios []Talonario) (duplicados []int) {
+	return VerificarCopias(talonarios, 1)
+}
+
+// VerificarCopias devuelve, en orden ascendente, los números que no aparecen
+// exactamente copias veces en los talonarios dados (ver CopiasPorNumero). Con
+// NumerosPorBoleta cada nivel se cuenta por separado, porque un mismo número
+// puede salir una vez en cada nivel.
+func VerificarCopias(talonarios []Talonario, copias int) (incorrectos []int) {
+	type clave struct{ nivel, numero int }
+	apariciones := make(map[clave]int)
+	for _, talonario := range talonarios {
+		for _, boleta := range talonario.Boletas {
+			apariciones[clave{0, boleta.Numero}]++
+			for k, adicional := range boleta.Adicionales {
+				apariciones[clave{k + 1, adicional.Numero}]++
+			}
+		}
 	}
 
-	if g.config.BoletasPorPagina <= 0 || g.config.CantidadPaginas <= 0 {
-		return errors.New("la cantidad de boletas y páginas debe ser mayor a 0")
+	for c, n := range apariciones {
+		if n != copias {
+			incorrectos = append(incorrectos, c.numero)
+		}
 	}
+	slices.Sort(incorrectos)
+	return slices.Compact(incorrectos)
+}
 
-	if g.config.BoletasPorFila <= 0 {
-		return errors.New("el número de boletas por fila debe ser mayor a 0")
+// GenerarJSON escribe en ruta los talonarios generados por GenerarTodos, con
+// los mismos números que se dibujaron en las imágenes.
+func (g *GeneradorTalonarios) GenerarJSON(ruta string) error {
+	if len(g.talonarios) == 0 {
+		return errors.New("no hay talonarios generados para exportar")
 	}
 
-	if g.config.MargenSuperior < 0 || g.config.MargenInferior < 0 ||
-		g.config.MargenIzquierdo < 0 || g.config.MargenDerecho < 0 {
-		return errors.New("los márgenes deben ser positivos o cero")
+	var datos []byte
+	var err error
+	if g.config.JSONLegible {
+		datos, err = json.MarshalIndent(g.talonarios, "", "  ")
+	} else {
+		datos, err = json.Marshal(g.talonarios)
+	}
+	if err != nil {
+		return fmt.Errorf("error serializando talonarios: %v", err)
+	}
+
+	if err := os.WriteFile(ruta, append(datos, '\n'), 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %v", ruta, err)
 	}
 
+	g.logger.Info("números exportados a JSON", "archivo", ruta, "talonarios", len(g.talonarios))
 	return nil
 }
 
-func (g *GeneradorTalonarios) cargarImagenBase() error {
-	file, err := os.Open(g.config.ImagenBase)
-	if err != nil {
-		return err
+// Medidas fijas del índice de miniaturas, en píxeles.
+const (
+	espaciadoIndice    = 8
+	altoEtiquetaIndice = 16
+)
+
+// GenerarIndice escribe en ruta una sola imagen con una miniatura de cada
+// talonario generado por GenerarTodos, en una cuadrícula casi cuadrada. Los
+// talonarios se vuelven a dibujar de uno en uno, así que solo una imagen a
+// tamaño completo queda en memoria a la vez.
+func (g *GeneradorTalonarios) GenerarIndice(ruta string) error {
+	if len(g.talonarios) == 0 {
+		return errors.New("no hay talonarios generados para el índice")
 	}
-	defer file.Close()
 
-	ext := strings.ToLower(filepath.Ext(g.config.ImagenBase))
-	switch ext {
-	case ".jpg", ".jpeg":
-		g.imagenBase, err = jpeg.Decode(file)
-	case ".png":
-		g.imagenBase, err = png.Decode(file)
-	default:
-		g.imagenBase, _, err = image.Decode(file)
+	ancho := g.config.AnchoMiniatura
+	if ancho <= 0 {
+		ancho = 120
+	}
+	muestra := g.crearImagenTalonario(g.talonarios[0])
+	alto := max(ancho*muestra.Bounds().Dy()/muestra.Bounds().Dx(), 1)
+	altoCelda := alto
+	if g.config.EtiquetarIndice {
+		altoCelda += altoEtiquetaIndice
 	}
 
-	return err
-}
+	columnas := int(math.Ceil(math.Sqrt(float64(len(g.talonarios)))))
+	filas := (len(g.talonarios) + columnas - 1) / columnas
+	indice := image.NewRGBA(image.Rect(0, 0,
+		columnas*ancho+(columnas+1)*espaciadoIndice,
+		filas*altoCelda+(filas+1)*espaciadoIndice))
+	draw.Draw(indice, indice.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
 
-func (g *GeneradorTalonarios) generarNumeroAleatorio() int {
-	for {
-		numero := rand.Intn(g.config.NumeroMaximo-g.config.NumeroMinimo+1) + g.config.NumeroMinimo
-		if !g.numerosUsados[numero] {
-			g.numerosUsados[numero] = true
-			return numero
+	negro := color.RGBA{0, 0, 0, 255}
+	for i, talonario := range g.talonarios {
+		img := muestra
+		if i > 0 {
+			img = g.crearImagenTalonario(talonario)
+		}
+		x := espaciadoIndice + (i%columnas)*(ancho+espaciadoIndice)
+		y := espaciadoIndice + (i/columnas)*(altoCelda+espaciadoIndice)
+		draw.Draw(indice, image.Rect(x, y, x+ancho, y+alto), g.escalarImagen(img, ancho, alto), image.Point{}, draw.Src)
+
+		if g.config.EtiquetarIndice {
+			etiqueta := strconv.Itoa(talonario.ID)
+			xEtiqueta := x + (ancho-font.MeasureString(basicfont.Face7x13, etiqueta).Round())/2
+			g.dibujarTextoCon(indice, basicfont.Face7x13, etiqueta, xEtiqueta, y+alto+altoEtiquetaIndice/2, negro)
 		}
 	}
-}
 
-func (g *GeneradorTalonarios) formatearNumero(numero int) string {
-	formato := fmt.Sprintf("%%0%dd", g.digitosFormato)
-	return fmt.Sprintf(formato, numero)
+	if err := g.guardarImagen(indice, ruta); err != nil {
+		return fmt.Errorf("error escribiendo %s: %v", ruta, err)
+	}
+
+	g.logger.Info("índice de miniaturas escrito", "archivo", ruta, "talonarios", len(g.talonarios))
+	return nil
 }
 
-func (g *GeneradorTalonarios) crearTalonario(id int) Talonario {
-	talonario := Talonario{
-		ID:      id,
-		Boletas: make([]Boleta, g.config.BoletasPorPagina),
+// GenerarPreview dibuja solo el talonario 1 por el mismo camino que la
+// generación completa y lo devuelve sin escribirlo. Usa una copia del estado
+// de sorteo, así que no consume números del generador: con Semilla fija el
+// resultado coincide con el talonario 1 de GenerarTodos.
+func (g *GeneradorTalonarios) GenerarPreview() (*image.RGBA, error) {
+	copia := g.copiaSorteo()
+	talonario, err := copia.crearTalonario(1)
+	if err != nil {
+		return nil, err
 	}
+	return copia.crearImagenTalonario(talonario), nil
+}
 
-	for i := range g.config.BoletasPorPagina {
-		numero := g.generarNumeroAleatorio()
-		talonario.Boletas[i] = Boleta{
-			Numero:     numero,
-			Formateado: g.formatearNumero(numero),
+// RenderizarSoloMemoria sortea y dibuja n talonarios y descarta las imágenes,
+// sin escribir archivos ni mensajes, para medir con go test -bench solo el
+// costo de crearImagenTalonario. Como GenerarPreview, no consume números del
+// generador.
+func (g *GeneradorTalonarios) RenderizarSoloMemoria(n int) error {
+	copia := g.copiaSorteo()
+	copia.logger = slog.New(slog.DiscardHandler)
+	for i := 1; i <= n; i++ {
+		talonario, err := copia.crearTalonario(i)
+		if err != nil {
+			return err
 		}
+		copia.crearImagenTalonario(talonario)
 	}
+	return nil
+}
 
-	return talonario
+// copiaSorteo devuelve una copia del generador con el sorteo reiniciado
+// desde la Semilla.
+func (g *GeneradorTalonarios) copiaSorteo() *GeneradorTalonarios {
+	copia := *g
+	copia.numerosUsados = g.nuevoRegistro()
+	copia.rng = rand.New(rand.NewSource(g.semilla))
+	copia.pendientes = nil
+	copia.niveles = g.nuevosNiveles()
+	copia.talonarios = nil
+	copia.generado = false
+	return &copia
 }
 
-func (g *GeneradorTalonarios) crearImagenTalonario(talonario Talonario) *image.RGBA {
-	img := image.NewRGBA(image.Rect(0, 0, g.config.AnchoTalonario, g.config.AltoTalonario))
+// Estimacion es el resultado de EstimarSalida. Los tamaños en bytes son
+// aproximados: la compresión depende mucho del contenido de las imágenes.
+type Estimacion struct {
+	Archivos        int   // imágenes más JSON y manifiesto, si se piden
+	BytesPorArchivo int64 // tamaño estimado de cada imagen
+	BytesTotales    int64
+	MemoriaPico     int64 // imágenes en memoria a la vez: talonario, base escalada y hoja
+	DiscoLibre      int64 // espacio libre en CarpetaSalida; -1 si no se pudo consultar
+}
 
-	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0, 0, 0, 255}}, image.Point{}, draw.Src)
+// Fracción del tamaño sin comprimir que ocupa una imagen comprimida (PNG o
+// TIFF con deflate): los talonarios sin imagen base ni textura son casi planos
+// y se comprimen mucho; con una foto o una textura de fondo apenas se comprimen.
+const (
+	compresionSinBase = 0.03
+	compresionConBase = 0.6
+)
 
-	if g.imagenBase != nil {
-		imagenEscalada := g.escalarImagen(g.imagenBase, g.config.AnchoTalonario, g.config.AltoTalonario)
-		draw.Draw(img, img.Bounds(), imagenEscalada, image.Point{}, draw.Over)
-	}
+// EstimarSalida calcula de antemano cuántos archivos escribirá GenerarTodos,
+// cuánto ocuparán y cuánta memoria necesita una imagen, y avisa por el logger
+// si el total supera el espacio libre en disco.
+func (g *GeneradorTalonarios) EstimarSalida() Estimacion {
+	ancho := int64(g.config.AnchoTalonario)
+	alto := int64(g.config.AltoTalonario)
+	bytesTalonario := ancho * alto * 4
 
-	filas := (len(talonario.Boletas) + g.config.BoletasPorFila - 1) / g.config.BoletasPorFila
+	inicio := max(g.config.ComenzarDesde, 1)
+	ultimo := g.config.CantidadPaginas
+	if g.config.SoloPrimera {
+		ultimo = 1
+	}
 
-	anchoBoleta := (g.config.AnchoTalonario - g.config.MargenDerecho - g.config.MargenIzquierdo) / g.config.BoletasPorFila
-	altoBoleta := (g.config.AltoTalonario - g.config.MargenSuperior - g.config.MargenInferior) / filas
+	var e Estimacion
+	anchoArchivo, altoArchivo := ancho, alto
+	if n := g.config.TalonariosPorHoja; n > 1 {
+		columnas := int64(g.config.ColumnasHoja)
+		if columnas <= 0 {
+			columnas = int64(math.Ceil(math.Sqrt(float64(n))))
+		}
+		filas := (int64(n) + columnas - 1) / columnas
+		espacio := int64(g.config.EspaciadoHoja)
+		anchoArchivo = columnas*ancho + (columnas-1)*espacio
+		altoArchivo = filas*alto + (filas-1)*espacio
+		e.Archivos = (ultimo+n-1)/n - (inicio-1)/n
+	} else if g.config.ModoRollo {
+		anchoRollo, altoRollo := g.dimensionesRollo(g.talonariosRollo())
+		anchoArchivo, altoArchivo = int64(anchoRollo), int64(altoRollo)
+		e.Archivos = 1
+	} else if g.config.UnArchivoPorBoleta {
+		anchoBoleta, altoBoleta, _ := g.dimensionesBoleta()
+		anchoArchivo, altoArchivo = int64(anchoBoleta), int64(altoBoleta)
+		e.Archivos = (ultimo - inicio + 1) * g.config.BoletasPorPagina
+	} else {
+		e.Archivos = ultimo - inicio + 1
+	}
 
-	g.dibujarLineaSuperior(img, g.config.MargenIzquierdo, g.config.MargenSuperior, g.config.ColorBorde)
+	if f := g.config.CorreccionAspecto; f > 0 {
+		anchoArchivo = int64(math.Round(float64(anchoArchivo) * f))
+	}
+	crudo := anchoArchivo * altoArchivo * 4
+	factor := compresionSinBase
+	if g.imagenBase != nil || g.textura != nil {
+		factor = compresionConBase
+	}
+	if f := strings.ToLower(g.config.FormatoSalida); (f == "tiff" || f == "tif") &&
+		strings.ToLower(g.config.CompresionTIFF) != "deflate" {
+		factor = 1
+	}
+	e.BytesPorArchivo = int64(float64(crudo) * factor)
+	e.BytesTotales = int64(e.Archivos) * e.BytesPorArchivo
+	if factor == compresionConBase && g.textura == nil && g.config.ImagenSoloEn != "" && g.config.ImagenSoloEn != "todos" {
+		// Solo un talonario lleva la imagen base; el resto comprime como liso
+		conBase := 1
+		if g.config.UnArchivoPorBoleta {
+			conBase = g.config.BoletasPorPagina
+		}
+		lisos := int64(max(e.Archivos-conBase, 0))
+		e.BytesTotales -= lisos * (e.BytesPorArchivo - int64(float64(crudo)*compresionSinBase))
+	}
+	if g.config.GenerarReverso {
+		factorReverso := compresionSinBase
+		if g.imagenReverso != nil {
+			factorReverso = compresionConBase
+		}
+		if factor == 1 {
+			factorReverso = 1
+		}
+		e.BytesTotales += int64(e.Archivos) * int64(float64(crudo)*factorReverso)
+		e.Archivos *= 2
+	}
 
-	for i, boleta := range talonario.Boletas {
-		fila := i / g.config.BoletasPorFila
-		columna := i % g.config.BoletasPorFila
+	// Unos 16 bytes de JSON por boleta
+	bytesJSON := int64(g.config.BoletasPorPagina*g.config.CantidadPaginas) * 16
+	if g.config.ArchivoJSON != "" {
+		e.Archivos++
+		e.BytesTotales += bytesJSON
+	}
+	if g.config.Manifiesto {
+		e.Archivos++
+		e.BytesTotales += bytesJSON
+	}
 
-		x := (columna * anchoBoleta) + g.config.MargenIzquierdo
-		y := fila*altoBoleta + g.config.MargenSuperior
+	e.MemoriaPico = bytesTalonario
+	if g.supermuestreo != nil {
+		// El lienzo ampliado, y su imagen base, ocupan factor² veces más
+		f := int64(g.config.Supersampling)
+		e.MemoriaPico += f * f * bytesTalonario
+		if g.imagenBase != nil {
+			e.MemoriaPico += f * f * bytesTalonario
+		}
+	}
+	if g.imagenBase != nil {
+		e.MemoriaPico += bytesTalonario
+	}
+	if g.textura != nil {
+		e.MemoriaPico += bytesTalonario
+	}
+	if g.config.TalonariosPorHoja > 1 {
+		e.MemoriaPico += int64(g.config.TalonariosPorHoja)*bytesTalonario + crudo
+	}
 
-		g.dibujarBoleta(img, boleta, x, y, anchoBoleta, altoBoleta)
+	e.DiscoLibre = espacioLibre(g.config.CarpetaSalida)
+	if e.DiscoLibre >= 0 && e.BytesTotales > e.DiscoLibre {
+		g.logger.Warn("la salida estimada supera el espacio libre en disco",
+			"estimado", e.BytesTotales, "libre", e.DiscoLibre, "carpeta", g.config.CarpetaSalida)
 	}
 
-	return img
+	return e
 }
 
-func (g *GeneradorTalonarios) escalarImagen(src image.Image, ancho, alto int) image.Image {
-	bounds := src.Bounds()
-	dst := image.NewRGBA(image.Rect(0, 0, ancho, alto))
+// empezarSorteo marca el generador como usado, o devuelve ErrGeneradorUsado si
+// ya lo estaba.
+func (g *GeneradorTalonarios) empezarSorteo() error {
+	if g.generado {
+		return ErrGeneradorUsado
+	}
+	g.generado = true
+	return nil
+}
 
-	scaleX := float64(bounds.Dx()) / float64(ancho)
-	scaleY := float64(bounds.Dy()) / float64(alto)
+// GenerarStream genera los talonarios uno a uno y los envía por el canal
+// devuelto, que se cierra al terminar o al cancelarse ctx. No escribe archivos.
+// Como GenerarTodos, sirve una sola vez por generador; mientras el canal siga
+// abierto la goroutine usa el sorteo, así que el generador no admite otras
+// llamadas, tampoco GenerarPreview.
+func (g *GeneradorTalonarios) GenerarStream(ctx context.Context) (<-chan TalonarioResultado, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := g.empezarSorteo(); err != nil {
+		return nil, err
+	}
 
-	for y := range alto {
-		for x := range ancho {
-			srcX := int(float64(x) * scaleX)
-			srcY := int(float64(y) * scaleY)
-			dst.Set(x, y, src.At(bounds.Min.X+srcX, bounds.Min.Y+srcY))
+	resultados := make(chan TalonarioResultado)
+
+	go func() {
+		defer close(resultados)
+
+		for i := 1; i <= g.config.CantidadPaginas; i++ {
+			if ctx.Err() != nil {
+				return
+			}
+
+			talonario, err := g.crearTalonario(i)
+			if err != nil {
+				select {
+				case resultados <- TalonarioResultado{Talonario: Talonario{ID: i}, Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			img := g.crearImagenTalonario(talonario)
+
+			select {
+			case resultados <- TalonarioResultado{Talonario: talonario, Imagen: img}:
+			case <-ctx.Done():
+				return
+			}
 		}
-	}
+	}()
 
-	return dst
+	return resultados, nil
 }
 
-func (g *GeneradorTalonarios) dibujarBoleta(img *image.RGBA, boleta Boleta, x, y, ancho, alto int) {
+// Talonarios sortea los talonarios de a uno, a medida que se piden, sin
+// dibujarlos ni escribir archivos; cortar el range detiene el sorteo. Si ctx
+// se cancela, entrega ctx.Err() y termina. Para las imágenes use GenerarStream.
+// El generador se da por usado al empezar el primer range: uno posterior, o
+// GenerarTodos, entrega ErrGeneradorUsado.
+func (g *GeneradorTalonarios) Talonarios(ctx context.Context) iter.Seq2[Talonario, error] {
+	return func(yield func(Talonario, error) bool) {
+		if err := ctx.Err(); err != nil {
+			yield(Talonario{}, err)
+			return
+		}
+		if err := g.empezarSorteo(); err != nil {
+			yield(Talonario{}, err)
+			return
+		}
 
-	advance := font.MeasureString(g.config.Fuente, "0")
-	anchoCaracter := advance.Round()
-	bordeColor := g.config.ColorBorde
-	g.dibujarRectangulo(img, x, y, ancho, alto, bordeColor)
-	if g.config.OrientacionBoletas == 0 { // Izquierda
-		g.dibujarTexto(img, boleta.Formateado, x+anchoCaracter, y+alto/2, g.config.ColorTexto)
+		for i := 1; i <= g.config.CantidadPaginas; i++ {
+			if err := ctx.Err(); err != nil {
+				yield(Talonario{}, err)
+				return
+			}
+
+			talonario, err := g.crearTalonario(i)
+			if err != nil {
+				yield(Talonario{ID: i}, err)
+				return
+			}
+			if !yield(talonario, nil) {
+				return
+			}
+		}
 	}
-	if g.config.OrientacionBoletas == 1 { // Izquierda
-		g.dibujarTexto(img, boleta.Formateado, x+(ancho/2)-anchoCaracter*g.digitosFormato/2, y+alto/2, g.config.ColorTexto)
+}
+
+// GenerarTandas genera un juego de talonarios por cada tanda de config.Tandas,
+// cada uno en su propia subcarpeta de config.CarpetaSalida. Cada tanda usa un
+// generador nuevo, así que se puede llamar más de una vez con la misma config.
+func GenerarTandas(config Config) error {
+	if len(config.Tandas) == 0 {
+		return errors.New("no hay tandas configuradas")
 	}
-	if g.config.OrientacionBoletas == 2 { // Izquierda
-		g.dibujarTexto(img, boleta.Formateado, x+ancho/g.config.BoletasPorFila-anchoCaracter*(g.digitosFormato+1), y+alto/2, g.config.ColorTexto)
+	if config.CarpetaSalida == salidaEstandar {
+		return fmt.Errorf("las tandas no se pueden escribir en la salida estándar (CarpetaSalida %q)", salidaEstandar)
 	}
-}
 
-func (g *GeneradorTalonarios) dibujarLineaSuperior(img *image.RGBA, x, y int, col color.RGBA) {
-	for i := range g.config.AnchoTalonario - g.config.MargenIzquierdo - g.config.MargenDerecho {
-		if x+i >= img.Bounds().Max.X {
-			continue
+	if config.CompartirNumeros {
+		if len(config.NumerosPredefinidos) > 0 {
+			return errors.New("NumerosPredefinidos no se admite con CompartirNumeros: cada tanda usa la lista completa")
 		}
-		for thick := range g.config.AnchoLineas {
-			if y+thick < img.Bounds().Max.Y {
-				img.Set(x+i, y+thick, col)
-			}
+		if _, err := NumerosRequeridos(config); err != nil {
+			return fmt.Errorf("no alcanzan los números para %d tandas: %v", len(config.Tandas), err)
 		}
 	}
-}
 
-func (g *GeneradorTalonarios) dibujarRectangulo(img *image.RGBA, x, y, ancho, alto int, col color.RGBA) {
-	for i := range ancho {
-		if x+i >= img.Bounds().Max.X {
-			continue
+	var numerosUsados *registroNumeros
+	var nivelesUsados []*registroNumeros
+
+	for i, tema := range config.Tandas {
+		c := config
+		c.Tandas = nil
+
+		nombre := tema.Nombre
+		if nombre == "" {
+			nombre = fmt.Sprintf("tanda_%02d", i+1)
 		}
-		for thick := range g.config.AnchoLineas {
-			if y+alto-1-thick < img.Bounds().Max.Y {
-				img.Set(x+i, y+alto-1-thick, col)
-			}
+		c.CarpetaSalida = filepath.Join(config.CarpetaSalida, nombre)
+
+		if tema.ColorTexto != (color.RGBA{}) {
+			c.ColorTexto = tema.ColorTexto
+		}
+		if tema.ColorBorde != (color.RGBA{}) {
+			c.ColorBorde = tema.ColorBorde
+			c.ColorLinea = tema.ColorBorde
+		}
+		if tema.ColorLinea != (color.RGBA{}) {
+			c.ColorLinea = tema.ColorLinea
+		}
+		if tema.SeriePrefijo != "" {
+			c.SeriePrefijo = tema.SeriePrefijo
+		}
+		if tema.Precio > 0 {
+			c.Precio = tema.Precio
 		}
-	}
 
-	for i := range alto {
-		if y+i >= img.Bounds().Max.Y {
-			continue
+		loggerOPorDefecto(config.Logger).Info("generando tanda", "tanda", i+1, "total", len(config.Tandas), "nombre", nombre)
+
+		gen, err := NewGeneradorTalonarios(c)
+		if err != nil {
+			return fmt.Errorf("error configurando tanda %s: %v", nombre, err)
 		}
-		for thick := range g.config.AnchoLineas {
-			if x+thick < img.Bounds().Max.X {
-				img.Set(x+thick, y+i, col)
+
+		if config.CompartirNumeros {
+			if numerosUsados == nil {
+				numerosUsados = gen.numerosUsados
+				for _, nivel := range gen.niveles {
+					nivelesUsados = append(nivelesUsados, nivel.usados)
+				}
 			}
-		}
-		for thick := range g.config.AnchoLineas {
-			if x+ancho-1-thick < img.Bounds().Max.X {
-				img.Set(x+ancho-1-thick, y+i, col)
+			gen.numerosUsados = numerosUsados
+			for k := range gen.niveles {
+				gen.niveles[k].usados = nivelesUsados[k]
 			}
 		}
+
+		if err := gen.GenerarTodos(); err != nil {
+			return fmt.Errorf("error generando tanda %s: %v", nombre, err)
+		}
 	}
-}
 
-func (g *GeneradorTalonarios) dibujarTexto(img *image.RGBA, texto string, x, y int, col color.RGBA) {
+	return nil
+}
 
-	metrics := g.config.Fuente.Metrics()
-	alturaTexto := metrics.Height.Round()
-	yCentrado := y + alturaTexto/4
+// carpetaReservados es la subcarpeta de CarpetaSalida donde GenerarReservados
+// escribe los talonarios.
+const carpetaReservados = "reservados"
 
-	point := fixed.Point26_6{
-		X: fixed.Int26_6(x * 64),
-		Y: fixed.Int26_6(yCentrado * 64),
+// GenerarReservados genera talonarios talonarios sorteando solo dentro de
+// config.BloqueReservado, con el mismo diseño y relleno de dígitos que la
+// corrida normal, en la subcarpeta carpetaReservados de CarpetaSalida. El
+// JSON y el índice, si se piden, se escriben también en esa subcarpeta. Como
+// GenerarTandas, arma un generador nuevo en cada llamada.
+func GenerarReservados(config Config, talonarios int) error {
+	bloque := config.BloqueReservado
+	if bloque == [2]int{} {
+		return errors.New("no hay BloqueReservado configurado")
 	}
-
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  &image.Uniform{col},
-		Face: g.config.Fuente,
-		Dot:  point,
+	if config.CarpetaSalida == salidaEstandar {
+		return fmt.Errorf("los talonarios reservados no se pueden escribir en la salida estándar (CarpetaSalida %q)", salidaEstandar)
+	}
+	// Valida el bloque contra la corrida normal antes de reemplazar el rango
+	if err := ValidarConfig(config); err != nil {
+		return err
 	}
 
-	d.DrawString(texto)
-}
+	c := config
+	c.NumeroMinimo, c.NumeroMaximo = bloque[0], bloque[1]
+	c.BloqueReservado = [2]int{}
+	c.CantidadPaginas = talonarios
+	c.ComenzarDesde = 0
+	c.Tandas = nil
+	c.NumerosPredefinidos = nil
+	c.NumerosDisponibles = nil
+	for _, numero := range config.NumerosDisponibles {
+		if numero >= bloque[0] && numero <= bloque[1] {
+			c.NumerosDisponibles = append(c.NumerosDisponibles, numero)
+		}
+	}
+	if c.DigitosFormato == 0 {
+		base := config.BaseNumerica
+		if base == 0 {
+			base = 10
+		}
+		c.DigitosFormato = len(strconv.FormatInt(int64(config.NumeroMaximo), base))
+	}
+	c.CarpetaSalida = filepath.Join(config.CarpetaSalida, carpetaReservados)
+	if config.ArchivoJSON != "" {
+		c.ArchivoJSON = filepath.Join(c.CarpetaSalida, filepath.Base(config.ArchivoJSON))
+	}
+	if config.ArchivoIndice != "" {
+		c.ArchivoIndice = filepath.Join(c.CarpetaSalida, filepath.Base(config.ArchivoIndice))
+	}
 
-func (g *GeneradorTalonarios) guardarImagen(img *image.RGBA, nombreArchivo string) error {
-	file, err := os.Create(nombreArchivo)
+	gen, err := NewGeneradorTalonarios(c)
 	if err != nil {
-		return err
+		return fmt.Errorf("error configurando talonarios reservados: %v", err)
 	}
-	defer file.Close()
-
-	return png.Encode(file, img)
+	return gen.GenerarTodos()
 }
 
-func (g *GeneradorTalonarios) GenerarTodos() error {
-	fmt.Printf("Generando %d talonarios con %d boletas cada uno...\n",
-		g.config.CantidadPaginas, g.config.BoletasPorPagina)
-
-	for i := 1; i <= g.config.CantidadPaginas; i++ {
-		fmt.Printf("Generando talonario %d/%d...\n", i, g.config.CantidadPaginas)
-
-		talonario := g.crearTalonario(i)
-
-		img := g.crearImagenTalonario(talonario)
+func main() {
+	logJSON := flag.Bool("log-json", false, "emitir los mensajes del generador en formato JSON")
+	rutaConfig := flag.String("config", "", "archivo de configuración JSON o YAML")
+	verificarFuente := flag.Bool("verificar-fuente", false, "solo comprobar si el número más ancho cabe en la boleta")
+	contarNumeros := flag.Bool("contar-numeros", false, "solo informar cuántos números usa la configuración y si alcanzan")
+	reservados := flag.Int("reservados", 0, "solo generar esta cantidad de talonarios con los números de BloqueReservado")
+	rutaTemas := flag.String("temas", "", "archivo JSON o YAML con temas para Tema, además de los incorporados")
+	flag.Parse()
 
-		nombreArchivo := filepath.Join(g.config.CarpetaSalida, fmt.Sprintf("talonario_%03d.png", i))
-		if err := g.guardarImagen(img, nombreArchivo); err != nil {
-			return fmt.Errorf("error guardando talonario %d: %v", i, err)
+	nuevoHandler := func(w io.Writer) slog.Handler {
+		if *logJSON {
+			return slog.NewJSONHandler(w, nil)
 		}
+		return slog.NewTextHandler(w, nil)
+	}
+	handler := nuevoHandler(os.Stdout)
 
-		fmt.Printf("  Números: ")
-		for j, boleta := range talonario.Boletas {
-			if j > 0 {
-				fmt.Print(", ")
-			}
-			fmt.Print(boleta.Formateado)
+	if flag.Arg(0) == "servidor" {
+		if err := ejecutarServidor(flag.Args()[1:], slog.New(handler)); err != nil {
+			log.Fatal("Error en el servidor:", err)
 		}
-		fmt.Println()
+		return
 	}
 
-	fmt.Printf("\n✅ Todos los talonarios generados en: %s\n", g.config.CarpetaSalida)
-	return nil
-}
+	if flag.Arg(0) == "combinar-pdf" {
+		if flag.NArg() != 3 {
+			log.Fatal("uso: rafflemaker combinar-pdf <carpeta> <salida.pdf>")
+		}
+		slog.SetDefault(slog.New(handler))
+		if err := CombinarPNGaPDF(flag.Arg(1), flag.Arg(2)); err != nil {
+			log.Fatal("Error combinando PDF:", err)
+		}
+		return
+	}
 
-func main() {
 	config := Config{
 		ImagenBase:         "Base.png",
 		NumeroMinimo:       0,
@@ -387,24 +4770,102 @@ func main() {
 		AnchoLineas:        5,
 		ColorTexto:         color.RGBA{248, 220, 191, 255},
 		ColorBorde:         color.RGBA{248, 220, 191, 255},
+		ColorLinea:         color.RGBA{248, 220, 191, 255},
 		RutaFuente:         "calibri-bold.ttf",
 		TamanoFuente:       38.0,
-		OrientacionBoletas: 0, // 0: izquierda, 1: centro, 2: derecha
+		OrientacionBoletas: OrientacionIzquierda,
+		CentrarGrid:        false,
+		Logger:             slog.New(handler),
+	}
+
+	if *rutaTemas != "" {
+		if err := CargarTemas(*rutaTemas); err != nil {
+			log.Fatal("Error cargando temas:", err)
+		}
+	}
+
+	if *rutaConfig != "" {
+		cargada, err := CargarConfig(*rutaConfig)
+		if err != nil {
+			log.Fatal("Error cargando configuración:", err)
+		}
+		cargada.Logger = config.Logger
+		config = cargada
+	}
+
+	// Con la imagen en la salida estándar, los mensajes van a la de errores.
+	consola := io.Writer(os.Stdout)
+	if config.CarpetaSalida == salidaEstandar {
+		consola = os.Stderr
+		config.Logger = slog.New(nuevoHandler(os.Stderr))
+	}
+
+	if *contarNumeros {
+		requeridos, err := NumerosRequeridos(config)
+		fmt.Fprintf(consola, "Números requeridos: %d\n", requeridos)
+		if err != nil {
+			fmt.Fprintf(consola, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(consola, "✅ Los números disponibles alcanzan")
+		return
+	}
+
+	fmt.Fprintln(consola, "🎫 Generador de Talonarios de Rifas")
+	fmt.Fprintln(consola, "===================================")
+	fmt.Fprintf(consola, "Rango de números: %04d - %04d\n", config.NumeroMinimo, config.NumeroMaximo)
+	fmt.Fprintf(consola, "Boletas por talonario: %d\n", config.BoletasPorPagina)
+	fmt.Fprintf(consola, "Cantidad de talonarios: %d\n", config.CantidadPaginas)
+	fmt.Fprintf(consola, "Total de números a usar: %d\n\n", config.BoletasPorPagina*config.CantidadPaginas)
+
+	if *reservados > 0 {
+		if err := GenerarReservados(config, *reservados); err != nil {
+			log.Fatal("Error generando talonarios reservados:", err)
+		}
+		fmt.Fprintf(consola, "✅ %d talonarios reservados generados en: %s\n", *reservados, filepath.Join(config.CarpetaSalida, carpetaReservados))
+		return
 	}
 
-	fmt.Println("🎫 Generador de Talonarios de Rifas")
-	fmt.Println("===================================")
-	fmt.Printf("Rango de números: %04d - %04d\n", config.NumeroMinimo, config.NumeroMaximo)
-	fmt.Printf("Boletas por talonario: %d\n", config.BoletasPorPagina)
-	fmt.Printf("Cantidad de talonarios: %d\n", config.CantidadPaginas)
-	fmt.Printf("Total de números a usar: %d\n\n", config.BoletasPorPagina*config.CantidadPaginas)
+	if len(config.Tandas) > 0 {
+		if err := GenerarTandas(config); err != nil {
+			log.Fatal("Error generando tandas:", err)
+		}
+		return
+	}
 
 	generador, err := NewGeneradorTalonarios(config)
 	if err != nil {
 		log.Fatal("Error configurando generador:", err)
 	}
 
+	if *verificarFuente {
+		informe, err := generador.VerificarFuente()
+		if err != nil {
+			log.Fatal("Error verificando fuente:", err)
+		}
+		fmt.Fprintf(consola, "Fuente %q a %.1f: %q mide %dx%d, la boleta admite %dx%d\n",
+			informe.Fuente, informe.Tamano, informe.Texto, informe.AnchoTexto, informe.AltoTexto,
+			informe.AnchoDisponible, informe.AltoDisponible)
+		if !informe.Cabe {
+			fmt.Fprintln(consola, "❌ El número no cabe en la boleta")
+			os.Exit(1)
+		}
+		fmt.Fprintln(consola, "✅ El número cabe en la boleta")
+		return
+	}
+
+	estimacion := generador.EstimarSalida()
+	fmt.Fprintf(consola, "Salida estimada: %d archivos, %.1f MB (memoria pico %.1f MB)\n\n",
+		estimacion.Archivos, float64(estimacion.BytesTotales)/(1<<20), float64(estimacion.MemoriaPico)/(1<<20))
+
 	if err := generador.GenerarTodos(); err != nil {
 		log.Fatal("Error generando talonarios:", err)
 	}
+
+	e := generador.Estadisticas()
+	fmt.Fprintf(consola, "\n✅ Todos los talonarios generados en: %s\n", generador.CarpetaSalida())
+	fmt.Fprintf(consola, "🔖 ID de corrida: %s\n", generador.IDCorrida())
+	fmt.Fprintf(consola, "⏱️  %d talonarios en %s (promedio %s, mediana %s, más lento #%d con %s)\n",
+		e.Talonarios, e.Total.Round(time.Millisecond), e.Promedio.Round(time.Millisecond),
+		e.Mediana.Round(time.Millisecond), e.MasLento, e.DuracionMasLento.Round(time.Millisecond))
 }
@@ -0,0 +1,2794 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/tiff"
+)
+
+func configPrueba(t *testing.T) Config {
+	t.Helper()
+	return Config{
+		NumeroMinimo:     0,
+		NumeroMaximo:     999,
+		BoletasPorPagina: 10,
+		CantidadPaginas:  5,
+		BoletasPorFila:   2,
+		CarpetaSalida:    t.TempDir(),
+		AnchoTalonario:   400,
+		AltoTalonario:    600,
+		AnchoLineas:      2,
+		ColorTexto:       color.RGBA{255, 255, 255, 255},
+		ColorBorde:       color.RGBA{255, 255, 255, 255},
+		Semilla:          42,
+		Logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func nuevoGeneradorPrueba(t *testing.T, config Config) *GeneradorTalonarios {
+	t.Helper()
+	gen, err := NewGeneradorTalonarios(config)
+	if err != nil {
+		t.Fatalf("NewGeneradorTalonarios: %v", err)
+	}
+	return gen
+}
+
+func TestCrearTalonarioSinDuplicados(t *testing.T) {
+	config := configPrueba(t)
+	gen := nuevoGeneradorPrueba(t, config)
+
+	vistos := make(map[int]bool)
+	for id := 1; id <= config.CantidadPaginas; id++ {
+		talonario, err := gen.crearTalonario(id)
+		if err != nil {
+			t.Fatalf("crearTalonario(%d): %v", id, err)
+		}
+		if len(talonario.Boletas) != config.BoletasPorPagina {
+			t.Fatalf("talonario %d tiene %d boletas, se esperaban %d", id, len(talonario.Boletas), config.BoletasPorPagina)
+		}
+		for _, boleta := range talonario.Boletas {
+			if boleta.Numero < config.NumeroMinimo || boleta.Numero > config.NumeroMaximo {
+				t.Errorf("número %d fuera del rango [%d, %d]", boleta.Numero, config.NumeroMinimo, config.NumeroMaximo)
+			}
+			if vistos[boleta.Numero] {
+				t.Errorf("número %d repetido", boleta.Numero)
+			}
+			vistos[boleta.Numero] = true
+		}
+	}
+
+	if len(vistos) != config.BoletasPorPagina*config.CantidadPaginas {
+		t.Errorf("se asignaron %d números, se esperaban %d", len(vistos), config.BoletasPorPagina*config.CantidadPaginas)
+	}
+}
+
+func TestSemillaDeterminista(t *testing.T) {
+	config := configPrueba(t)
+	a := nuevoGeneradorPrueba(t, config)
+	b := nuevoGeneradorPrueba(t, config)
+
+	for range 20 {
+		na, _ := a.generarNumeroAleatorio()
+		nb, _ := b.generarNumeroAleatorio()
+		if na != nb {
+			t.Fatalf("con la misma semilla se obtuvieron %d y %d", na, nb)
+		}
+	}
+}
+
+func TestFormatearNumero(t *testing.T) {
+	casos := []struct {
+		maximo int
+		numero int
+		want   string
+	}{
+		{9, 3, "3"},
+		{999, 7, "007"},
+		{9999, 42, "0042"},
+		{10000, 42, "00042"},
+	}
+
+	for _, c := range casos {
+		config := configPrueba(t)
+		config.NumeroMaximo = c.maximo
+		config.BoletasPorPagina = 1
+		config.CantidadPaginas = 1
+		gen := nuevoGeneradorPrueba(t, config)
+
+		if got := gen.formatearNumero(c.numero); got != c.want {
+			t.Errorf("formatearNumero(%d) con máximo %d = %q, se esperaba %q", c.numero, c.maximo, got, c.want)
+		}
+	}
+}
+
+func TestDigitosFormato(t *testing.T) {
+	config := configPrueba(t)
+	config.NumeroMaximo = 500
+	config.DigitosFormato = 5
+	if got := nuevoGeneradorPrueba(t, config).formatearNumero(500); got != "00500" {
+		t.Errorf("formatearNumero(500) con DigitosFormato 5 = %q, se esperaba %q", got, "00500")
+	}
+	config.DigitosFormato = 2
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error cuando NumeroMaximo no cabe en DigitosFormato")
+	}
+}
+
+func TestNumerosAgotados(t *testing.T) {
+	config := configPrueba(t)
+	config.NumeroMaximo = 9
+	config.BoletasPorPagina = 5
+	config.CantidadPaginas = 2
+	gen := nuevoGeneradorPrueba(t, config)
+	gen.rng = rand.New(rand.NewSource(1))
+
+	for id := 1; id <= 2; id++ {
+		if _, err := gen.crearTalonario(id); err != nil {
+			t.Fatalf("crearTalonario(%d): %v", id, err)
+		}
+	}
+
+	if _, err := gen.generarNumeroAleatorio(); !errors.Is(err, ErrNumerosAgotados) {
+		t.Errorf("se esperaba ErrNumerosAgotados, se obtuvo %v", err)
+	}
+	if _, err := gen.crearTalonario(3); !errors.Is(err, ErrNumerosAgotados) {
+		t.Errorf("crearTalonario con el rango agotado: se esperaba ErrNumerosAgotados, se obtuvo %v", err)
+	}
+}
+
+func TestEstrategiaPermutacion(t *testing.T) {
+	config := configPrueba(t)
+	config.NumeroMaximo = 99
+	config.BoletasPorPagina = 5
+	config.CantidadPaginas = 2
+	config.ExcluirRepetidos = true
+	config.EstrategiaNumeros = "permutacion"
+	a := nuevoGeneradorPrueba(t, config)
+	b := nuevoGeneradorPrueba(t, config)
+
+	vistos := make(map[int]bool)
+	for range a.disponibles {
+		na, err := a.generarNumeroAleatorio()
+		if err != nil {
+			t.Fatalf("generarNumeroAleatorio: %v", err)
+		}
+		if nb, _ := b.generarNumeroAleatorio(); na != nb {
+			t.Fatalf("con la misma semilla se obtuvieron %d y %d", na, nb)
+		}
+		if vistos[na] || DigitosRepetidos(fmt.Sprintf("%02d", na)) {
+			t.Errorf("número %d repetido o excluido", na)
+		}
+		vistos[na] = true
+	}
+
+	if len(vistos) != 90 {
+		t.Errorf("se sortearon %d números, se esperaban 90", len(vistos))
+	}
+	if _, err := a.generarNumeroAleatorio(); !errors.Is(err, ErrNumerosAgotados) {
+		t.Errorf("se esperaba ErrNumerosAgotados, se obtuvo %v", err)
+	}
+
+	config.EstrategiaNumeros = "otra"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con una estrategia desconocida")
+	}
+
+	// Con un rango enorme la permutación no se puede armar
+	config.ExcluirRepetidos = false
+	config.EstrategiaNumeros = "permutacion"
+	config.NumeroMaximo = 1 << 62
+	if _, err := NewGeneradorTalonarios(config); err == nil || !strings.Contains(err.Error(), "permutacion") {
+		t.Errorf("se esperaba un error de la permutación con un rango enorme, se obtuvo %v", err)
+	}
+	config.EstrategiaNumeros = ""
+	gen := nuevoGeneradorPrueba(t, config)
+	gen.disponibles = gen.numerosNecesarios() // sorteo denso
+	if e := gen.elegirEstrategia(); e != "rechazo" {
+		t.Errorf("elegirEstrategia con un rango enorme = %q, se esperaba rechazo", e)
+	}
+}
+
+func TestEstrategiaAutomatica(t *testing.T) {
+	config := configPrueba(t)
+	gen := nuevoGeneradorPrueba(t, config)
+	if gen.estrategia != "rechazo" || gen.numerosUsados.mapa == nil {
+		t.Errorf("sorteo disperso: estrategia %q, se esperaba rechazo con mapa", gen.estrategia)
+	}
+
+	config.NumeroMaximo = 199
+	gen = nuevoGeneradorPrueba(t, config)
+	if gen.estrategia != "permutacion" || gen.numerosUsados.bits == nil {
+		t.Errorf("sorteo denso: estrategia %q, se esperaba permutacion con bitset", gen.estrategia)
+	}
+	var talonarios []Talonario
+	for id := 1; id <= config.CantidadPaginas; id++ {
+		talonario, err := gen.crearTalonario(id)
+		if err != nil {
+			t.Fatalf("crearTalonario(%d): %v", id, err)
+		}
+		talonarios = append(talonarios, talonario)
+	}
+	if duplicados := VerificarUnicidad(talonarios); len(duplicados) > 0 {
+		t.Errorf("números repetidos: %v", duplicados)
+	}
+}
+
+func TestValidarConfigRangoInsuficiente(t *testing.T) {
+	config := configPrueba(t)
+	config.NumeroMaximo = 9
+	config.BoletasPorPagina = 6
+	config.CantidadPaginas = 2
+
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error por falta de números")
+	}
+}
+
+func TestFormatearNumeroSeparadorYControl(t *testing.T) {
+	config := configPrueba(t)
+	config.NumeroMaximo = 999999
+	config.BoletasPorPagina = 1
+	config.CantidadPaginas = 1
+	config.SeparadorMiles = "."
+	config.DigitoControl = true
+	gen := nuevoGeneradorPrueba(t, config)
+
+	got := gen.formatearNumero(123456)
+	if got != "123.456-6" {
+		t.Errorf("formatearNumero(123456) = %q, se esperaba %q", got, "123.456-6")
+	}
+	if !ValidarNumero(got) {
+		t.Errorf("ValidarNumero(%q) = false", got)
+	}
+	if ValidarNumero("123.457-6") {
+		t.Error("ValidarNumero aceptó un número con un dígito alterado")
+	}
+	if got := gen.formatearNumero(-123456); got != "-123.456-6" {
+		t.Errorf("formatearNumero(-123456) = %q, se esperaba %q", got, "-123.456-6")
+	}
+}
+
+func TestValidarNumero(t *testing.T) {
+	formatos := []struct {
+		nombre, separador, prefijo string
+	}{
+		{"simple", "", ""},
+		{"miles", ".", ""},
+		{"serie", "", "A-"},
+	}
+	for _, f := range formatos {
+		config := configPrueba(t)
+		config.NumeroMinimo = -99999
+		config.NumeroMaximo = 99999
+		config.BoletasPorPagina = 1
+		config.CantidadPaginas = 1
+		config.DigitoControl = true
+		config.SeparadorMiles = f.separador
+		config.SeriePrefijo = f.prefijo
+		gen := nuevoGeneradorPrueba(t, config)
+		for _, n := range []int{0, 7, 42, 1000, 12345, 99999, -5, -42, -12345} {
+			if got := gen.formatearNumero(n); !ValidarNumero(got) {
+				t.Errorf("%s: ValidarNumero(%q) = false", f.nombre, got)
+			}
+		}
+	}
+
+	casos := []struct {
+		entrada string
+		want    bool
+	}{
+		{"0042-2", true},
+		{"A-0042-2", true},
+		{"12.345-5", true},
+		{"-5-9", true},
+		{"-0042-2", true},
+		{"A--0042-2", true},
+		{"0043-2", false}, // un dígito alterado
+		{"0024-2", false}, // dígitos adyacentes transpuestos
+		{"0042-", false},
+		{"0042-x", false},
+		{"0042-12", false},
+		{"-7", false},
+		{"A--2", false},
+		{"", false},
+	}
+	for _, c := range casos {
+		if got := ValidarNumero(c.entrada); got != c.want {
+			t.Errorf("ValidarNumero(%q) = %v, se esperaba %v", c.entrada, got, c.want)
+		}
+	}
+	if got := digitoLuhn("0042"); got != 2 {
+		t.Errorf("digitoLuhn(%q) = %d, se esperaba 2", "0042", got)
+	}
+
+	config := configPrueba(t)
+	config.NumeroMinimo = -999
+	config.DigitoControl = true
+	gen := nuevoGeneradorPrueba(t, config)
+	if got := gen.formatearNumero(-42); got != "-42-2" {
+		t.Errorf("formatearNumero(-42) = %q, se esperaba %q", got, "-42-2")
+	}
+}
+
+func TestAgruparMiles(t *testing.T) {
+	casos := map[string]string{
+		"7":       "7",
+		"123":     "123",
+		"1234":    "1.234",
+		"000500":  "000.500",
+		"1234567": "1.234.567",
+		"-123":    "-123",
+		"-123456": "-123.456",
+		"-1234":   "-1.234",
+	}
+	for entrada, want := range casos {
+		if got := agruparMiles(entrada, "."); got != want {
+			t.Errorf("agruparMiles(%q) = %q, se esperaba %q", entrada, got, want)
+		}
+	}
+	if got := agruparMiles("123456", ""); got != "123456" {
+		t.Errorf("sin separador: %q", got)
+	}
+}
+
+func TestComenzarDesdeReproduceLaCorridaOriginal(t *testing.T) {
+	completa := configPrueba(t)
+	if err := nuevoGeneradorPrueba(t, completa).GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	reanudada := configPrueba(t)
+	reanudada.ComenzarDesde = 3
+	if err := nuevoGeneradorPrueba(t, reanudada).GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	for id := 1; id <= completa.CantidadPaginas; id++ {
+		nombre := fmt.Sprintf("talonario_%03d.png", id)
+		original, err := os.ReadFile(filepath.Join(completa.CarpetaSalida, nombre))
+		if err != nil {
+			t.Fatal(err)
+		}
+		repetido, err := os.ReadFile(filepath.Join(reanudada.CarpetaSalida, nombre))
+
+		if id < reanudada.ComenzarDesde {
+			if err == nil {
+				t.Errorf("%s no debería haberse escrito al reanudar", nombre)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", nombre, err)
+		}
+		if !bytes.Equal(original, repetido) {
+			t.Errorf("%s difiere de la corrida original", nombre)
+		}
+	}
+}
+
+func TestGenerarJSON(t *testing.T) {
+	config := configPrueba(t)
+	config.ArchivoJSON = filepath.Join(config.CarpetaSalida, "numeros.json")
+	gen := nuevoGeneradorPrueba(t, config)
+
+	if err := gen.GenerarJSON(config.ArchivoJSON); err == nil {
+		t.Error("GenerarJSON antes de generar debería fallar")
+	}
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	datos, err := os.ReadFile(config.ArchivoJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var talonarios []Talonario
+	if err := json.Unmarshal(datos, &talonarios); err != nil {
+		t.Fatalf("JSON inválido: %v", err)
+	}
+
+	if len(talonarios) != config.CantidadPaginas {
+		t.Fatalf("se exportaron %d talonarios, se esperaban %d", len(talonarios), config.CantidadPaginas)
+	}
+	for i, talonario := range talonarios {
+		if talonario.ID != i+1 || len(talonario.Boletas) != config.BoletasPorPagina {
+			t.Errorf("talonario %d mal exportado: %+v", i+1, talonario)
+		}
+		for j, boleta := range talonario.Boletas {
+			if !reflect.DeepEqual(boleta, gen.talonarios[i].Boletas[j]) {
+				t.Errorf("boleta %d del talonario %d no coincide con la dibujada", j, i+1)
+			}
+		}
+	}
+
+	// Una segunda corrida duplicaría los talonarios en el JSON
+	if err := gen.GenerarTodos(); !errors.Is(err, ErrGeneradorUsado) {
+		t.Errorf("segunda llamada a GenerarTodos = %v, se esperaba ErrGeneradorUsado", err)
+	}
+	if len(gen.talonarios) != config.CantidadPaginas {
+		t.Errorf("hay %d talonarios después de la segunda llamada, se esperaban %d", len(gen.talonarios), config.CantidadPaginas)
+	}
+}
+
+func TestFormatearNumeroConEtiqueta(t *testing.T) {
+	config := configPrueba(t)
+	config.MapaEtiquetas = map[int]string{7: "BRONCE"}
+	gen := nuevoGeneradorPrueba(t, config)
+
+	if got := gen.formatearNumero(7); got != "BRONCE" {
+		t.Errorf("formatearNumero(7) = %q, se esperaba la etiqueta", got)
+	}
+	if got := gen.formatearNumero(8); got != "008" {
+		t.Errorf("formatearNumero(8) = %q, se esperaba %q", got, "008")
+	}
+}
+
+func TestTamanoPagina(t *testing.T) {
+	casos := []struct {
+		tamano      string
+		dpi         int
+		horizontal  bool
+		ancho, alto int
+	}{
+		{"A4", 300, false, 2480, 3508},
+		{"a4", 0, true, 3508, 2480},
+		{"A5", 300, false, 1748, 2480},
+		{"Letter", 300, false, 2550, 3300},
+		{"Letter", 150, true, 1650, 1275},
+	}
+
+	for _, c := range casos {
+		config := configPrueba(t)
+		config.TamanoPagina = c.tamano
+		config.DPI = c.dpi
+		config.PaginaHorizontal = c.horizontal
+		gen := nuevoGeneradorPrueba(t, config)
+
+		if gen.config.AnchoTalonario != c.ancho || gen.config.AltoTalonario != c.alto {
+			t.Errorf("%s a %d DPI (horizontal=%v) = %dx%d, se esperaba %dx%d", c.tamano, c.dpi, c.horizontal,
+				gen.config.AnchoTalonario, gen.config.AltoTalonario, c.ancho, c.alto)
+		}
+	}
+
+	config := configPrueba(t)
+	config.TamanoPagina = "B5"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un tamaño de página desconocido")
+	}
+}
+
+func TestVerificarUnicidad(t *testing.T) {
+	talonarios := []Talonario{
+		{ID: 1, Boletas: []Boleta{{Numero: 5}, {Numero: 3}, {Numero: 9}}},
+		{ID: 2, Boletas: []Boleta{{Numero: 9}, {Numero: 1}, {Numero: 3}}},
+		{ID: 3, Boletas: []Boleta{{Numero: 3}}},
+	}
+
+	if got := VerificarUnicidad(talonarios); !slices.Equal(got, []int{3, 9}) {
+		t.Errorf("VerificarUnicidad = %v, se esperaba [3 9]", got)
+	}
+	if got := VerificarUnicidad(talonarios[:1]); len(got) != 0 {
+		t.Errorf("VerificarUnicidad sin duplicados = %v", got)
+	}
+}
+
+func TestCopiasPorNumero(t *testing.T) {
+	config := configPrueba(t)
+	config.NumeroMaximo = 24
+	config.CopiasPorNumero = 2
+	config.VerificarDuplicados = true
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	for _, talonario := range gen.talonarios {
+		for i := 0; i < len(talonario.Boletas); i += 2 {
+			if a, b := talonario.Boletas[i], talonario.Boletas[i+1]; !reflect.DeepEqual(a, b) {
+				t.Errorf("talonario %d: las boletas %d y %d deberían ser copias: %v, %v", talonario.ID, i, i+1, a, b)
+			}
+		}
+	}
+	if got := VerificarCopias(gen.talonarios, 2); len(got) != 0 {
+		t.Errorf("VerificarCopias = %v, se esperaba vacío", got)
+	}
+
+	config.NumeroMaximo = 23
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con 25 números necesarios y solo 24 disponibles")
+	}
+	config.NumeroMaximo = 999
+	config.CopiasPorNumero = 3
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error cuando BoletasPorPagina no es múltiplo de CopiasPorNumero")
+	}
+}
+
+func TestEstimarSalida(t *testing.T) {
+	config := configPrueba(t)
+	config.TalonariosPorHoja = 2
+	config.ComenzarDesde = 4
+	config.ArchivoJSON = filepath.Join(config.CarpetaSalida, "numeros.json")
+	config.FormatoSalida = "tiff"
+	e := nuevoGeneradorPrueba(t, config).EstimarSalida()
+
+	// hojas 2 y 3 (talonarios 3-4 y 5) más el JSON
+	if e.Archivos != 3 {
+		t.Errorf("Archivos = %d, se esperaban 3", e.Archivos)
+	}
+	// hoja de 2x1 talonarios de 400x600 sin comprimir
+	if want := int64(800 * 600 * 4); e.BytesPorArchivo != want {
+		t.Errorf("BytesPorArchivo = %d, se esperaba %d", e.BytesPorArchivo, want)
+	}
+	if e.BytesTotales < 2*e.BytesPorArchivo || e.MemoriaPico <= 0 {
+		t.Errorf("estimación inconsistente: %+v", e)
+	}
+	if e.DiscoLibre == 0 {
+		t.Errorf("DiscoLibre = 0, se esperaba el espacio libre o -1")
+	}
+}
+
+func TestImagenEncabezado(t *testing.T) {
+	rojo := color.RGBA{255, 0, 0, 255}
+	fuente := image.NewRGBA(image.Rect(0, 0, 100, 20))
+	draw.Draw(fuente, fuente.Bounds(), &image.Uniform{rojo}, image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, fuente); err != nil {
+		t.Fatal(err)
+	}
+	ruta := filepath.Join(t.TempDir(), "encabezado.png")
+	if err := os.WriteFile(ruta, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := configPrueba(t)
+	config.MargenSuperior = 40
+	config.ImagenEncabezado = ruta
+	gen := nuevoGeneradorPrueba(t, config)
+	img := gen.crearImagenTalonario(Talonario{ID: 1})
+
+	// 100x20 escalada x2 para llenar los 40 píxeles del margen, centrada en 400
+	if got := img.RGBAAt(200, 20); got != rojo {
+		t.Errorf("centro del encabezado = %v, se esperaba rojo", got)
+	}
+	if got := img.RGBAAt(50, 20); got == rojo {
+		t.Error("el encabezado no debería ocupar fuera de su ancho escalado")
+	}
+
+	config.ImagenEncabezado = filepath.Join(t.TempDir(), "no-existe.png")
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con una imagen de encabezado inexistente")
+	}
+}
+
+func TestDesbordeDeNumero(t *testing.T) {
+	config := configPrueba(t)
+	config.RutaFuente = "calibri-bold.ttf"
+	config.TamanoFuente = 200
+	gen := nuevoGeneradorPrueba(t, config)
+
+	anchoBoleta, _, _ := gen.dimensionesBoleta()
+	disponible := anchoBoleta - 2*config.AnchoLineas
+	anchoTexto := font.MeasureString(gen.config.Fuente, "0042").Round()
+	if anchoTexto <= disponible {
+		t.Fatalf("la prueba necesita un número que no quepa: %d <= %d", anchoTexto, disponible)
+	}
+
+	face, ancho := gen.fuenteQueCabe("0042", anchoBoleta, anchoTexto)
+	if face == gen.config.Fuente || ancho > disponible {
+		t.Errorf("se esperaba una fuente reducida que quepa en %d píxeles, ancho %d", disponible, ancho)
+	}
+
+	var registro bytes.Buffer
+	config.AvisarDesborde = true
+	config.Logger = slog.New(slog.NewTextHandler(&registro, nil))
+	gen = nuevoGeneradorPrueba(t, config)
+	face, ancho = gen.fuenteQueCabe("0042", anchoBoleta, anchoTexto)
+	if face != gen.config.Fuente || ancho != anchoTexto {
+		t.Error("con AvisarDesborde no se debería cambiar la fuente")
+	}
+	gen.fuenteQueCabe("0043", anchoBoleta, anchoTexto)
+	if n := strings.Count(registro.String(), "no cabe en la boleta"); n != 1 {
+		t.Errorf("se registraron %d avisos de desborde, se esperaba 1:\n%s", n, registro.String())
+	}
+}
+
+func TestSegundaRepresentacion(t *testing.T) {
+	config := configPrueba(t)
+	config.RutaFuente = "calibri-bold.ttf"
+	config.SeriePrefijo = "A-"
+	config.TablaDigitos = "abcdefghij"
+	gen := nuevoGeneradorPrueba(t, config)
+	if got := gen.segundaRepresentacion(gen.formatearNumero(42)); got != "A-aec" {
+		t.Errorf("segundaRepresentacion = %q, se esperaba %q", got, "A-aec")
+	}
+	gen.crearImagenTalonario(Talonario{ID: 1, Boletas: []Boleta{{Numero: 42, Formateado: "A-042"}}})
+
+	config.TablaDigitos = "abc"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con una tabla de menos de 10 dígitos")
+	}
+
+	// calibri no tiene los dígitos arábigos orientales
+	config.TablaDigitos = ""
+	config.SegundaRepresentacion = "arabe"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con una fuente sin los dígitos de la tabla")
+	}
+}
+
+func TestCorreccionAspecto(t *testing.T) {
+	config := configPrueba(t)
+	config.CantidadPaginas = 1
+	config.CorreccionAspecto = 2
+	if err := nuevoGeneradorPrueba(t, config).GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	archivo, err := os.Open(filepath.Join(config.CarpetaSalida, "talonario_001.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archivo.Close()
+	img, err := png.Decode(archivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 2*config.AnchoTalonario || img.Bounds().Dy() != config.AltoTalonario {
+		t.Errorf("dimensiones %v, se esperaba %dx%d", img.Bounds(), 2*config.AnchoTalonario, config.AltoTalonario)
+	}
+}
+
+func TestAlineacionDerechaPorColumna(t *testing.T) {
+	config := configPrueba(t)
+	config.RutaFuente = "calibri-bold.ttf"
+	config.TamanoFuente = 30
+	config.BoletasPorPagina = 3
+	config.BoletasPorFila = 3
+	config.AnchoTalonario = 600
+	config.AltoTalonario = 100
+	config.ColorTexto = color.RGBA{255, 0, 0, 255}
+	config.OrientacionBoletas = OrientacionDerecha
+	gen := nuevoGeneradorPrueba(t, config)
+
+	boleta := Boleta{Numero: 888, Formateado: "888"}
+	img := gen.crearImagenTalonario(Talonario{ID: 1, Boletas: []Boleta{boleta, boleta, boleta}})
+
+	anchoBoleta, _, _ := gen.dimensionesBoleta()
+	anchoCaracter := font.MeasureString(gen.config.Fuente, "0").Round()
+	esperado := config.AnchoLineas + anchoCaracter
+	for columna := range 3 {
+		x0 := config.MargenIzquierdo + columna*anchoBoleta
+		derecho := -1
+		for x := x0; x < x0+anchoBoleta; x++ {
+			for y := range config.AltoTalonario {
+				if c := img.RGBAAt(x, y); c.R > 128 && c.G < 100 {
+					derecho = x
+				}
+			}
+		}
+		if derecho < 0 {
+			t.Fatalf("columna %d: no se encontró el número", columna)
+		}
+		margen := x0 + anchoBoleta - 1 - derecho
+		if margen < esperado-anchoCaracter/2 || margen > esperado+anchoCaracter/2 {
+			t.Errorf("columna %d: el número termina a %d píxeles del borde derecho, se esperaban unos %d",
+				columna, margen, esperado)
+		}
+	}
+}
+
+func TestPaddingInterno(t *testing.T) {
+	// extremos devuelve la primera y la última columna con tinta roja
+	extremos := func(orientacion Orientacion, padding int) (int, int) {
+		config := configPrueba(t)
+		config.RutaFuente = "calibri-bold.ttf"
+		config.TamanoFuente = 30
+		config.BoletasPorPagina = 1
+		config.BoletasPorFila = 1
+		config.AnchoTalonario = 300
+		config.AltoTalonario = 100
+		config.ColorTexto = color.RGBA{255, 0, 0, 255}
+		config.OrientacionBoletas = orientacion
+		config.PaddingInterno = padding
+		boleta := Boleta{Numero: 888, Formateado: "888"}
+		img := nuevoGeneradorPrueba(t, config).crearImagenTalonario(Talonario{ID: 1, Boletas: []Boleta{boleta}})
+		primero, ultimo := -1, -1
+		for x := range config.AnchoTalonario {
+			for y := range config.AltoTalonario {
+				if c := img.RGBAAt(x, y); c.R > 128 && c.G < 100 {
+					if primero < 0 {
+						primero = x
+					}
+					ultimo = x
+				}
+			}
+		}
+		return primero, 299 - ultimo
+	}
+
+	izq40, _ := extremos(OrientacionIzquierda, 40)
+	izq60, _ := extremos(OrientacionIzquierda, 60)
+	if izq60-izq40 != 20 {
+		t.Errorf("izquierda: el número empieza en %d y %d, se esperaban 20 píxeles de diferencia", izq40, izq60)
+	}
+	_, der40 := extremos(OrientacionDerecha, 40)
+	_, der60 := extremos(OrientacionDerecha, 60)
+	if der60-der40 != 20 || der40 < 40 {
+		t.Errorf("derecha: el número termina a %d y %d del borde, se esperaban más de 40 y 20 de diferencia", der40, der60)
+	}
+	// Un padding mayor que el lugar centrado empuja el número
+	centro0, _ := extremos(OrientacionCentro, 0)
+	centro, _ := extremos(OrientacionCentro, 130)
+	if centro <= centro0 {
+		t.Errorf("centro: el número empieza en %d con padding 130 y en %d sin él", centro, centro0)
+	}
+
+	config := configPrueba(t)
+	config.PaddingInterno = -1
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con PaddingInterno negativo")
+	}
+}
+
+func TestAvisarAltoFuente(t *testing.T) {
+	for _, caso := range []struct {
+		tamano float64
+		aviso  bool
+	}{{40, false}, {380, true}} {
+		var registro bytes.Buffer
+		config := configPrueba(t)
+		config.RutaFuente = "calibri-bold.ttf"
+		config.TamanoFuente = caso.tamano
+		config.AvisarDesborde = true
+		config.Logger = slog.New(slog.NewTextHandler(&registro, nil))
+		nuevoGeneradorPrueba(t, config)
+		if got := strings.Contains(registro.String(), "más alto que la boleta"); got != caso.aviso {
+			t.Errorf("TamanoFuente %v: aviso = %v, se esperaba %v:\n%s", caso.tamano, got, caso.aviso, registro.String())
+		}
+	}
+}
+
+func TestVerificarFuente(t *testing.T) {
+	config := configPrueba(t)
+	config.RutaFuente = "calibri-bold.ttf"
+	config.TamanoFuente = 30
+	informe, err := nuevoGeneradorPrueba(t, config).VerificarFuente()
+	if err != nil {
+		t.Fatalf("VerificarFuente: %v", err)
+	}
+	if !informe.Cabe || len(informe.Texto) != 3 || informe.Limites.Empty() {
+		t.Errorf("con tamaño 30 el número debería caber: %+v", informe)
+	}
+
+	config.TamanoFuente = 300
+	if informe, _ := nuevoGeneradorPrueba(t, config).VerificarFuente(); informe.Cabe {
+		t.Errorf("con tamaño 300 el número no debería caber: %+v", informe)
+	}
+
+	gen := nuevoGeneradorPrueba(t, config)
+	gen.config.RutaFuente = filepath.Join(t.TempDir(), "no-existe.ttf")
+	if _, err := gen.VerificarFuente(); err == nil {
+		t.Error("se esperaba un error con una fuente inexistente")
+	}
+}
+
+func TestOrdenCapas(t *testing.T) {
+	base := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(base, base.Bounds(), &image.Uniform{color.RGBA{0, 255, 0, 255}}, image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, base); err != nil {
+		t.Fatal(err)
+	}
+	ruta := filepath.Join(t.TempDir(), "base.png")
+	if err := os.WriteFile(ruta, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := configPrueba(t)
+	config.ImagenBase = ruta
+	config.OpacidadImagenBase = 0.5
+	blanco := color.RGBA{255, 255, 255, 255}
+
+	// (10, 0) cae sobre la línea superior de la cuadrícula
+	img := nuevoGeneradorPrueba(t, config).crearImagenTalonario(Talonario{ID: 1})
+	if got := img.RGBAAt(10, 0); got != blanco {
+		t.Errorf("imagen-fondo: la línea debería quedar encima, color %v", got)
+	}
+
+	config.OrdenCapas = "imagen-frente"
+	img = nuevoGeneradorPrueba(t, config).crearImagenTalonario(Talonario{ID: 1})
+	if got := img.RGBAAt(10, 0); got == blanco || got.G < got.R {
+		t.Errorf("imagen-frente: la imagen debería teñir la línea, color %v", got)
+	}
+}
+
+func TestReintentosEscritura(t *testing.T) {
+	original, esperaOriginal := crearArchivo, esperaReintento
+	t.Cleanup(func() { crearArchivo, esperaReintento = original, esperaOriginal })
+	esperaReintento = time.Millisecond
+
+	var intentos int
+	fallar := func(veces int, err error) {
+		intentos = 0
+		crearArchivo = func(nombre string) (io.WriteCloser, error) {
+			intentos++
+			if intentos <= veces {
+				return nil, &os.PathError{Op: "open", Path: nombre, Err: err}
+			}
+			return os.Create(nombre)
+		}
+	}
+
+	config := configPrueba(t)
+	config.ReintentosEscritura = 3
+	gen := nuevoGeneradorPrueba(t, config)
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	ruta := filepath.Join(config.CarpetaSalida, "talonario.png")
+
+	fallar(2, syscall.EIO)
+	if err := gen.guardarImagen(img, ruta); err != nil || intentos != 3 {
+		t.Errorf("error transitorio: err = %v tras %d intentos, se esperaba éxito al tercero", err, intentos)
+	}
+
+	fallar(1, fs.ErrPermission)
+	if err := gen.guardarImagen(img, ruta); err == nil || intentos != 1 {
+		t.Errorf("error permanente: err = %v tras %d intentos, se esperaba fallar al primero", err, intentos)
+	}
+
+	fallar(10, syscall.EIO)
+	if err := gen.guardarImagen(img, ruta); err == nil || intentos != 4 {
+		t.Errorf("reintentos agotados: err = %v tras %d intentos, se esperaban 4", err, intentos)
+	}
+}
+
+func TestContinuarEnError(t *testing.T) {
+	original := crearArchivo
+	t.Cleanup(func() { crearArchivo = original })
+	crearArchivo = func(nombre string) (io.WriteCloser, error) {
+		if strings.Contains(nombre, "_002") || strings.Contains(nombre, "_004") {
+			return nil, &os.PathError{Op: "open", Path: nombre, Err: fs.ErrPermission}
+		}
+		return os.Create(nombre)
+	}
+
+	config := configPrueba(t)
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err == nil || len(gen.talonarios) != 2 {
+		t.Fatalf("sin ContinuarEnError se esperaba detenerse en el talonario 2: err = %v, talonarios = %d", err, len(gen.talonarios))
+	}
+
+	config = configPrueba(t)
+	config.ContinuarEnError = true
+	gen = nuevoGeneradorPrueba(t, config)
+	err := gen.GenerarTodos()
+	if err == nil || !strings.Contains(err.Error(), "talonario 2:") || !strings.Contains(err.Error(), "talonario 4:") {
+		t.Fatalf("se esperaba un error conjunto con los talonarios 2 y 4: %v", err)
+	}
+	if got := gen.Estadisticas().Fallidos; !slices.Equal(got, []int{2, 4}) {
+		t.Errorf("Fallidos = %v, se esperaba [2 4]", got)
+	}
+	for _, id := range []int{1, 3, 5} {
+		if _, err := os.Stat(filepath.Join(config.CarpetaSalida, fmt.Sprintf("talonario_%03d.png", id))); err != nil {
+			t.Errorf("el talonario %d debería haberse escrito: %v", id, err)
+		}
+	}
+}
+
+func TestGenerarIndice(t *testing.T) {
+	config := configPrueba(t)
+	config.ArchivoIndice = filepath.Join(config.CarpetaSalida, "indice.png")
+	config.AnchoMiniatura = 40
+	config.EtiquetarIndice = true
+	gen := nuevoGeneradorPrueba(t, config)
+
+	if err := gen.GenerarIndice(config.ArchivoIndice); err == nil {
+		t.Error("GenerarIndice antes de generar debería fallar")
+	}
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	f, err := os.Open(config.ArchivoIndice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, err := png.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 5 talonarios en 3 columnas y 2 filas de miniaturas de 40x60 con etiqueta.
+	ancho := 3*40 + 4*espaciadoIndice
+	alto := 2*(60+altoEtiquetaIndice) + 3*espaciadoIndice
+	if cfg.Width != ancho || cfg.Height != alto {
+		t.Errorf("índice de %dx%d, se esperaba %dx%d", cfg.Width, cfg.Height, ancho, alto)
+	}
+}
+
+func TestModoSalida(t *testing.T) {
+	config := configPrueba(t)
+	previo := filepath.Join(config.CarpetaSalida, "talonario_001.png")
+	if err := os.WriteFile(previo, []byte("corrida anterior"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config.ModoSalida = "error-si-existe"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con talonarios existentes")
+	}
+
+	config.ModoSalida = "subcarpeta-timestamp"
+	gen := nuevoGeneradorPrueba(t, config)
+	if filepath.Dir(gen.CarpetaSalida()) != config.CarpetaSalida {
+		t.Fatalf("CarpetaSalida = %s, se esperaba una subcarpeta de %s", gen.CarpetaSalida(), config.CarpetaSalida)
+	}
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+	if datos, err := os.ReadFile(previo); err != nil || string(datos) != "corrida anterior" {
+		t.Error("se sobrescribió el talonario de la corrida anterior")
+	}
+	if _, err := os.Stat(filepath.Join(gen.CarpetaSalida(), "talonario_001.png")); err != nil {
+		t.Errorf("no se escribió en la subcarpeta: %v", err)
+	}
+
+	config.ModoSalida = "reemplazar"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un modo de salida inválido")
+	}
+}
+
+func TestFormaBoletaCirculo(t *testing.T) {
+	config := configPrueba(t)
+	config.BoletasPorPagina = 1
+	config.BoletasPorFila = 1
+	config.AnchoTalonario = 300
+	config.AltoTalonario = 200
+	config.AnchoLineas = 4
+	config.FormaBoleta = "circulo"
+	config.ColorBorde = color.RGBA{255, 0, 0, 255}
+	gen := nuevoGeneradorPrueba(t, config)
+
+	talonario, err := gen.crearTalonario(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := gen.crearImagenTalonario(talonario)
+
+	// El círculo de diámetro 200 queda centrado: de x=50 a x=250.
+	rojo := color.RGBA{255, 0, 0, 255}
+	if got := img.RGBAAt(51, 100); got != rojo {
+		t.Errorf("el borde izquierdo del círculo es %v, se esperaba %v", got, rojo)
+	}
+	for _, p := range []image.Point{{1, 100}, {55, 190}, {298, 198}} {
+		if got := img.RGBAAt(p.X, p.Y); got.R != 0 {
+			t.Errorf("el píxel %v fuera del círculo tiene color de borde: %v", p, got)
+		}
+	}
+
+	x, ancho := cuerdaElipse(image.Rect(50, 0, 250, 200), 100, 10)
+	if x <= 50 || x+ancho >= 250 || ancho < 190 {
+		t.Errorf("cuerda en el centro = [%d, %d], se esperaba casi todo el diámetro", x, x+ancho)
+	}
+
+	config.NumeroEnEsquinas = true
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con NumeroEnEsquinas y FormaBoleta circulo")
+	}
+}
+
+func TestListadoEnOrdenDeID(t *testing.T) {
+	var registro bytes.Buffer
+	config := configPrueba(t)
+	config.TalonariosPorHoja = 2
+	config.Logger = slog.New(slog.NewJSONHandler(&registro, nil))
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	var ids []int
+	dec := json.NewDecoder(&registro)
+	for dec.More() {
+		var entrada struct {
+			Msg     string
+			ID      int
+			Numeros string
+		}
+		if err := dec.Decode(&entrada); err != nil {
+			t.Fatal(err)
+		}
+		if entrada.Msg != "números asignados" {
+			continue
+		}
+		ids = append(ids, entrada.ID)
+		talonario := gen.talonarios[entrada.ID-1]
+		if !strings.HasPrefix(entrada.Numeros, talonario.Boletas[0].Formateado+", ") {
+			t.Errorf("el listado del talonario %d no coincide con sus boletas: %q", entrada.ID, entrada.Numeros)
+		}
+	}
+	if want := []int{1, 2, 3, 4, 5}; !slices.Equal(ids, want) {
+		t.Errorf("listado en orden %v, se esperaba %v", ids, want)
+	}
+}
+
+func TestIDCorrida(t *testing.T) {
+	config := configPrueba(t)
+	config.IDCorrida = "sorteo-7"
+	config.IDCorridaEnNombres = true
+	config.MetadatosPNG = true
+	config.Manifiesto = true
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	datos, err := os.ReadFile(filepath.Join(config.CarpetaSalida, "talonario_001_sorteo-7.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(datos, []byte("tEXtIDCorrida\x00sorteo-7")) {
+		t.Error("el PNG no tiene el IDCorrida como texto")
+	}
+	if _, err := png.Decode(bytes.NewReader(datos)); err != nil {
+		t.Errorf("el PNG con metadatos no se puede leer: %v", err)
+	}
+
+	var m manifiesto
+	datos, err = os.ReadFile(filepath.Join(config.CarpetaSalida, "manifiesto.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(datos, &m); err != nil || m.IDCorrida != "sorteo-7" {
+		t.Errorf("manifiesto con id_corrida %q, se esperaba %q (%v)", m.IDCorrida, "sorteo-7", err)
+	}
+
+	config.IDCorrida = ""
+	a, b := nuevoGeneradorPrueba(t, config).IDCorrida(), nuevoGeneradorPrueba(t, config).IDCorrida()
+	if len(a) != 36 || a[14] != '4' || a == b {
+		t.Errorf("UUIDs generados %q y %q, se esperaban dos UUID v4 distintos", a, b)
+	}
+
+	config.IDCorrida = "../otra"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un IDCorrida que no sirve como nombre de archivo")
+	}
+}
+
+func TestEspaciadoLetras(t *testing.T) {
+	ultimaColumna := func(img *image.RGBA) int {
+		ultima := -1
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+				if img.RGBAAt(x, y).A > 0 {
+					ultima = x
+				}
+			}
+		}
+		return ultima
+	}
+	blanco := color.RGBA{255, 255, 255, 255}
+
+	config := configPrueba(t)
+	gen := nuevoGeneradorPrueba(t, config)
+	normal := image.NewRGBA(image.Rect(0, 0, 200, 40))
+	gen.dibujarTexto(normal, gen.config.Fuente, "0042", 10, 20, blanco)
+	anchoNormal := gen.anchoNumero(gen.config.Fuente, "0042")
+
+	config.EspaciadoLetras = 10
+	gen = nuevoGeneradorPrueba(t, config)
+	espaciado := image.NewRGBA(image.Rect(0, 0, 200, 40))
+	gen.dibujarTexto(espaciado, gen.config.Fuente, "0042", 10, 20, blanco)
+
+	if got := gen.anchoNumero(gen.config.Fuente, "0042"); got != anchoNormal+30 {
+		t.Errorf("anchoNumero = %d, se esperaba %d", got, anchoNormal+30)
+	}
+	if got, want := ultimaColumna(espaciado), ultimaColumna(normal)+30; got != want {
+		t.Errorf("el último dígito termina en x=%d, se esperaba x=%d", got, want)
+	}
+}
+
+func TestImagenBaseEmbebidaYRemota(t *testing.T) {
+	azul := color.RGBA{0, 0, 255, 255}
+	base := image.NewRGBA(image.Rect(0, 0, 8, 12))
+	draw.Draw(base, base.Bounds(), &image.Uniform{azul}, image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, base); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/plantillas/base.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	config := configPrueba(t)
+	config.Recursos = fstest.MapFS{"plantillas/base.png": {Data: buf.Bytes()}}
+	for _, ruta := range []string{"embed:plantillas/base.png", srv.URL + "/plantillas/base.png?v=2"} {
+		config.ImagenBase = ruta
+		gen := nuevoGeneradorPrueba(t, config)
+		if got := gen.crearImagenTalonario(Talonario{ID: 1}).RGBAAt(200, 300); got != azul {
+			t.Errorf("%s: centro del talonario = %v, se esperaba la imagen base azul", ruta, got)
+		}
+	}
+
+	config.ImagenBase = srv.URL + "/no-existe.png"
+	if _, err := NewGeneradorTalonarios(config); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("se esperaba un error con el estado HTTP, se obtuvo %v", err)
+	}
+
+	config.ImagenBase = "embed:plantillas/base.png"
+	config.Recursos = nil
+	if _, err := NewGeneradorTalonarios(config); err == nil || !strings.Contains(err.Error(), "Config.Recursos") {
+		t.Errorf("se esperaba un error por falta de Config.Recursos, se obtuvo %v", err)
+	}
+}
+
+func TestColoresAlternos(t *testing.T) {
+	rojo, azul := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	config := configPrueba(t)
+	config.ColoresAlternos = []color.RGBA{rojo, azul}
+	config.FondoAlterno = true
+	gen := nuevoGeneradorPrueba(t, config)
+
+	for fila, want := range []color.RGBA{rojo, azul, rojo} {
+		borde, fondo := gen.coloresBoleta(fila, 1)
+		if borde != want || fondo != (color.RGBA{want.R, want.G, want.B, 96}) {
+			t.Errorf("fila %d: borde %v y fondo %v, se esperaba %v", fila, borde, fondo, want)
+		}
+	}
+
+	// Boletas de 200x120: el borde izquierdo de la segunda fila es azul.
+	img := gen.crearImagenTalonario(Talonario{ID: 1, Boletas: make([]Boleta, config.BoletasPorPagina)})
+	if got := img.RGBAAt(0, 60); got != rojo {
+		t.Errorf("borde de la fila 0 = %v, se esperaba rojo", got)
+	}
+	if got := img.RGBAAt(0, 180); got != azul {
+		t.Errorf("borde de la fila 1 = %v, se esperaba azul", got)
+	}
+
+	config.AlternarPor = "columna"
+	gen = nuevoGeneradorPrueba(t, config)
+	if borde, _ := gen.coloresBoleta(0, 1); borde != azul {
+		t.Errorf("columna 1: borde %v, se esperaba azul", borde)
+	}
+
+	config.AlternarPor = "diagonal"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un AlternarPor inválido")
+	}
+}
+
+func TestValidarConfigSinEfectos(t *testing.T) {
+	config := configPrueba(t)
+	config.CarpetaSalida = filepath.Join(t.TempDir(), "no-se-crea")
+	config.RutaFuente = "no-existe.ttf"
+	config.ImagenBase = "no-existe.png"
+	if err := ValidarConfig(config); err != nil {
+		t.Fatalf("ValidarConfig: %v", err)
+	}
+	if _, err := os.Stat(config.CarpetaSalida); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ValidarConfig no debería crear la carpeta de salida: %v", err)
+	}
+
+	config.CantidadPaginas = 200
+	if err := ValidarConfig(config); err == nil || !strings.Contains(err.Error(), "no hay suficientes números") {
+		t.Errorf("se esperaba un error por falta de números, se obtuvo %v", err)
+	}
+
+	config.CantidadPaginas = 5
+	config.TamanoPagina = "A3"
+	if err := ValidarConfig(config); err == nil {
+		t.Error("se esperaba un error con un tamaño de página desconocido")
+	}
+}
+
+func TestNumerosPorBoleta(t *testing.T) {
+	config := configPrueba(t)
+	config.NumeroMaximo = 49
+	config.NumerosPorBoleta = 3
+	config.VerificarDuplicados = true
+	config.ArchivoJSON = filepath.Join(config.CarpetaSalida, "numeros.json")
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	// Los 50 números del rango se agotan en cada uno de los tres niveles.
+	niveles := make([][]int, 3)
+	for _, talonario := range gen.talonarios {
+		for _, boleta := range talonario.Boletas {
+			if len(boleta.Adicionales) != 2 {
+				t.Fatalf("boleta con %d números adicionales, se esperaban 2", len(boleta.Adicionales))
+			}
+			niveles[0] = append(niveles[0], boleta.Numero)
+			for k, adicional := range boleta.Adicionales {
+				niveles[k+1] = append(niveles[k+1], adicional.Numero)
+			}
+		}
+	}
+	for k, numeros := range niveles {
+		slices.Sort(numeros)
+		for i, n := range numeros {
+			if n != i {
+				t.Fatalf("el nivel %d no usa cada número una vez: %v", k+1, numeros)
+			}
+		}
+	}
+
+	datos, err := os.ReadFile(config.ArchivoJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(datos, []byte(`"adicionales":[{"numero":`)) {
+		t.Error("el JSON no incluye los números adicionales")
+	}
+
+	config.CantidadPaginas = 6
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error si un nivel no tiene suficientes números")
+	}
+	config.CantidadPaginas = 5
+	config.NumeroEnEsquinas = true
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con NumeroEnEsquinas y NumerosPorBoleta")
+	}
+}
+
+func TestTexturaFondo(t *testing.T) {
+	// Teja de 3x2 con la columna izquierda roja y el resto azul.
+	rojo, azul := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	teja := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	draw.Draw(teja, teja.Bounds(), &image.Uniform{azul}, image.Point{}, draw.Src)
+	draw.Draw(teja, image.Rect(0, 0, 1, 2), &image.Uniform{rojo}, image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, teja); err != nil {
+		t.Fatal(err)
+	}
+
+	config := configPrueba(t)
+	config.Recursos = fstest.MapFS{"grano.png": {Data: buf.Bytes()}}
+	config.TexturaFondo = "embed:grano.png"
+	gen := nuevoGeneradorPrueba(t, config)
+	img := gen.crearImagenTalonario(Talonario{ID: 1})
+
+	// Lejos de los bordes de las boletas, la teja se repite cada 3 píxeles.
+	for _, x := range []int{99, 300} {
+		if got := img.RGBAAt(x, 250); got != rojo {
+			t.Errorf("x=%d: %v, se esperaba la columna roja de la teja", x, got)
+		}
+		if got := img.RGBAAt(x+1, 250); got != azul {
+			t.Errorf("x=%d: %v, se esperaba azul", x+1, got)
+		}
+	}
+
+	config.OpacidadTextura = 0.5
+	gen = nuevoGeneradorPrueba(t, config)
+	if got := gen.crearImagenTalonario(Talonario{ID: 1}).RGBAAt(100, 250); got.B < 120 || got.B > 135 {
+		t.Errorf("con opacidad 0.5 se esperaba azul a media intensidad sobre negro, se obtuvo %v", got)
+	}
+}
+
+func TestMostrarRango(t *testing.T) {
+	hayTexto := func(img *image.RGBA, zona image.Rectangle) bool {
+		for y := zona.Min.Y; y < zona.Max.Y; y++ {
+			for x := zona.Min.X; x < zona.Max.X; x++ {
+				if img.RGBAAt(x, y).R > 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	config := configPrueba(t)
+	config.MargenInferior = 40
+	talonario := Talonario{ID: 1, Boletas: []Boleta{{Numero: 981, Formateado: "981"}, {Numero: 42, Formateado: "042"}}}
+	margen := image.Rect(200, 560, 400, 600)
+
+	gen := nuevoGeneradorPrueba(t, config)
+	if hayTexto(gen.crearImagenTalonario(talonario), margen) {
+		t.Fatal("sin MostrarRango no debería haber texto en el margen inferior")
+	}
+
+	config.MostrarRango = true
+	gen = nuevoGeneradorPrueba(t, config)
+	if !hayTexto(gen.crearImagenTalonario(talonario), margen) {
+		t.Error("no se dibujó el rango en el margen inferior")
+	}
+
+	// El rango se escribe como el pie, sin el estilo de los números
+	sinEstilo := gen.crearImagenTalonario(talonario).SubImage(margen).(*image.RGBA)
+	config.GrosorContorno = 2
+	config.ContornoTexto = color.RGBA{255, 0, 0, 255}
+	config.SombraTexto = true
+	config.EspaciadoLetras = 3
+	conEstilo := nuevoGeneradorPrueba(t, config).crearImagenTalonario(talonario).SubImage(margen).(*image.RGBA)
+	for y := margen.Min.Y; y < margen.Max.Y; y++ {
+		for x := margen.Min.X; x < margen.Max.X; x++ {
+			if conEstilo.RGBAAt(x, y) != sinEstilo.RGBAAt(x, y) {
+				t.Fatalf("el rango cambió con el estilo de los números en (%d, %d)", x, y)
+			}
+		}
+	}
+
+	config.MargenInferior = 0
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con MostrarRango y sin MargenInferior")
+	}
+}
+
+func TestRepartirSobrante(t *testing.T) {
+	config := configPrueba(t)
+	config.BoletasPorPagina = 12
+	config.BoletasPorFila = 3
+	config.CantidadPaginas = 1
+	config.AnchoTalonario = 400
+	config.AltoTalonario = 603
+	config.MargenIzquierdo = 5
+	config.MargenDerecho = 6
+	config.AnchoLineas = 1
+	config.ColorLinea = color.RGBA{0, 0, 255, 255}
+	blanco := color.RGBA{255, 255, 255, 255}
+	talonario := Talonario{ID: 1, Boletas: make([]Boleta, config.BoletasPorPagina)}
+
+	// 389 píxeles útiles en 3 columnas de 129 y 603 en 4 filas de 150.
+	derecha := config.AnchoTalonario - config.MargenDerecho - 1
+	abajo := config.AltoTalonario - config.MargenInferior - 1
+
+	gen := nuevoGeneradorPrueba(t, config)
+	img := gen.crearImagenTalonario(talonario)
+	if img.RGBAAt(derecha, 300) == blanco || img.RGBAAt(200, abajo) == blanco {
+		t.Fatal("sin RepartirSobrante la cuadrícula no debería llegar a los márgenes")
+	}
+
+	config.RepartirSobrante = true
+	gen = nuevoGeneradorPrueba(t, config)
+	if got := gen.bordesCeldas(389, 3, 129); !slices.Equal(got, []int{0, 130, 260, 389}) {
+		t.Errorf("bordesCeldas = %v, se esperaba [0 130 260 389]", got)
+	}
+	img = gen.crearImagenTalonario(talonario)
+	if got := img.RGBAAt(derecha, 300); got != blanco {
+		t.Errorf("el borde derecho de la última columna no llega a Ancho - MargenDerecho: x=%d es %v", derecha, got)
+	}
+	if got := img.RGBAAt(200, abajo); got != blanco {
+		t.Errorf("el borde inferior de la última fila no llega a Alto - MargenInferior: y=%d es %v", abajo, got)
+	}
+}
+
+func TestSalidaEstandar(t *testing.T) {
+	var buf bytes.Buffer
+	anterior := escritorEstandar
+	escritorEstandar = &buf
+	t.Cleanup(func() { escritorEstandar = anterior })
+
+	config := configPrueba(t)
+	config.CarpetaSalida = salidaEstandar
+	if _, err := NewGeneradorTalonarios(config); err == nil || !strings.Contains(err.Error(), "salida estándar") {
+		t.Fatalf("se esperaba un error con 5 talonarios a la salida estándar, obtuve %v", err)
+	}
+
+	config.SoloPrimera = true
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("la salida estándar no tiene un PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 400 || b.Dy() != 600 {
+		t.Errorf("tamaño = %v, se esperaba 400x600", b.Size())
+	}
+	if _, err := os.Stat(salidaEstandar); !os.IsNotExist(err) {
+		t.Errorf("no debería crearse una carpeta %q", salidaEstandar)
+	}
+
+	config.Manifiesto = true
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con Manifiesto y la salida estándar")
+	}
+	config.Manifiesto = false
+
+	// Solo se escribe el último de los tres talonarios
+	config.SoloPrimera = false
+	config.CantidadPaginas = 3
+	config.ComenzarDesde = 3
+	if _, err := NewGeneradorTalonarios(config); err != nil {
+		t.Errorf("ComenzarDesde 3 de 3 escribe una sola imagen: %v", err)
+	}
+	config.ComenzarDesde = 2
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con dos talonarios a la salida estándar")
+	}
+	config.SoloPrimera = true
+	config.ComenzarDesde = 0
+
+	// El índice se escribiría como un segundo PNG en la salida estándar
+	config.ArchivoIndice = filepath.Join(t.TempDir(), "indice.png")
+	if _, err := NewGeneradorTalonarios(config); err == nil || !strings.Contains(err.Error(), "ArchivoIndice") {
+		t.Errorf("se esperaba un error con ArchivoIndice y la salida estándar, obtuve %v", err)
+	}
+}
+
+func TestNumerosRequeridos(t *testing.T) {
+	config := configPrueba(t)
+	config.CarpetaSalida = ""
+	config.CopiasPorNumero = 2
+	config.NumerosPorBoleta = 3
+	got, err := NumerosRequeridos(config)
+	if err != nil || got != 10*5/2*3 {
+		t.Fatalf("NumerosRequeridos = %d, %v; se esperaba 75, nil", got, err)
+	}
+
+	// 0-999 sin repetidos (10) ni secuenciales deja menos de 990 números.
+	config.CopiasPorNumero = 0
+	config.NumerosPorBoleta = 0
+	config.BoletasPorPagina = 99
+	config.CantidadPaginas = 10
+	if _, err := NumerosRequeridos(config); err != nil {
+		t.Fatalf("990 de 1000 números deberían alcanzar: %v", err)
+	}
+	config.ExcluirRepetidos = true
+	config.ExcluirSecuenciales = true
+	if got, err := NumerosRequeridos(config); err == nil || got != 990 {
+		t.Errorf("NumerosRequeridos = %d, %v; se esperaba 990 y un error por los excluidos", got, err)
+	}
+
+	config.ExcluirRepetidos = false
+	config.ExcluirSecuenciales = false
+	config.CantidadPaginas = 1
+	config.Tandas = []TemaConfig{{}, {}, {}}
+	if got, _ := NumerosRequeridos(config); got != 99 {
+		t.Errorf("sin CompartirNumeros las tandas no suman: %d", got)
+	}
+	config.CompartirNumeros = true
+	if got, _ := NumerosRequeridos(config); got != 297 {
+		t.Errorf("con CompartirNumeros se esperaban 297, obtuve %d", got)
+	}
+}
+
+func TestNumeroTalonarioVisible(t *testing.T) {
+	hayTexto := func(img *image.RGBA, zona image.Rectangle) bool {
+		for y := zona.Min.Y; y < zona.Max.Y; y++ {
+			for x := zona.Min.X; x < zona.Max.X; x++ {
+				if img.RGBAAt(x, y).R > 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	config := configPrueba(t)
+	config.MargenSuperior = 60
+	talonario := Talonario{ID: 12, Boletas: []Boleta{{Numero: 7, Formateado: "007"}}}
+	arribaDerecha := image.Rect(200, 0, 400, 59)
+
+	gen := nuevoGeneradorPrueba(t, config)
+	if hayTexto(gen.crearImagenTalonario(talonario), arribaDerecha) {
+		t.Fatal("sin NumeroTalonarioVisible no debería haber texto en el margen superior")
+	}
+
+	config.NumeroTalonarioVisible = true
+	gen = nuevoGeneradorPrueba(t, config)
+	if !hayTexto(gen.crearImagenTalonario(talonario), arribaDerecha) {
+		t.Error("no se dibujó el número de talonario arriba a la derecha")
+	}
+
+	config.XNumeroTalonario, config.YNumeroTalonario = 10, 590
+	gen = nuevoGeneradorPrueba(t, config)
+	img := gen.crearImagenTalonario(talonario)
+	if hayTexto(img, arribaDerecha) || !hayTexto(img, image.Rect(10, 570, 200, 590)) {
+		t.Error("el número de talonario no respetó la posición configurada")
+	}
+
+	config.YNumeroTalonario = -1
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con una posición negativa")
+	}
+}
+
+func TestImagenSoloEn(t *testing.T) {
+	base := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(base, base.Bounds(), &image.Uniform{color.RGBA{0, 255, 0, 255}}, image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, base); err != nil {
+		t.Fatal(err)
+	}
+	ruta := filepath.Join(t.TempDir(), "base.png")
+	if err := os.WriteFile(ruta, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := configPrueba(t)
+	config.ImagenBase = ruta
+	config.ImagenSoloEn = "ultimo"
+	gen := nuevoGeneradorPrueba(t, config)
+	for id, verde := range map[int]bool{1: false, 4: false, 5: true} {
+		img := gen.crearImagenTalonario(Talonario{ID: id})
+		if got := img.RGBAAt(190, 20).G == 255; got != verde {
+			t.Errorf("talonario %d: imagen base = %v, se esperaba %v", id, got, verde)
+		}
+	}
+
+	config.ImagenSoloEn = "portada"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con ImagenSoloEn inválido")
+	}
+}
+
+func TestNivelCompresion(t *testing.T) {
+	config := configPrueba(t)
+	talonario := Talonario{ID: 1, Boletas: []Boleta{{Numero: 7, Formateado: "007"}, {Numero: 42, Formateado: "042"}}}
+
+	tamanos := map[string]int{}
+	for _, nivel := range []string{"ninguna", "", "maxima"} {
+		config.NivelCompresion = nivel
+		gen := nuevoGeneradorPrueba(t, config)
+		var buf bytes.Buffer
+		if err := gen.codificarImagen(&buf, gen.crearImagenTalonario(talonario)); err != nil {
+			t.Fatalf("%q: %v", nivel, err)
+		}
+		if _, err := png.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatalf("%q: PNG inválido: %v", nivel, err)
+		}
+		tamanos[nivel] = buf.Len()
+	}
+	t.Logf("bytes por nivel: %v", tamanos)
+	if !(tamanos["ninguna"] > tamanos[""] && tamanos[""] >= tamanos["maxima"]) {
+		t.Errorf("los tamaños no siguen el nivel de compresión: %v", tamanos)
+	}
+
+	config.NivelCompresion = "ultra"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un nivel de compresión inválido")
+	}
+}
+
+func TestGenerarReverso(t *testing.T) {
+	config := configPrueba(t)
+	config.CantidadPaginas = 2
+	config.GenerarReverso = true
+	config.TextoReverso = "Boleta {numero}\nTalonario {id}"
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+	for _, nombre := range []string{"talonario_001_reverso.png", "talonario_002_reverso.png"} {
+		if _, err := os.Stat(filepath.Join(config.CarpetaSalida, nombre)); err != nil {
+			t.Errorf("falta %s: %v", nombre, err)
+		}
+	}
+
+	// La primera boleta del frente, arriba a la izquierda, queda arriba a la
+	// derecha en el reverso.
+	hayTexto := func(img *image.RGBA, zona image.Rectangle) bool {
+		for y := zona.Min.Y; y < zona.Max.Y; y++ {
+			for x := zona.Min.X; x < zona.Max.X; x++ {
+				if img.RGBAAt(x, y).R > 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	config.TextoReverso = "{numero}"
+	gen = nuevoGeneradorPrueba(t, config)
+	img := gen.crearImagenReverso(Talonario{ID: 1, Boletas: []Boleta{{Numero: 7, Formateado: "007"}, {}}})
+	if !hayTexto(img, image.Rect(210, 10, 390, 110)) || hayTexto(img, image.Rect(10, 10, 190, 110)) {
+		t.Error("el reverso no está en espejo respecto del frente")
+	}
+
+	config.TalonariosPorHoja = 2
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con GenerarReverso y TalonariosPorHoja")
+	}
+}
+
+func TestUnArchivoPorBoleta(t *testing.T) {
+	config := configPrueba(t)
+	config.CantidadPaginas = 2
+	config.BoletasPorPagina = 4
+	config.UnArchivoPorBoleta = true
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+	if n, _ := filepath.Glob(filepath.Join(config.CarpetaSalida, "talonario_*")); len(n) > 0 {
+		t.Errorf("no se esperaban imágenes de talonarios: %v", n)
+	}
+	for _, talonario := range gen.talonarios {
+		for _, boleta := range talonario.Boletas {
+			img, err := leerPNG(filepath.Join(config.CarpetaSalida, "boleta_"+boleta.Formateado+".png"))
+			if err != nil {
+				t.Fatalf("boleta %s: %v", boleta.Formateado, err)
+			}
+			if img.Bounds().Dx() != 200 || img.Bounds().Dy() != 300 {
+				t.Errorf("boleta %s de %v, se esperaba 200x300", boleta.Formateado, img.Bounds())
+			}
+		}
+	}
+
+	// Cada boleta lleva el recorte de la imagen base que le toca en el talonario
+	base := image.NewRGBA(image.Rect(0, 0, 400, 600))
+	for y := range 600 {
+		for x := range 400 {
+			base.Set(x, y, color.RGBA{uint8(x / 2), uint8(y / 3), 100, 255})
+		}
+	}
+	gen.imagenBase = base
+	talonario := gen.talonarios[0]
+	completo := gen.crearImagenTalonario(talonario)
+	if got, want := gen.crearImagenBoleta(talonario, 3).At(10, 10), completo.At(210, 310); got != want {
+		t.Errorf("recorte de la boleta 4 = %v, se esperaba %v", got, want)
+	}
+
+	config.CopiasPorNumero = 2
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con UnArchivoPorBoleta y CopiasPorNumero")
+	}
+}
+
+func TestDesplazamientoGrid(t *testing.T) {
+	config := configPrueba(t)
+	config.MargenSuperior, config.MargenInferior = 10, 10
+	config.MargenIzquierdo, config.MargenDerecho = 10, 10
+	config.LineasColumna = true
+	talonario := Talonario{ID: 1, Boletas: []Boleta{{Numero: 7, Formateado: "007"}, {Numero: 8, Formateado: "008"}}}
+	quieta := nuevoGeneradorPrueba(t, config).crearImagenTalonario(talonario)
+
+	config.DesplazamientoGridX, config.DesplazamientoGridY = 7, -3
+	corrida := nuevoGeneradorPrueba(t, config).crearImagenTalonario(talonario)
+	for y := 10; y < 580; y += 3 {
+		for x := 10; x < 380; x += 3 {
+			if quieta.RGBAAt(x, y) != corrida.RGBAAt(x+7, y-3) {
+				t.Fatalf("el píxel (%d,%d) no se corrió a (%d,%d)", x, y, x+7, y-3)
+			}
+		}
+	}
+
+	config.DesplazamientoGridX = 11
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un desplazamiento mayor que el margen")
+	}
+}
+
+func TestNumerosPredefinidos(t *testing.T) {
+	config := configPrueba(t)
+	config.CantidadPaginas = 2
+	config.BoletasPorPagina = 4
+	config.CopiasPorNumero = 2
+	config.NumerosPredefinidos = []int{5, 900, 17, 333}
+	gen := nuevoGeneradorPrueba(t, config)
+	var numeros []int
+	for id := 1; id <= 2; id++ {
+		talonario, err := gen.crearTalonario(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, boleta := range talonario.Boletas {
+			numeros = append(numeros, boleta.Numero)
+		}
+	}
+	if want := []int{5, 5, 900, 900, 17, 17, 333, 333}; !slices.Equal(numeros, want) {
+		t.Errorf("números = %v, se esperaba %v", numeros, want)
+	}
+
+	casos := []struct {
+		nombre    string
+		modificar func(*Config)
+	}{
+		{"cantidad", func(c *Config) { c.NumerosPredefinidos = []int{5, 900, 17} }},
+		{"repetido", func(c *Config) { c.NumerosPredefinidos = []int{5, 900, 17, 5} }},
+		{"fuera de rango", func(c *Config) { c.NumerosPredefinidos = []int{5, 900, 17, 1000} }},
+		{"varios niveles", func(c *Config) { c.NumerosPorBoleta = 2 }},
+	}
+	for _, caso := range casos {
+		c := config
+		caso.modificar(&c)
+		if _, err := NewGeneradorTalonarios(c); err == nil {
+			t.Errorf("%s: se esperaba un error", caso.nombre)
+		}
+	}
+}
+
+func TestNumerosDisponibles(t *testing.T) {
+	disponibles := []int{3, 141, 592, 653, 589, 793, 238, 462}
+	for _, estrategia := range []string{"rechazo", "permutacion"} {
+		config := configPrueba(t)
+		config.CantidadPaginas = 2
+		config.BoletasPorPagina = 4
+		config.EstrategiaNumeros = estrategia
+		config.NumerosDisponibles = disponibles
+		gen := nuevoGeneradorPrueba(t, config)
+		var numeros []int
+		for id := 1; id <= 2; id++ {
+			talonario, err := gen.crearTalonario(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, boleta := range talonario.Boletas {
+				numeros = append(numeros, boleta.Numero)
+			}
+		}
+		slices.Sort(numeros)
+		if want := slices.Sorted(slices.Values(disponibles)); !slices.Equal(numeros, want) {
+			t.Errorf("%s: números = %v, se esperaba %v", estrategia, numeros, want)
+		}
+	}
+
+	config := configPrueba(t)
+	config.NumerosDisponibles = disponibles[:3]
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con menos números disponibles que boletas")
+	}
+	config.NumerosDisponibles = []int{5, 5}
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un número repetido")
+	}
+	config.NumerosDisponibles = []int{1000}
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un número fuera de rango")
+	}
+}
+
+func TestPaso(t *testing.T) {
+	for _, estrategia := range []string{"rechazo", "permutacion"} {
+		config := configPrueba(t)
+		config.NumeroMinimo = 100
+		config.Paso = 100
+		config.BoletasPorPagina = 9
+		config.BoletasPorFila = 3
+		config.EstrategiaNumeros = estrategia
+		config.CantidadPaginas = 1
+		talonario, err := nuevoGeneradorPrueba(t, config).crearTalonario(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var numeros []int
+		for _, boleta := range talonario.Boletas {
+			numeros = append(numeros, boleta.Numero)
+		}
+		slices.Sort(numeros)
+		if want := []int{100, 200, 300, 400, 500, 600, 700, 800, 900}; !slices.Equal(numeros, want) {
+			t.Errorf("%s: números = %v, se esperaba %v", estrategia, numeros, want)
+		}
+	}
+
+	config := configPrueba(t)
+	config.Paso = 100
+	if n, err := NumerosRequeridos(config); err == nil {
+		t.Errorf("se esperaba un error: %d números con Paso 100 en 0-999", n)
+	}
+	config.Paso = -1
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con Paso negativo")
+	}
+}
+
+func TestParidadNumeros(t *testing.T) {
+	for _, estrategia := range []string{"rechazo", "permutacion"} {
+		for paridad, resto := range map[string]int{"pares": 0, "impares": 1} {
+			config := configPrueba(t)
+			config.NumeroMaximo = 99
+			config.ParidadNumeros = paridad
+			config.EstrategiaNumeros = estrategia
+			gen := nuevoGeneradorPrueba(t, config)
+			if gen.disponibles != 50 {
+				t.Errorf("%s, %s: %d disponibles, se esperaban 50", estrategia, paridad, gen.disponibles)
+			}
+			for i := 1; i <= config.CantidadPaginas; i++ {
+				talonario, err := gen.crearTalonario(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, boleta := range talonario.Boletas {
+					if boleta.Numero%2 != resto {
+						t.Fatalf("%s, %s: salió el %d", estrategia, paridad, boleta.Numero)
+					}
+				}
+			}
+		}
+	}
+
+	config := configPrueba(t)
+	config.NumeroMaximo = 79
+	config.ParidadNumeros = "pares"
+	if n, err := NumerosRequeridos(config); err == nil {
+		t.Errorf("se esperaba un error: %d números con solo 40 pares", n)
+	}
+	config.ParidadNumeros = "primos"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con una paridad inválida")
+	}
+}
+
+func TestBloqueReservado(t *testing.T) {
+	config := configPrueba(t)
+	config.NumeroMaximo = 99
+	config.BloqueReservado = [2]int{90, 99}
+	config.CantidadPaginas = 9
+	config.ArchivoJSON = filepath.Join(config.CarpetaSalida, "numeros.json")
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+	for _, talonario := range gen.talonarios {
+		for _, boleta := range talonario.Boletas {
+			if boleta.Numero >= 90 {
+				t.Fatalf("el sorteo normal asignó el número reservado %d", boleta.Numero)
+			}
+		}
+	}
+	config.CantidadPaginas = 10
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error: sin el bloque no alcanzan los números")
+	}
+
+	config.CantidadPaginas = 9
+	config.NumeroMaximo = 999
+	if err := GenerarReservados(config, 1); err != nil {
+		t.Fatalf("GenerarReservados: %v", err)
+	}
+	datos, err := os.ReadFile(filepath.Join(config.CarpetaSalida, "reservados", "numeros.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reservados []Talonario
+	if err := json.Unmarshal(datos, &reservados); err != nil {
+		t.Fatal(err)
+	}
+	if len(reservados) != 1 {
+		t.Fatalf("se escribieron %d talonarios reservados, se esperaba 1", len(reservados))
+	}
+	for _, boleta := range reservados[0].Boletas {
+		if boleta.Numero < 90 || boleta.Numero > 99 || len(boleta.Formateado) != 3 {
+			t.Errorf("boleta reservada %d (%q) fuera del bloque o sin el relleno de la corrida", boleta.Numero, boleta.Formateado)
+		}
+	}
+
+	config.BloqueReservado = [2]int{99, 90}
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un bloque invertido")
+	}
+}
+
+func TestSupersampling(t *testing.T) {
+	config := configPrueba(t)
+	config.RutaFuente = "calibri-bold.ttf"
+	config.TamanoFuente = 30
+	config.TextoPie = "Talonario {id}"
+	gen := nuevoGeneradorPrueba(t, config)
+	talonario, err := gen.crearTalonario(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	normal := gen.crearImagenTalonario(talonario)
+
+	config.Supersampling = 1
+	if img := nuevoGeneradorPrueba(t, config).crearImagenTalonario(talonario); !bytes.Equal(img.Pix, normal.Pix) {
+		t.Error("con Supersampling 1 la imagen debería quedar igual")
+	}
+
+	grises := func(img *image.RGBA) int {
+		n := 0
+		for i := 0; i < len(img.Pix); i += 4 {
+			if v := img.Pix[i]; v != 0 && v != 255 {
+				n++
+			}
+		}
+		return n
+	}
+	config.Supersampling = 2
+	gen = nuevoGeneradorPrueba(t, config)
+	if gen.supermuestreo == nil || gen.supermuestreo.config.AnchoTalonario != 800 || gen.supermuestreo.config.TamanoFuente != 60 {
+		t.Fatal("el generador ampliado no duplicó las medidas")
+	}
+	img := gen.crearImagenTalonario(talonario)
+	if img.Bounds() != normal.Bounds() {
+		t.Fatalf("tamaño = %v, se esperaba %v", img.Bounds(), normal.Bounds())
+	}
+	if grises(img) <= grises(normal) {
+		t.Errorf("se esperaban más píxeles intermedios con supermuestreo: %d, sin él %d", grises(img), grises(normal))
+	}
+	// Las zonas lisas no cambian al promediar
+	if got, want := img.RGBAAt(0, 0), normal.RGBAAt(0, 0); got != want {
+		t.Errorf("esquina = %v, se esperaba %v", got, want)
+	}
+
+	config.Supersampling = 5
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con Supersampling 5")
+	}
+}
+
+func TestReducirImagen(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.SetRGBA(0, 0, color.RGBA{255, 255, 255, 255})
+	img.SetRGBA(1, 1, color.RGBA{255, 255, 255, 255})
+	if got, want := reducirImagen(img, 2).RGBAAt(0, 0), (color.RGBA{128, 128, 128, 128}); got != want {
+		t.Errorf("promedio = %v, se esperaba %v", got, want)
+	}
+}
+
+func TestPostProcesar(t *testing.T) {
+	config := configPrueba(t)
+	var ids []int
+	rojo := color.RGBA{255, 0, 0, 255}
+	config.PostProcesar = func(id int, img *image.RGBA) error {
+		ids = append(ids, id)
+		img.SetRGBA(0, 0, rojo)
+		if id == 3 {
+			return errors.New("sello no disponible")
+		}
+		return nil
+	}
+	gen := nuevoGeneradorPrueba(t, config)
+	err := gen.GenerarTodos()
+	if err == nil || !strings.Contains(err.Error(), "sello no disponible") {
+		t.Fatalf("GenerarTodos = %v, se esperaba el error de PostProcesar", err)
+	}
+	if !slices.Equal(ids, []int{1, 2, 3}) {
+		t.Errorf("ids = %v, se esperaba [1 2 3]", ids)
+	}
+	if _, err := os.Stat(filepath.Join(config.CarpetaSalida, "talonario_003.png")); err == nil {
+		t.Error("el talonario que falló en PostProcesar no debería guardarse")
+	}
+
+	img, err := leerPNG(filepath.Join(config.CarpetaSalida, "talonario_001.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 0)); got != rojo {
+		t.Errorf("píxel (0, 0) = %v, se esperaba el rojo de PostProcesar", got)
+	}
+}
+
+func TestFuentesNumeroYEtiqueta(t *testing.T) {
+	ruta := filepath.Join(t.TempDir(), "goregular.ttf")
+	if err := os.WriteFile(ruta, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ancho := func(face font.Face) int { return font.MeasureString(face, "Talonario 0123").Round() }
+
+	config := configPrueba(t)
+	config.RutaFuente = "calibri-bold.ttf"
+	config.TamanoFuente = 30
+	gen := nuevoGeneradorPrueba(t, config)
+	if ancho(gen.fuentePie) != ancho(gen.config.Fuente) {
+		t.Fatal("con una sola fuente las etiquetas deberían usar la del número")
+	}
+	calibri := ancho(gen.config.Fuente)
+
+	config.FuenteEtiqueta = FuenteConfig{Ruta: ruta}
+	config.Decoraciones = []Decoracion{{Tipo: "texto", Texto: "x"}, {Tipo: "texto", Texto: "x", Fuente: "numero"}}
+	gen = nuevoGeneradorPrueba(t, config)
+	etiqueta := ancho(gen.fuentePie)
+	if etiqueta == calibri {
+		t.Errorf("el pie debería usar FuenteEtiqueta: %d, número %d", etiqueta, calibri)
+	}
+	if ancho(gen.fuentesDecor[0]) != etiqueta || ancho(gen.fuentesDecor[1]) != calibri {
+		t.Errorf("decoraciones: etiqueta %d y número %d, se esperaba %d y %d",
+			ancho(gen.fuentesDecor[0]), ancho(gen.fuentesDecor[1]), etiqueta, calibri)
+	}
+
+	config.FuenteNumero = FuenteConfig{Ruta: ruta, Tamano: 20}
+	gen = nuevoGeneradorPrueba(t, config)
+	if gen.config.RutaFuente != ruta || gen.config.TamanoFuente != 20 {
+		t.Errorf("FuenteNumero no reemplazó a RutaFuente: %q a %v", gen.config.RutaFuente, gen.config.TamanoFuente)
+	}
+
+	config.Decoraciones[1].Fuente = "titulo"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con una fuente de decoración inválida")
+	}
+}
+
+func TestFuenteRespaldo(t *testing.T) {
+	ruta := filepath.Join(t.TempDir(), "goregular.ttf")
+	if err := os.WriteFile(ruta, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// basicfont no tiene la omega; goregular sí
+	config := configPrueba(t)
+	config.FuenteRespaldo = ruta
+	config.TextoPie = "Ω"
+	gen := nuevoGeneradorPrueba(t, config)
+	if _, ok := basicfont.Face7x13.GlyphAdvance('Ω'); ok {
+		t.Fatal("la prueba necesita una runa que falte en basicfont")
+	}
+	if _, ok := gen.fuentePie.GlyphAdvance('Ω'); !ok {
+		t.Error("la fuente del pie no toma la omega de la fuente de respaldo")
+	}
+	if a, b := font.MeasureString(gen.fuentePie, "AΩ"), font.MeasureString(gen.fuentePie, "A\ufe0fΩ"); a != b {
+		t.Errorf("el selector de variación ocupa lugar: %v != %v", b, a)
+	}
+	if got, want := font.MeasureString(gen.fuentePie, "A"), font.MeasureString(basicfont.Face7x13, "A"); got != want {
+		t.Errorf("las runas de la fuente principal cambiaron de ancho: %v != %v", got, want)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	gen.dibujarTextoCon(img, gen.fuentePie, "Ω", 5, 10, color.RGBA{255, 255, 255, 255})
+	tinta := 0
+	for _, v := range img.Pix {
+		if v > 0 {
+			tinta++
+		}
+	}
+	if tinta == 0 {
+		t.Error("la omega no se dibujó")
+	}
+}
+
+func TestTalonariosIterador(t *testing.T) {
+	config := configPrueba(t)
+	gen := nuevoGeneradorPrueba(t, config)
+	var ids []int
+	for talonario, err := range gen.Talonarios(context.Background()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, talonario.ID)
+		if talonario.ID == 2 {
+			break
+		}
+	}
+	if !slices.Equal(ids, []int{1, 2}) {
+		t.Errorf("ids = %v, se esperaba [1 2]", ids)
+	}
+	if want := 2 * config.BoletasPorPagina; gen.numerosUsados.cantidad != want {
+		t.Errorf("se sortearon %d números después de cortar, se esperaban %d", gen.numerosUsados.cantidad, want)
+	}
+
+	// Con la misma Semilla, los talonarios coinciden con los de crearTalonario
+	esperado, err := nuevoGeneradorPrueba(t, config).crearTalonario(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for talonario, err := range nuevoGeneradorPrueba(t, config).Talonarios(context.Background()) {
+		if err != nil || !reflect.DeepEqual(talonario.Boletas, esperado.Boletas) {
+			t.Errorf("el primer talonario no coincide: %v", err)
+		}
+		break
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, err := range gen.Talonarios(ctx) {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, se esperaba context.Canceled", err)
+		}
+	}
+}
+
+func TestGenerarTodosContextCancelado(t *testing.T) {
+	// Se cancela al terminar de dibujar el segundo talonario: ese se guarda y
+	// la corrida se detiene antes del tercero.
+	const n = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := configPrueba(t)
+	config.PostProcesar = func(id int, img *image.RGBA) error {
+		if id == n {
+			cancel()
+		}
+		return nil
+	}
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodosContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GenerarTodosContext = %v, se esperaba context.Canceled", err)
+	}
+
+	archivos, err := filepath.Glob(filepath.Join(config.CarpetaSalida, "talonario_*.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archivos) != n {
+		t.Errorf("se escribieron %d talonarios, se esperaban %d: %v", len(archivos), n, archivos)
+	}
+}
+
+func TestGeneradorUnSoloUso(t *testing.T) {
+	usos := map[string]func(*GeneradorTalonarios) error{
+		"GenerarTodos": (*GeneradorTalonarios).GenerarTodos,
+		"GenerarStream": func(g *GeneradorTalonarios) error {
+			resultados, err := g.GenerarStream(context.Background())
+			if err != nil {
+				return err
+			}
+			for r := range resultados {
+				if r.Err != nil {
+					return r.Err
+				}
+			}
+			return nil
+		},
+		"Talonarios": func(g *GeneradorTalonarios) error {
+			for _, err := range g.Talonarios(context.Background()) {
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	for primero, usar := range usos {
+		for segundo, reusar := range usos {
+			gen := nuevoGeneradorPrueba(t, configPrueba(t))
+			if err := usar(gen); err != nil {
+				t.Fatalf("%s: %v", primero, err)
+			}
+			if err := reusar(gen); !errors.Is(err, ErrGeneradorUsado) {
+				t.Errorf("%s después de %s = %v, se esperaba ErrGeneradorUsado", segundo, primero, err)
+			}
+		}
+	}
+
+	// Las funciones de paquete arman generadores nuevos en cada llamada
+	config := configPrueba(t)
+	config.Tandas = []TemaConfig{{Nombre: "a"}}
+	config.BloqueReservado = [2]int{900, 999}
+	for range 2 {
+		if err := GenerarTandas(config); err != nil {
+			t.Errorf("GenerarTandas: %v", err)
+		}
+		if err := GenerarReservados(config, 1); err != nil {
+			t.Errorf("GenerarReservados: %v", err)
+		}
+	}
+}
+
+func TestSumaTalonario(t *testing.T) {
+	config := configPrueba(t)
+	config.CopiasPorNumero = 2
+	config.NumerosPorBoleta = 2
+	config.ArchivoJSON = filepath.Join(t.TempDir(), "numeros.json")
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	for _, talonario := range gen.talonarios {
+		suma := 0
+		for _, boleta := range talonario.Boletas {
+			suma += boleta.Numero + boleta.Adicionales[0].Numero
+		}
+		if talonario.Suma != suma || talonario.Paridad != []string{"par", "impar"}[suma%2] {
+			t.Errorf("talonario %d: suma %d (%s), se esperaba %d", talonario.ID, talonario.Suma, talonario.Paridad, suma)
+		}
+	}
+
+	datos, err := os.ReadFile(config.ArchivoJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exportados []Talonario
+	if err := json.Unmarshal(datos, &exportados); err != nil {
+		t.Fatal(err)
+	}
+	if exportados[0].Suma != gen.talonarios[0].Suma || exportados[0].Paridad == "" {
+		t.Errorf("el JSON no incluye la suma: %+v", exportados[0])
+	}
+}
+
+func TestGradienteTexto(t *testing.T) {
+	rojo, verde, azul := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}
+	if got := colorEnGradiente([]color.RGBA{rojo, verde, azul}, 0.25); got != (color.RGBA{128, 128, 0, 255}) {
+		t.Errorf("colorEnGradiente(0.25) = %v", got)
+	}
+
+	config := configPrueba(t)
+	config.RutaFuente = "calibri-bold.ttf"
+	config.TamanoFuente = 40
+	config.GradienteTexto = []color.RGBA{rojo, azul}
+	gen := nuevoGeneradorPrueba(t, config)
+	img := image.NewRGBA(image.Rect(0, 0, 200, 60))
+	gen.dibujarNumero(img, gen.config.Fuente, "0000", 10, 30)
+
+	// El primer y el último píxel de tinta, recorriendo columnas
+	var primero, ultimo color.RGBA
+	for x := range 200 {
+		for y := range 60 {
+			if c := img.RGBAAt(x, y); c.A > 0 && int(c.R)+int(c.B) > 200 {
+				if primero.A == 0 {
+					primero = c
+				}
+				ultimo = c
+			}
+		}
+	}
+	if primero.R <= primero.B || ultimo.B <= ultimo.R {
+		t.Errorf("el degradado no va de rojo a azul: primero %v, último %v", primero, ultimo)
+	}
+}
+
+func TestRenderizarSoloMemoria(t *testing.T) {
+	config := configPrueba(t)
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.RenderizarSoloMemoria(config.CantidadPaginas); err != nil {
+		t.Fatalf("RenderizarSoloMemoria: %v", err)
+	}
+	if gen.numerosUsados.cantidad != 0 || len(gen.talonarios) != 0 {
+		t.Error("RenderizarSoloMemoria no debería consumir números del generador")
+	}
+	if entradas, _ := os.ReadDir(config.CarpetaSalida); len(entradas) != 0 {
+		t.Errorf("no debería escribir archivos, hay %d", len(entradas))
+	}
+	if err := gen.RenderizarSoloMemoria(1000); !errors.Is(err, ErrNumerosAgotados) {
+		t.Errorf("se esperaba ErrNumerosAgotados al pedir más talonarios que números, obtuve %v", err)
+	}
+}
+
+func TestDistribuirUltimoDigito(t *testing.T) {
+	for _, estrategia := range []string{"rechazo", "permutacion"} {
+		t.Run(estrategia, func(t *testing.T) {
+			config := configPrueba(t)
+			config.NumeroMaximo = 9999
+			config.CantidadPaginas = 20
+			config.EstrategiaNumeros = estrategia
+			config.DistribuirUltimoDigito = true
+			gen := nuevoGeneradorPrueba(t, config)
+
+			var talonarios []Talonario
+			for id := 1; id <= config.CantidadPaginas; id++ {
+				talonario, err := gen.crearTalonario(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ultimos [10]int
+				for _, boleta := range talonario.Boletas {
+					ultimos[boleta.Numero%10]++
+				}
+				if m := slices.Max(ultimos[:]); m > 2 {
+					t.Errorf("talonario %d: un último dígito sale %d veces: %v", id, m, ultimos)
+				}
+				talonarios = append(talonarios, talonario)
+			}
+			if duplicados := VerificarCopias(talonarios, 1); len(duplicados) > 0 {
+				t.Errorf("números duplicados: %v", duplicados)
+			}
+			if got, want := gen.numerosUsados.cantidad, config.CantidadPaginas*config.BoletasPorPagina; got != want {
+				t.Errorf("usados = %d, se esperaba %d: los descartados deben volver al sorteo", got, want)
+			}
+		})
+	}
+}
+
+func TestLineasColumna(t *testing.T) {
+	config := configPrueba(t)
+	config.MargenSuperior = 50
+	config.MargenInferior = 50
+	config.ColorLinea = color.RGBA{0, 200, 0, 255}
+	config.LineasColumna = true
+	talonario := Talonario{ID: 1}
+	verde := func(img *image.RGBA, x, y int) bool { return img.RGBAAt(x, y) == config.ColorLinea }
+
+	// Dos columnas de 200: el borde entre ambas está en x = 200
+	img := nuevoGeneradorPrueba(t, config).crearImagenTalonario(talonario)
+	if !verde(img, 200, 50) || !verde(img, 200, 549) || !verde(img, 200, 300) {
+		t.Error("la línea de columna debería cubrir de MargenSuperior a AltoTalonario - MargenInferior")
+	}
+	if verde(img, 200, 20) || verde(img, 200, 580) {
+		t.Error("la línea de columna no debería entrar en los márgenes")
+	}
+
+	config.EstiloLineasColumna = "discontinua"
+	img = nuevoGeneradorPrueba(t, config).crearImagenTalonario(talonario)
+	if !verde(img, 200, 55) || verde(img, 200, 50+largoGuion+1) {
+		t.Error("la línea discontinua debería alternar trazos y huecos")
+	}
+
+	config.EstiloLineasColumna = "punteada"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un estilo de línea inválido")
+	}
+}
+
+func TestSombraTexto(t *testing.T) {
+	rojo := color.RGBA{255, 0, 0, 255}
+	azul := color.RGBA{0, 0, 255, 255}
+	verde := color.RGBA{0, 255, 0, 255}
+	dibujar := func(config Config) *image.RGBA {
+		gen := nuevoGeneradorPrueba(t, config)
+		img := image.NewRGBA(image.Rect(0, 0, 80, 60))
+		draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+		gen.dibujarTexto(img, gen.config.Fuente, "88", 20, 40, rojo)
+		return img
+	}
+	cuenta := func(img *image.RGBA, col color.RGBA) (n int) {
+		for i := 0; i < len(img.Pix); i += 4 {
+			if img.Pix[i] == col.R && img.Pix[i+1] == col.G && img.Pix[i+2] == col.B {
+				n++
+			}
+		}
+		return n
+	}
+
+	config := configPrueba(t)
+	config.RutaFuente = "calibri-bold.ttf"
+	config.TamanoFuente = 30
+	sinSombra := dibujar(config)
+	if cuenta(sinSombra, azul) != 0 {
+		t.Fatal("sin SombraTexto no debería haber sombra")
+	}
+
+	config.SombraTexto = true
+	config.ColorSombra = azul
+	config.DesplazamientoSombraX = 4
+	conSombra := dibujar(config)
+	if cuenta(conSombra, azul) == 0 {
+		t.Error("no se dibujó la sombra")
+	}
+	if cuenta(conSombra, rojo) != cuenta(sinSombra, rojo) {
+		t.Error("la sombra no debería mover ni tapar el relleno")
+	}
+
+	config.GrosorContorno = 3
+	config.ContornoTexto = verde
+	img := dibujar(config)
+	if cuenta(img, azul) == 0 || cuenta(img, verde) == 0 || cuenta(img, rojo) == 0 {
+		t.Errorf("con contorno se esperaban sombra, contorno y relleno: %d, %d, %d", cuenta(img, azul), cuenta(img, verde), cuenta(img, rojo))
+	}
+}
+
+func TestBaseNumerica(t *testing.T) {
+	config := configPrueba(t)
+	config.NumeroMaximo = 1295
+	config.BaseNumerica = 36
+	gen := nuevoGeneradorPrueba(t, config)
+	for numero, want := range map[int]string{1295: "ZZ", 35: "0Z", 0: "00", 36: "10"} {
+		if got := gen.formatearNumero(numero); got != want {
+			t.Errorf("formatearNumero(%d) = %q, se esperaba %q", numero, got, want)
+		}
+	}
+
+	config.NumeroMaximo = 255
+	config.BaseNumerica = 16
+	config.ExcluirRepetidos = true
+	gen = nuevoGeneradorPrueba(t, config)
+	if got := gen.formatearNumero(10); got != "0A" {
+		t.Errorf("formatearNumero(10) en base 16 = %q, se esperaba \"0A\"", got)
+	}
+	if !gen.numeroExcluido(0xBB) || gen.numeroExcluido(0xBC) {
+		t.Error("los filtros de dígitos deberían aplicarse sobre la base configurada")
+	}
+	if n := gen.contarDisponibles(math.MaxInt); n != 256-16 {
+		t.Errorf("disponibles = %d, se esperaba %d", n, 256-16)
+	}
+
+	for _, base := range []int{1, 37} {
+		config.BaseNumerica = base
+		if _, err := NewGeneradorTalonarios(config); err == nil {
+			t.Errorf("se esperaba un error con BaseNumerica %d", base)
+		}
+	}
+	config.BaseNumerica = 16
+	config.DigitoControl = true
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con DigitoControl fuera de base 10")
+	}
+	config.DigitoControl = false
+
+	// Los dígitos de NumeroMaximo se cuentan en la base configurada
+	config.ExcluirRepetidos = false
+	config.NumeroMaximo = 1295
+	config.BaseNumerica = 36
+	config.DigitosFormato = 2
+	if _, err := NewGeneradorTalonarios(config); err != nil {
+		t.Errorf("\"ZZ\" cabe en DigitosFormato 2: %v", err)
+	}
+	config.NumeroMaximo = 64
+	config.BaseNumerica = 2
+	config.DigitosFormato = 3
+	config.CantidadPaginas = 1
+	if _, err := NewGeneradorTalonarios(config); err == nil || !strings.Contains(err.Error(), "7 dígitos") {
+		t.Errorf("se esperaba un error porque 64 en base 2 tiene 7 dígitos: %v", err)
+	}
+}
+
+func TestRevisarImagenBase(t *testing.T) {
+	escribir := func(ancho, alto int) string {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, ancho, alto))); err != nil {
+			t.Fatal(err)
+		}
+		ruta := filepath.Join(t.TempDir(), "base.png")
+		if err := os.WriteFile(ruta, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return ruta
+	}
+
+	casos := []struct {
+		ancho, alto int
+		aviso       string
+	}{
+		{400, 580, ""},
+		{800, 1200, ""},
+		{200, 200, "mucho menor"},
+		{400, 400, "otra proporción"},
+	}
+	for _, c := range casos {
+		var registro bytes.Buffer
+		config := configPrueba(t)
+		config.Logger = slog.New(slog.NewTextHandler(&registro, nil))
+		config.ImagenBase = escribir(c.ancho, c.alto)
+		nuevoGeneradorPrueba(t, config)
+		if c.aviso == "" {
+			if strings.Contains(registro.String(), "imagen base") {
+				t.Errorf("%dx%d: aviso inesperado: %s", c.ancho, c.alto, registro.String())
+			}
+			continue
+		}
+		if !strings.Contains(registro.String(), c.aviso) || !strings.Contains(registro.String(), fmt.Sprintf("imagen=%dx%d", c.ancho, c.alto)) {
+			t.Errorf("%dx%d: se esperaba un aviso %q, registro: %s", c.ancho, c.alto, c.aviso, registro.String())
+		}
+
+		config.ImagenEstricta = true
+		_, err := NewGeneradorTalonarios(config)
+		if err == nil || !strings.Contains(err.Error(), "400x600") {
+			t.Errorf("%dx%d: con ImagenEstricta se esperaba un error con las medidas, obtuve %v", c.ancho, c.alto, err)
+		}
+	}
+}
+
+func TestEstadisticasGeneracion(t *testing.T) {
+	config := configPrueba(t)
+	config.ComenzarDesde = 2
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	e := gen.Estadisticas()
+	if e.Talonarios != config.CantidadPaginas-1 {
+		t.Errorf("Talonarios = %d, se esperaban %d", e.Talonarios, config.CantidadPaginas-1)
+	}
+	if e.MasLento < 2 || e.MasLento > config.CantidadPaginas || e.Mediana <= 0 || e.Promedio <= 0 {
+		t.Errorf("estadísticas inconsistentes: %+v", e)
+	}
+	if e.Total < e.Dibujo+e.Guardado || e.DuracionMasLento < e.Mediana {
+		t.Errorf("los tiempos parciales superan al total o al más lento: %+v", e)
+	}
+}
+
+func TestSalidaTIFF(t *testing.T) {
+	for _, compresion := range []string{"", "deflate"} {
+		config := configPrueba(t)
+		config.CantidadPaginas = 1
+		config.FormatoSalida = "tiff"
+		config.CompresionTIFF = compresion
+		if err := nuevoGeneradorPrueba(t, config).GenerarTodos(); err != nil {
+			t.Fatalf("GenerarTodos: %v", err)
+		}
+
+		archivo, err := os.Open(filepath.Join(config.CarpetaSalida, "talonario_001.tiff"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := tiff.Decode(archivo)
+		archivo.Close()
+		if err != nil {
+			t.Fatalf("compresión %q: TIFF inválido: %v", compresion, err)
+		}
+		if img.Bounds().Dx() != config.AnchoTalonario || img.Bounds().Dy() != config.AltoTalonario {
+			t.Errorf("compresión %q: dimensiones %v", compresion, img.Bounds())
+		}
+	}
+
+	config := configPrueba(t)
+	config.FormatoSalida = "tiff"
+	config.CompresionTIFF = "lzw"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con compresión LZW")
+	}
+
+	config = configPrueba(t)
+	config.EspacioColor = "cmyk"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con CMYK y salida PNG")
+	}
+	config.FormatoSalida = "tiff"
+	config.CantidadPaginas = 1
+	if err := nuevoGeneradorPrueba(t, config).GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos con CMYK: %v", err)
+	}
+	datos, err := os.ReadFile(filepath.Join(config.CarpetaSalida, "talonario_001.tiff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := config.AnchoTalonario * config.AltoTalonario * 4; len(datos) < want {
+		t.Errorf("TIFF CMYK de %d bytes, se esperaban al menos %d", len(datos), want)
+	}
+}
+
+func TestGenerarPreviewCoincideConLaCorrida(t *testing.T) {
+	config := configPrueba(t)
+	gen := nuevoGeneradorPrueba(t, config)
+
+	preview, err := gen.GenerarPreview()
+	if err != nil {
+		t.Fatalf("GenerarPreview: %v", err)
+	}
+	if gen.numerosUsados.cantidad != 0 {
+		t.Fatalf("GenerarPreview consumió %d números del generador", gen.numerosUsados.cantidad)
+	}
+
+	gen.config.SoloPrimera = true
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	archivos, _ := filepath.Glob(filepath.Join(config.CarpetaSalida, "talonario_*.png"))
+	if len(archivos) != 1 {
+		t.Fatalf("con SoloPrimera se escribieron %d archivos", len(archivos))
+	}
+
+	archivo, err := os.Open(archivos[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archivo.Close()
+	escrito, err := png.Decode(archivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rgba := image.NewRGBA(escrito.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), escrito, image.Point{}, draw.Src)
+	if !bytes.Equal(rgba.Pix, preview.Pix) {
+		t.Error("la vista previa no coincide con el talonario 1 generado")
+	}
+}
+
+func TestFiltrosDeDigitos(t *testing.T) {
+	repetidos := map[string]bool{"1111": true, "00": true, "7": false, "1112": false}
+	for digitos, want := range repetidos {
+		if got := DigitosRepetidos(digitos); got != want {
+			t.Errorf("DigitosRepetidos(%q) = %v", digitos, got)
+		}
+	}
+
+	secuenciales := map[string]bool{"1234": true, "0123": true, "4321": true, "12": false, "1235": false, "1357": false}
+	for digitos, want := range secuenciales {
+		if got := DigitosSecuenciales(digitos); got != want {
+			t.Errorf("DigitosSecuenciales(%q) = %v", digitos, got)
+		}
+	}
+}
+
+func TestExcluirRepetidosYSecuenciales(t *testing.T) {
+	config := configPrueba(t)
+	config.NumeroMaximo = 999
+	config.ExcluirRepetidos = true
+	config.ExcluirSecuenciales = true
+	// 10 repetidos (000-999) y 16 secuenciales (012-789 y 210-987)
+	config.BoletasPorPagina = 1000 - 26
+	config.CantidadPaginas = 1
+	gen := nuevoGeneradorPrueba(t, config)
+
+	talonario, err := gen.crearTalonario(1)
+	if err != nil {
+		t.Fatalf("crearTalonario: %v", err)
+	}
+	for _, boleta := range talonario.Boletas {
+		if DigitosRepetidos(boleta.Formateado) || DigitosSecuenciales(boleta.Formateado) {
+			t.Errorf("se asignó el número excluido %s", boleta.Formateado)
+		}
+	}
+	if _, err := gen.generarNumeroAleatorio(); !errors.Is(err, ErrNumerosAgotados) {
+		t.Errorf("se esperaba ErrNumerosAgotados, se obtuvo %v", err)
+	}
+
+	config.BoletasPorPagina++
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("validarConfig debería descontar los números excluidos")
+	}
+
+	// Con pocas boletas se cuenta solo una parte del rango, pero el sorteo
+	// sigue llegando a todos los números
+	config.BoletasPorPagina = 1
+	gen = nuevoGeneradorPrueba(t, config)
+	if !gen.disponiblesCota {
+		t.Fatalf("se contaron los %d disponibles, se esperaba una cota", gen.disponibles)
+	}
+	for i := range 1000 - 26 {
+		if _, err := gen.generarNumeroAleatorio(); err != nil {
+			t.Fatalf("sorteo %d: %v", i+1, err)
+		}
+	}
+	if _, err := gen.generarNumeroAleatorio(); !errors.Is(err, ErrNumerosAgotados) {
+		t.Errorf("se esperaba ErrNumerosAgotados, se obtuvo %v", err)
+	}
+
+	// Un rango de miles de millones no se recorre entero
+	config.NumeroMaximo = 2_000_000_000
+	inicio := time.Now()
+	if _, err := NewGeneradorTalonarios(config); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(inicio); d > 5*time.Second {
+		t.Errorf("NewGeneradorTalonarios tardó %v con un rango de 2e9", d)
+	}
+}
+
+func TestFormatearPrecio(t *testing.T) {
+	casos := []struct {
+		separador string
+		precio    float64
+		want      string
+	}{
+		{"", 5000, "$5.000"},
+		{"", 1250000, "$1.250.000"},
+		{"", 5000.5, "$5.000,50"},
+		{",", 5000.25, "$5,000.25"},
+		{"", 800, "$800"},
+	}
+
+	for _, c := range casos {
+		config := configPrueba(t)
+		config.Moneda = "$"
+		config.SeparadorMiles = c.separador
+		gen := nuevoGeneradorPrueba(t, config)
+
+		if got := gen.formatearPrecio(c.precio); got != c.want {
+			t.Errorf("formatearPrecio(%v) con separador %q = %q, se esperaba %q", c.precio, c.separador, got, c.want)
+		}
+	}
+}
+
+func TestFormatearPrecioConLocale(t *testing.T) {
+	casos := []struct {
+		locale string
+		moneda string
+		precio float64
+		want   string
+	}{
+		{"en-US", "", 5000, "$5,000.00"},
+		{"es-ES", "", 5000, "5.000,00 €"},
+		{"es-CO", "", 5000, "$5.000"},
+		{"es-CO", "COP ", 1250000, "COP 1.250.000"},
+		{"xx-YY", "$", 5000, "$5.000"}, // desconocido: formato propio
+	}
+
+	for _, c := range casos {
+		config := configPrueba(t)
+		config.Locale = c.locale
+		config.Moneda = c.moneda
+		gen := nuevoGeneradorPrueba(t, config)
+
+		if got := gen.formatearPrecio(c.precio); got != c.want {
+			t.Errorf("formatearPrecio(%v) con locale %q = %q, se esperaba %q", c.precio, c.locale, got, c.want)
+		}
+	}
+}
+
+func TestCodigoBarras(t *testing.T) {
+	config := configPrueba(t)
+	config.CantidadPaginas = 1
+	config.GenerarCodigoBarras = true
+	gen := nuevoGeneradorPrueba(t, config)
+
+	img, err := gen.GenerarPreview()
+	if err != nil {
+		t.Fatalf("GenerarPreview: %v", err)
+	}
+	anchoBoleta, altoBoleta, _ := gen.dimensionesBoleta()
+	franja := gen.franjaCodigoBarras(0, 0, anchoBoleta, altoBoleta)
+	blancos := 0
+	for x := franja.Min.X; x < franja.Max.X; x++ {
+		if img.RGBAAt(x, franja.Min.Y+franja.Dy()/2) == (color.RGBA{255, 255, 255, 255}) {
+			blancos++
+		}
+	}
+	if blancos == 0 || blancos == franja.Dx() {
+		t.Errorf("la franja del código de barras no tiene barras: %d de %d píxeles blancos", blancos, franja.Dx())
+	}
+
+	config.AnchoTalonario = 60
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con boletas demasiado angostas para el código")
+	}
+}
+
+func TestPosicionCodigoBarras(t *testing.T) {
+	casos := []struct {
+		posicion string
+		x, y     int
+		fraccion float64
+		want     image.Rectangle
+	}{
+		{"", 0, 0, 0, image.Rect(4, 86, 196, 116)},
+		{"arriba", 0, 0, 0, image.Rect(4, 4, 196, 34)},
+		{"sup-der", 0, 0, 0, image.Rect(96, 4, 196, 34)},
+		{"inf-izq", 0, 0, 0, image.Rect(4, 86, 104, 116)},
+		{"xy", 10, 20, 0.6, image.Rect(10, 20, 130, 50)},
+	}
+	for _, c := range casos {
+		config := configPrueba(t)
+		config.GenerarCodigoBarras = true
+		config.PosicionCodigoBarras = c.posicion
+		config.XCodigoBarras, config.YCodigoBarras = c.x, c.y
+		config.FraccionAnchoCodigo = c.fraccion
+		gen := nuevoGeneradorPrueba(t, config)
+		if got := gen.franjaCodigoBarras(0, 0, 200, 120); got != c.want {
+			t.Errorf("%q: franja = %v, se esperaba %v", c.posicion, got, c.want)
+		}
+	}
+
+	config := configPrueba(t)
+	config.GenerarCodigoBarras = true
+	config.PosicionCodigoBarras = "xy"
+	config.XCodigoBarras = 150
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un código que se sale de la boleta")
+	}
+	config.PosicionCodigoBarras = "centro"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con una posición inválida")
+	}
+}
+
+func BenchmarkRenderizarSoloMemoria(b *testing.B) {
+	config := Config{
+		NumeroMaximo:     9999,
+		BoletasPorPagina: 10,
+		CantidadPaginas:  10,
+		BoletasPorFila:   2,
+		AnchoTalonario:   1080,
+		AltoTalonario:    1920,
+		AnchoLineas:      5,
+		ColorTexto:       color.RGBA{255, 255, 255, 255},
+		ColorBorde:       color.RGBA{255, 255, 255, 255},
+		RutaFuente:       "calibri-bold.ttf",
+		TamanoFuente:     38,
+		Semilla:          42,
+		Logger:           slog.New(slog.DiscardHandler),
+	}
+	gen, err := NewGeneradorTalonarios(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := gen.RenderizarSoloMemoria(config.CantidadPaginas); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
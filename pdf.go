@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// escritorPDF arma un PDF con una imagen por página, a razón de un punto por
+// píxel. Las páginas se escriben a medida que se agregan, así que solo una
+// imagen a la vez queda en memoria.
+type escritorPDF struct {
+	w       *contadorEscritura
+	offsets []int64 // posición de cada objeto; el índice 0 no se usa
+	paginas []int   // números de objeto de las páginas
+}
+
+// contadorEscritura lleva la cuenta de los bytes escritos para la tabla xref.
+type contadorEscritura struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *contadorEscritura) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// Los objetos 1 (catálogo) y 2 (árbol de páginas) se escriben al cerrar.
+func nuevoEscritorPDF(w io.Writer) *escritorPDF {
+	e := &escritorPDF{w: &contadorEscritura{w: w}, offsets: make([]int64, 3)}
+	fmt.Fprint(e.w, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	return e
+}
+
+func (e *escritorPDF) iniciarObjeto(numero int) {
+	for len(e.offsets) <= numero {
+		e.offsets = append(e.offsets, 0)
+	}
+	e.offsets[numero] = e.w.n
+	fmt.Fprintf(e.w, "%d 0 obj\n", numero)
+}
+
+func (e *escritorPDF) escribirFlujo(numero int, diccionario string, datos []byte) {
+	e.iniciarObjeto(numero)
+	fmt.Fprintf(e.w, "<< %s /Length %d >>\nstream\n", diccionario, len(datos))
+	e.w.Write(datos)
+	fmt.Fprint(e.w, "\nendstream\nendobj\n")
+}
+
+// agregarPagina escribe img como una página de su mismo tamaño. La
+// transparencia se descarta componiendo sobre blanco.
+func (e *escritorPDF) agregarPagina(img image.Image) error {
+	limites := img.Bounds()
+	ancho, alto := limites.Dx(), limites.Dy()
+
+	var comprimido bytes.Buffer
+	zw := zlib.NewWriter(&comprimido)
+	fila := make([]byte, ancho*3)
+	for y := limites.Min.Y; y < limites.Max.Y; y++ {
+		for x := limites.Min.X; x < limites.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			blanco := 0xffff - a
+			i := (x - limites.Min.X) * 3
+			fila[i] = uint8((r + blanco) >> 8)
+			fila[i+1] = uint8((g + blanco) >> 8)
+			fila[i+2] = uint8((b + blanco) >> 8)
+		}
+		zw.Write(fila)
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	pagina := len(e.offsets)
+	contenido, imagen := pagina+1, pagina+2
+
+	e.iniciarObjeto(pagina)
+	fmt.Fprintf(e.w, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+		ancho, alto, imagen, contenido)
+	e.escribirFlujo(contenido, "", fmt.Appendf(nil, "q %d 0 0 %d 0 0 cm /Im0 Do Q", ancho, alto))
+	e.escribirFlujo(imagen, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode",
+		ancho, alto), comprimido.Bytes())
+
+	e.paginas = append(e.paginas, pagina)
+	return e.w.err
+}
+
+// cerrar escribe el árbol de páginas, el catálogo y la tabla xref.
+func (e *escritorPDF) cerrar() error {
+	if len(e.paginas) == 0 {
+		return errors.New("el PDF no tiene páginas")
+	}
+
+	hijos := make([]string, len(e.paginas))
+	for i, p := range e.paginas {
+		hijos[i] = strconv.Itoa(p) + " 0 R"
+	}
+	e.iniciarObjeto(2)
+	fmt.Fprintf(e.w, "<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(hijos, " "), len(e.paginas))
+	e.iniciarObjeto(1)
+	fmt.Fprint(e.w, "<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	inicioXref := e.w.n
+	fmt.Fprintf(e.w, "xref\n0 %d\n0000000000 65535 f \n", len(e.offsets))
+	for _, off := range e.offsets[1:] {
+		fmt.Fprintf(e.w, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(e.w, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(e.offsets), inicioXref)
+	return e.w.err
+}
+
+// CombinarPNGaPDF reúne en el PDF salida, una página por imagen y a su tamaño
+// original, los PNG de carpeta en orden natural (talonario_999 antes que
+// talonario_1000). Los archivos que no son PNG se omiten con un aviso.
+func CombinarPNGaPDF(carpeta, salida string) error {
+	logger := loggerOPorDefecto(nil)
+
+	entradas, err := os.ReadDir(carpeta)
+	if err != nil {
+		return fmt.Errorf("error leyendo carpeta %s: %v", carpeta, err)
+	}
+
+	var nombres []string
+	for _, entrada := range entradas {
+		if entrada.IsDir() || !strings.EqualFold(filepath.Ext(entrada.Name()), ".png") {
+			logger.Warn("se omite un archivo que no es PNG", "archivo", entrada.Name())
+			continue
+		}
+		nombres = append(nombres, entrada.Name())
+	}
+	if len(nombres) == 0 {
+		return fmt.Errorf("no hay imágenes PNG en %s", carpeta)
+	}
+	slices.SortFunc(nombres, compararNatural)
+
+	archivo, err := os.Create(salida)
+	if err != nil {
+		return fmt.Errorf("error creando %s: %v", salida, err)
+	}
+	defer archivo.Close()
+
+	pdf := nuevoEscritorPDF(archivo)
+	for _, nombre := range nombres {
+		img, err := leerPNG(filepath.Join(carpeta, nombre))
+		if err != nil {
+			return fmt.Errorf("error leyendo %s: %v", nombre, err)
+		}
+		if err := pdf.agregarPagina(img); err != nil {
+			return fmt.Errorf("error escribiendo %s en el PDF: %v", nombre, err)
+		}
+	}
+	if err := pdf.cerrar(); err != nil {
+		return fmt.Errorf("error escribiendo %s: %v", salida, err)
+	}
+
+	logger.Info("PNG combinados en PDF", "archivo", salida, "paginas", len(nombres))
+	return archivo.Close()
+}
+
+func leerPNG(ruta string) (image.Image, error) {
+	f, err := os.Open(ruta)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// compararNatural ordena cadenas comparando por valor los tramos de dígitos.
+func compararNatural(a, b string) int {
+	for a != "" && b != "" {
+		na, restoA := cortarTramo(a)
+		nb, restoB := cortarTramo(b)
+		if na != nb {
+			da, errA := strconv.Atoi(na)
+			db, errB := strconv.Atoi(nb)
+			if errA == nil && errB == nil && da != db {
+				return da - db
+			}
+			return strings.Compare(na, nb)
+		}
+		a, b = restoA, restoB
+	}
+	return len(a) - len(b)
+}
+
+// cortarTramo separa el primer tramo de solo dígitos o solo no dígitos.
+func cortarTramo(s string) (tramo, resto string) {
+	digito := s[0] >= '0' && s[0] <= '9'
+	i := 1
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9') == digito {
+		i++
+	}
+	return s[:i], s[i:]
+}
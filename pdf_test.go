@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCombinarPNGaPDF(t *testing.T) {
+	carpeta := t.TempDir()
+	for _, nombre := range []string{"talonario_1000.png", "talonario_999.png"} {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 30, 20))); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(carpeta, nombre), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(carpeta, "notas.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	salida := filepath.Join(t.TempDir(), "talonarios.pdf")
+	if err := CombinarPNGaPDF(carpeta, salida); err != nil {
+		t.Fatalf("CombinarPNGaPDF: %v", err)
+	}
+	datos, err := os.ReadFile(salida)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(datos, []byte("%PDF-1.4")) || !bytes.HasSuffix(datos, []byte("%%EOF\n")) {
+		t.Error("el archivo no tiene la cabecera y el final de un PDF")
+	}
+	if !bytes.Contains(datos, []byte("/Count 2")) || !bytes.Contains(datos, []byte("/MediaBox [0 0 30 20]")) {
+		t.Error("se esperaban 2 páginas de 30x20 puntos")
+	}
+
+	if err := CombinarPNGaPDF(t.TempDir(), salida); err == nil {
+		t.Error("se esperaba un error con una carpeta sin PNG")
+	}
+}
+
+func TestCompararNatural(t *testing.T) {
+	nombres := []string{"talonario_1000.png", "talonario_999.png", "hoja_2.png", "talonario_010.png"}
+	slices.SortFunc(nombres, compararNatural)
+	want := []string{"hoja_2.png", "talonario_010.png", "talonario_999.png", "talonario_1000.png"}
+	if !slices.Equal(nombres, want) {
+		t.Errorf("orden = %v, se esperaba %v", nombres, want)
+	}
+}
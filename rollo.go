@@ -0,0 +1,261 @@
+package main
+
+import (
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"path/filepath"
+)
+
+// tamanoIDAT es el máximo de datos comprimidos por fragmento IDAT del rollo.
+const tamanoIDAT = 1 << 16
+
+// escritorRollo escribe un PNG RGBA de 8 bits fila por fila, sin tener la
+// imagen completa en memoria: image/png necesita la imagen entera y un rollo
+// con miles de boletas no cabría. Las filas se comprimen con zlib a medida que
+// llegan y se emiten en fragmentos IDAT de hasta tamanoIDAT bytes.
+type escritorRollo struct {
+	w     io.Writer
+	zw    *zlib.Writer
+	ancho int
+	alto  int
+	filas int // filas ya escritas
+	fila  []byte
+	idat  []byte
+	err   error
+}
+
+// nuevoEscritorRollo escribe la firma, IHDR y, si clave no está vacía, un
+// fragmento tEXt. El alto total debe conocerse de antemano porque va en IHDR.
+func nuevoEscritorRollo(w io.Writer, ancho, alto int, nivel png.CompressionLevel, clave, valor string) (*escritorRollo, error) {
+	e := &escritorRollo{w: w, ancho: ancho, alto: alto, fila: make([]byte, 1+ancho*4)}
+
+	if _, err := io.WriteString(w, "\x89PNG\r\n\x1a\n"); err != nil {
+		return nil, err
+	}
+	ihdr := binary.BigEndian.AppendUint32(nil, uint32(ancho))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(alto))
+	// 8 bits, color RGBA, compresión y filtro 0, sin entrelazado
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	e.fragmento("IHDR", ihdr)
+	if clave != "" {
+		e.fragmento("tEXt", append([]byte(clave+"\x00"), valor...))
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	zw, err := zlib.NewWriterLevel(e, nivelZlib(nivel))
+	if err != nil {
+		return nil, err
+	}
+	e.zw = zw
+	return e, nil
+}
+
+// nivelZlib traduce NivelCompresion de image/png al nivel de zlib.
+func nivelZlib(nivel png.CompressionLevel) int {
+	switch nivel {
+	case png.NoCompression:
+		return zlib.NoCompression
+	case png.BestSpeed:
+		return zlib.BestSpeed
+	case png.BestCompression:
+		return zlib.BestCompression
+	default:
+		return zlib.DefaultCompression
+	}
+}
+
+func (e *escritorRollo) fragmento(tipo string, datos []byte) {
+	if e.err != nil {
+		return
+	}
+	contenido := append([]byte(tipo), datos...)
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(datos)))
+	b = append(b, contenido...)
+	b = binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(contenido))
+	_, e.err = e.w.Write(b)
+}
+
+// Write recibe la salida de zlib y la junta en fragmentos IDAT.
+func (e *escritorRollo) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		k := min(tamanoIDAT-len(e.idat), len(p))
+		e.idat = append(e.idat, p[:k]...)
+		p = p[k:]
+		if len(e.idat) == tamanoIDAT {
+			e.fragmento("IDAT", e.idat)
+			e.idat = e.idat[:0]
+		}
+	}
+	return n, e.err
+}
+
+// agregar escribe las filas de img debajo de las anteriores. Si img es más
+// angosta que el rollo, el resto de cada fila queda en negro opaco, como el
+// fondo de las boletas.
+func (e *escritorRollo) agregar(img *image.RGBA) error {
+	limites := img.Bounds()
+	if limites.Dx() > e.ancho || e.filas+limites.Dy() > e.alto {
+		return fmt.Errorf("la imagen de %dx%d no cabe en el rollo de %dx%d con %d filas escritas",
+			limites.Dx(), limites.Dy(), e.ancho, e.alto, e.filas)
+	}
+	for y := limites.Min.Y; y < limites.Max.Y; y++ {
+		// Filtro 0; los píxeles pasan de alfa premultiplicado al de PNG
+		e.fila[0] = 0
+		origen := img.Pix[img.PixOffset(limites.Min.X, y):]
+		for i := 0; i < e.ancho*4; i += 4 {
+			if i >= limites.Dx()*4 {
+				copy(e.fila[1+i:], []byte{0, 0, 0, 255})
+				continue
+			}
+			r, g, b, a := origen[i], origen[i+1], origen[i+2], origen[i+3]
+			if a != 255 && a != 0 {
+				r = uint8(uint32(r) * 255 / uint32(a))
+				g = uint8(uint32(g) * 255 / uint32(a))
+				b = uint8(uint32(b) * 255 / uint32(a))
+			}
+			e.fila[1+i], e.fila[2+i], e.fila[3+i], e.fila[4+i] = r, g, b, a
+		}
+		if _, err := e.zw.Write(e.fila); err != nil {
+			return err
+		}
+	}
+	e.filas += limites.Dy()
+	return nil
+}
+
+// cerrar completa el flujo zlib, el último IDAT e IEND. Falla si no se
+// escribieron todas las filas anunciadas en IHDR.
+func (e *escritorRollo) cerrar() error {
+	if e.filas != e.alto {
+		return fmt.Errorf("el rollo tiene %d filas de %d", e.filas, e.alto)
+	}
+	if err := e.zw.Close(); err != nil {
+		return err
+	}
+	if len(e.idat) > 0 {
+		e.fragmento("IDAT", e.idat)
+	}
+	e.fragmento("IEND", nil)
+	return e.err
+}
+
+// celdaRollo devuelve el tamaño de la imagen de la boleta i de cada
+// talonario, ya rotada con RotarSalida.
+func (g *GeneradorTalonarios) celdaRollo(i int) (ancho, alto int) {
+	_, _, _, bordesX, bordesY := g.cuadricula()
+	fila := i / g.config.BoletasPorFila
+	columna := i % g.config.BoletasPorFila
+	ancho = bordesX[columna+1] - bordesX[columna]
+	alto = bordesY[fila+1] - bordesY[fila]
+	if g.config.RotarSalida == 90 || g.config.RotarSalida == 270 {
+		ancho, alto = alto, ancho
+	}
+	return ancho, alto
+}
+
+// dimensionesRollo devuelve el tamaño del rollo con talonarios talonarios:
+// tan ancho como la boleta más ancha y con todas las boletas una debajo de
+// la otra.
+func (g *GeneradorTalonarios) dimensionesRollo(talonarios int) (ancho, alto int) {
+	for i := range g.config.BoletasPorPagina {
+		a, h := g.celdaRollo(i)
+		ancho = max(ancho, a)
+		alto += h
+	}
+	return ancho, alto * talonarios
+}
+
+// talonariosRollo cuenta los talonarios que escribe una corrida con ModoRollo:
+// desde ComenzarDesde hasta el último, o solo el primero con SoloPrimera.
+func (g *GeneradorTalonarios) talonariosRollo() int {
+	ultimo := g.config.CantidadPaginas
+	if g.config.SoloPrimera {
+		ultimo = 1
+	}
+	return ultimo - max(g.config.ComenzarDesde, 1) + 1
+}
+
+// nombreRollo arma la ruta del rollo con ModoRollo, siempre PNG.
+func (g *GeneradorTalonarios) nombreRollo() string {
+	nombre := "rollo"
+	if g.config.IDCorridaEnNombres {
+		nombre += "_" + g.idCorrida
+	}
+	return filepath.Join(g.config.CarpetaSalida, nombre+".png")
+}
+
+// salidaRollo es la salida abierta de ModoRollo.
+type salidaRollo struct {
+	*escritorRollo
+	archivo io.WriteCloser // nil en la salida estándar
+	nombre  string
+}
+
+// abrirRollo crea el archivo del rollo, o usa la salida estándar, y escribe
+// su cabecera para talonarios talonarios.
+func (g *GeneradorTalonarios) abrirRollo(talonarios int) (*salidaRollo, error) {
+	r := &salidaRollo{nombre: g.nombreRollo()}
+	w := escritorEstandar
+	if g.config.CarpetaSalida != salidaEstandar {
+		archivo, err := crearArchivo(r.nombre)
+		if err != nil {
+			return nil, fmt.Errorf("error creando rollo %s: %v", r.nombre, err)
+		}
+		r.archivo, w = archivo, archivo
+	}
+
+	var clave string
+	if g.config.MetadatosPNG {
+		clave = "IDCorrida"
+	}
+	ancho, alto := g.dimensionesRollo(talonarios)
+	escritor, err := nuevoEscritorRollo(w, ancho, alto, g.codificadorPNG.CompressionLevel, clave, g.idCorrida)
+	if err != nil {
+		r.descartar()
+		return nil, fmt.Errorf("error escribiendo rollo %s: %v", r.nombre, err)
+	}
+	r.escritorRollo = escritor
+	g.logger.Info("escribiendo rollo", "archivo", r.nombre, "ancho", ancho, "alto", alto)
+	return r, nil
+}
+
+// agregarTalonario dibuja cada boleta del talonario y la agrega al rollo.
+func (r *salidaRollo) agregarTalonario(g *GeneradorTalonarios, talonario Talonario) error {
+	for i := range talonario.Boletas {
+		if err := r.agregar(g.crearImagenBoleta(talonario, i)); err != nil {
+			return fmt.Errorf("error escribiendo rollo %s: %v", r.nombre, err)
+		}
+	}
+	return nil
+}
+
+// terminar cierra el PNG y el archivo.
+func (r *salidaRollo) terminar() error {
+	if err := r.cerrar(); err != nil {
+		r.descartar()
+		return fmt.Errorf("error escribiendo rollo %s: %v", r.nombre, err)
+	}
+	if r.archivo != nil {
+		archivo := r.archivo
+		r.archivo = nil
+		return archivo.Close()
+	}
+	return nil
+}
+
+// descartar cierra el archivo si sigue abierto, p. ej. al cancelar la
+// corrida; el rollo a medio escribir queda truncado.
+func (r *salidaRollo) descartar() {
+	if r.archivo != nil {
+		r.archivo.Close()
+		r.archivo = nil
+	}
+}
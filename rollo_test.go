@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEscritorRollo(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := nuevoEscritorRollo(&buf, 3, 3, png.DefaultCompression, "IDCorrida", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ancha := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	ancha.SetRGBA(2, 1, color.RGBA{255, 0, 0, 255})
+	ancha.SetRGBA(0, 0, color.RGBA{0, 0, 64, 128}) // premultiplicado
+	angosta := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	angosta.SetRGBA(0, 0, color.RGBA{0, 255, 0, 255})
+	for _, img := range []*image.RGBA{ancha, angosta} {
+		if err := e.agregar(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.agregar(angosta); err == nil {
+		t.Error("se esperaba un error al pasarse del alto del rollo")
+	}
+	if err := e.cerrar(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("tEXtIDCorrida\x00abc")) {
+		t.Error("falta el fragmento tEXt")
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 3, 3) {
+		t.Fatalf("tamaño = %v", img.Bounds())
+	}
+	casos := []struct {
+		x, y int
+		want color.NRGBA
+	}{
+		{2, 1, color.NRGBA{255, 0, 0, 255}},
+		{0, 0, color.NRGBA{0, 0, 127, 128}},
+		{0, 2, color.NRGBA{0, 255, 0, 255}},
+		{2, 2, color.NRGBA{0, 0, 0, 255}}, // relleno de la imagen angosta
+	}
+	for _, c := range casos {
+		if got := color.NRGBAModel.Convert(img.At(c.x, c.y)); got != c.want {
+			t.Errorf("(%d, %d) = %v, se esperaba %v", c.x, c.y, got, c.want)
+		}
+	}
+}
+
+func TestModoRollo(t *testing.T) {
+	config := configPrueba(t)
+	config.ModoRollo = true
+	config.CantidadPaginas = 2
+	gen := nuevoGeneradorPrueba(t, config)
+	if err := gen.GenerarTodos(); err != nil {
+		t.Fatalf("GenerarTodos: %v", err)
+	}
+
+	if talonarios, _ := filepath.Glob(filepath.Join(config.CarpetaSalida, "talonario_*")); len(talonarios) > 0 {
+		t.Errorf("ModoRollo no debería escribir talonarios: %v", talonarios)
+	}
+	f, err := os.Open(filepath.Join(config.CarpetaSalida, "rollo.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+	// 20 boletas de 200x120, una debajo de la otra
+	if img.Bounds() != image.Rect(0, 0, 200, 2400) {
+		t.Fatalf("tamaño = %v, se esperaba 200x2400", img.Bounds())
+	}
+
+	// La boleta 12 es la tercera del segundo talonario
+	boleta := gen.crearImagenBoleta(gen.talonarios[1], 2)
+	for y := range 120 {
+		for x := range 200 {
+			r, g, b, _ := img.At(x, 12*120+y).RGBA()
+			want := boleta.RGBAAt(x, y)
+			if uint8(r>>8) != want.R || uint8(g>>8) != want.G || uint8(b>>8) != want.B {
+				t.Fatalf("(%d, %d) de la boleta 12 no coincide", x, y)
+			}
+		}
+	}
+	if e := gen.EstimarSalida(); e.Archivos != 1 {
+		t.Errorf("EstimarSalida: %d archivos, se esperaba 1", e.Archivos)
+	}
+
+	config.TalonariosPorHoja = 2
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con TalonariosPorHoja")
+	}
+
+	// Apiladas, las boletas de cada talonario suman unos 2·1<<20 píxeles: 3000
+	// talonarios pasan el alto máximo de PNG y 1001 no
+	config.TalonariosPorHoja = 0
+	config.NumeroMaximo = 99999
+	config.AltoTalonario = 1 << 20
+	config.CantidadPaginas = 3000
+	if err := ValidarConfig(config); err == nil || !strings.Contains(err.Error(), "PNG admite") {
+		t.Errorf("se esperaba un error por el alto del rollo, se obtuvo %v", err)
+	}
+	config.ComenzarDesde = 2000
+	if err := ValidarConfig(config); err != nil {
+		t.Errorf("con ComenzarDesde el rollo cabe: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// camposServidor son los campos requeridos en una petición al servidor; la
+// carpeta de salida no aplica porque todo se genera en memoria.
+var camposServidor = []string{
+	"NumeroMaximo",
+	"BoletasPorPagina",
+	"CantidadPaginas",
+	"BoletasPorFila",
+	"AnchoTalonario",
+	"AltoTalonario",
+}
+
+// camposProhibidosServidor leen o escriben archivos del equipo donde corre el
+// servidor, o producen salidas que GenerarStream no entrega, y por eso no se
+// aceptan en una petición. La imagen base y la fuente las fija el operador.
+var camposProhibidosServidor = []string{
+	"ImagenBase",
+	"ImagenEncabezado",
+	"ImagenReverso",
+	"TexturaFondo",
+	"RutaFuente",
+	"RutaFuenteSegunda",
+	"FuenteNumero",
+	"FuenteEtiqueta",
+	"FuenteRespaldo",
+	"CarpetaSalida",
+	"ArchivoJSON",
+	"ArchivoIndice",
+	"Manifiesto",
+	"GenerarReverso",
+	"Tandas",
+	"TalonariosPorHoja",
+	"UnArchivoPorBoleta",
+	"ModoRollo",
+}
+
+// opcionesServidor agrupa los límites y recursos del modo servidor.
+type opcionesServidor struct {
+	MaxBytes      int64         // tamaño máximo del cuerpo de la petición
+	MaxTalonarios int           // CantidadPaginas máxima por petición
+	MaxPixeles    int64         // píxeles máximos de cada talonario, contando Supersampling; 0: sin límite
+	MaxNumeros    int64         // números máximos de NumeroMinimo a NumeroMaximo; 0: sin límite
+	Tiempo        time.Duration // tiempo máximo de generación por petición
+	ImagenBase    string
+	RutaFuente    string
+	Logger        *slog.Logger
+}
+
+// manejadorTalonarios recibe una Config en JSON por POST y responde con un ZIP
+// que contiene una imagen por talonario y numeros.json con los números.
+func manejadorTalonarios(op opcionesServidor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, op.MaxBytes)
+		config, err := leerConfigPeticion(r, op)
+		if err != nil {
+			var demasiado *http.MaxBytesError
+			if errors.As(err, &demasiado) {
+				http.Error(w, fmt.Sprintf("la petición supera %d bytes", op.MaxBytes), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), op.Tiempo)
+		defer cancel()
+
+		zipDatos, err := generarZIP(ctx, config)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				http.Error(w, "la generación superó el tiempo máximo", http.StatusServiceUnavailable)
+				return
+			}
+			op.Logger.Error("error generando talonarios", "error", err)
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="talonarios.zip"`)
+		w.Write(zipDatos)
+	})
+}
+
+// leerConfigPeticion decodifica y valida la Config del cuerpo de r.
+func leerConfigPeticion(r *http.Request, op opcionesServidor) (Config, error) {
+	var valores map[string]any
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&valores); err != nil {
+		var demasiado *http.MaxBytesError
+		if errors.As(err, &demasiado) {
+			return Config{}, err
+		}
+		return Config{}, fmt.Errorf("JSON inválido: %v", err)
+	}
+
+	for _, campo := range camposProhibidosServidor {
+		if _, ok := buscarClave(valores, campo); ok {
+			return Config{}, fmt.Errorf("el campo %q no se admite en el servidor", campo)
+		}
+	}
+
+	config, err := convertirConfig(valores, camposServidor)
+	if err != nil {
+		return Config{}, err
+	}
+	if config.CantidadPaginas > op.MaxTalonarios {
+		return Config{}, fmt.Errorf("se admiten como máximo %d talonarios por petición", op.MaxTalonarios)
+	}
+	// El dibujo de un talonario no se puede interrumpir con el tiempo máximo,
+	// así que el tamaño del lienzo se limita antes de reservarlo
+	if pixeles := pixelesTalonario(config); op.MaxPixeles > 0 && pixeles > float64(op.MaxPixeles) {
+		return Config{}, fmt.Errorf("cada talonario ocuparía %.0f píxeles y se admiten como máximo %d por petición", pixeles, op.MaxPixeles)
+	}
+	// Lo mismo con el rango, antes de ValidarConfig: la validación lo recorre
+	// entero con los filtros de dígitos y la permutación lo reserva entero
+	if op.MaxNumeros > 0 && config.NumeroMaximo >= config.NumeroMinimo {
+		if rango := (&GeneradorTalonarios{config: config}).tamanoRango(); rango > uint64(op.MaxNumeros) {
+			return Config{}, fmt.Errorf("el rango %d-%d tiene %d números y se admiten como máximo %d por petición",
+				config.NumeroMinimo, config.NumeroMaximo, rango, op.MaxNumeros)
+		}
+	}
+	if err := ValidarConfig(config); err != nil {
+		return Config{}, err
+	}
+
+	config.ImagenBase = op.ImagenBase
+	config.RutaFuente = op.RutaFuente
+	config.Logger = op.Logger
+	return config, nil
+}
+
+// pixelesTalonario calcula cuántos píxeles reserva cada talonario de config,
+// con TamanoPagina resuelto, Supersampling y CorreccionAspecto. Se cuenta en
+// float64 para que dimensiones enormes no desborden.
+func pixelesTalonario(config Config) float64 {
+	gen := &GeneradorTalonarios{config: config}
+	if err := gen.resolverTamanoPagina(); err != nil {
+		return 0
+	}
+	pixeles := float64(gen.config.AnchoTalonario) * float64(gen.config.AltoTalonario)
+	if f := float64(config.Supersampling); f > 1 {
+		pixeles *= f * f
+	}
+	if f := config.CorreccionAspecto; f > 1 {
+		pixeles *= f
+	}
+	return pixeles
+}
+
+// generarZIP genera los talonarios de config en memoria y los empaqueta.
+func generarZIP(ctx context.Context, config Config) ([]byte, error) {
+	gen, err := NewGeneradorTalonarios(config)
+	if err != nil {
+		return nil, err
+	}
+
+	resultados, err := gen.GenerarStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	var talonarios []Talonario
+	for res := range resultados {
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		f, err := zw.Create(fmt.Sprintf("talonario_%03d%s", res.Talonario.ID, gen.extensionSalida()))
+		if err != nil {
+			return nil, err
+		}
+		if err := gen.codificarImagen(f, res.Imagen); err != nil {
+			return nil, fmt.Errorf("error codificando talonario %d: %v", res.Talonario.ID, err)
+		}
+		talonarios = append(talonarios, res.Talonario)
+	}
+	// El canal también se cierra al cancelar ctx, sin un resultado de error.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := zw.Create("numeros.json")
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(f).Encode(talonarios); err != nil {
+		return nil, fmt.Errorf("error serializando talonarios: %v", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ejecutarServidor implementa el subcomando "servidor".
+func ejecutarServidor(args []string, logger *slog.Logger) error {
+	fs := flag.NewFlagSet("servidor", flag.ExitOnError)
+	direccion := fs.String("addr", ":8080", "dirección donde escuchar")
+	maxBytes := fs.Int64("max-bytes", 1<<20, "tamaño máximo del cuerpo de la petición en bytes")
+	maxTalonarios := fs.Int("max-talonarios", 100, "talonarios máximos por petición")
+	maxPixeles := fs.Int64("max-pixeles", 50_000_000, "píxeles máximos de cada talonario, contando Supersampling; 0: sin límite")
+	maxNumeros := fs.Int64("max-numeros", 10_000_000, "números máximos en el rango de NumeroMinimo a NumeroMaximo; 0: sin límite")
+	tiempo := fs.Duration("timeout", time.Minute, "tiempo máximo de generación por petición")
+	imagenBase := fs.String("imagen-base", "Base.png", "imagen base para todas las peticiones; vacío: sin imagen")
+	rutaFuente := fs.String("fuente", "calibri-bold.ttf", "fuente TrueType para todas las peticiones")
+	fs.Parse(args)
+
+	op := opcionesServidor{
+		MaxBytes:      *maxBytes,
+		MaxTalonarios: *maxTalonarios,
+		MaxPixeles:    *maxPixeles,
+		MaxNumeros:    *maxNumeros,
+		Tiempo:        *tiempo,
+		ImagenBase:    *imagenBase,
+		RutaFuente:    *rutaFuente,
+		Logger:        logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/talonarios", manejadorTalonarios(op))
+
+	srv := &http.Server{
+		Addr:              *direccion,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      *tiempo + 30*time.Second,
+	}
+
+	logger.Info("servidor escuchando", "direccion", *direccion)
+	return srv.ListenAndServe()
+}
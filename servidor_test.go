@@ -0,0 +1,107 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func opcionesServidorPrueba() opcionesServidor {
+	return opcionesServidor{
+		MaxBytes:      1 << 16,
+		MaxTalonarios: 10,
+		MaxPixeles:    1 << 20,
+		MaxNumeros:    100_000,
+		Tiempo:        time.Minute,
+		RutaFuente:    "calibri-bold.ttf",
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func TestServidorDevuelveZIP(t *testing.T) {
+	cuerpo := `{"NumeroMaximo": 999, "BoletasPorPagina": 4, "CantidadPaginas": 3,
+		"BoletasPorFila": 2, "AnchoTalonario": 200, "AltoTalonario": 300,
+		"ColorTexto": "#FFFFFF", "ColorBorde": "#FFFFFF", "Semilla": 7}`
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/talonarios", strings.NewReader(cuerpo))
+	manejadorTalonarios(opcionesServidorPrueba()).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("estado = %d: %s", rec.Code, rec.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nombres []string
+	var talonarios []Talonario
+	for _, f := range zr.File {
+		nombres = append(nombres, f.Name)
+		if f.Name == "numeros.json" {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.NewDecoder(rc).Decode(&talonarios); err != nil {
+				t.Fatal(err)
+			}
+			rc.Close()
+		}
+	}
+	esperados := "talonario_001.png talonario_002.png talonario_003.png numeros.json"
+	if got := strings.Join(nombres, " "); got != esperados {
+		t.Errorf("archivos = %q, se esperaba %q", got, esperados)
+	}
+	if len(talonarios) != 3 || len(talonarios[0].Boletas) != 4 {
+		t.Errorf("numeros.json inesperado: %+v", talonarios)
+	}
+}
+
+func TestServidorRechazaPeticiones(t *testing.T) {
+	base := `"NumeroMaximo": 999, "BoletasPorPagina": 4, "BoletasPorFila": 2,
+		"AnchoTalonario": 200, "AltoTalonario": 300`
+	casos := []struct {
+		nombre string
+		metodo string
+		cuerpo string
+		estado int
+	}{
+		{"metodo", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"json invalido", http.MethodPost, "{", http.StatusBadRequest},
+		{"campo prohibido", http.MethodPost, `{` + base + `, "CantidadPaginas": 1, "CarpetaSalida": "/tmp/x"}`, http.StatusBadRequest},
+		{"demasiados talonarios", http.MethodPost, `{` + base + `, "CantidadPaginas": 11}`, http.StatusBadRequest},
+		{"rollo", http.MethodPost, `{` + base + `, "CantidadPaginas": 1, "ModoRollo": true}`, http.StatusBadRequest},
+		{"una imagen por boleta", http.MethodPost, `{` + base + `, "CantidadPaginas": 1, "UnArchivoPorBoleta": true}`, http.StatusBadRequest},
+		{"lienzo enorme", http.MethodPost, `{"NumeroMaximo": 999, "BoletasPorPagina": 4, "BoletasPorFila": 2, "CantidadPaginas": 1,
+			"AnchoTalonario": 100000, "AltoTalonario": 100000}`, http.StatusBadRequest},
+		{"pagina a muchos dpi", http.MethodPost, `{"NumeroMaximo": 999, "BoletasPorPagina": 4, "BoletasPorFila": 2, "CantidadPaginas": 1,
+			"TamanoPagina": "A4", "DPI": 1000}`, http.StatusBadRequest},
+		{"supersampling", http.MethodPost, `{"NumeroMaximo": 999, "BoletasPorPagina": 4, "BoletasPorFila": 2, "CantidadPaginas": 1,
+			"AnchoTalonario": 300, "AltoTalonario": 300, "Supersampling": 4}`, http.StatusBadRequest},
+		{"rango para la permutacion", http.MethodPost, `{"NumeroMaximo": 4611686018427387904, "EstrategiaNumeros": "permutacion",
+			"BoletasPorPagina": 4, "BoletasPorFila": 2, "CantidadPaginas": 1, "AnchoTalonario": 200, "AltoTalonario": 300}`, http.StatusBadRequest},
+		{"rango con filtros", http.MethodPost, `{"NumeroMaximo": 2000000000, "ExcluirRepetidos": true, "ExcluirSecuenciales": true,
+			"BoletasPorPagina": 4, "BoletasPorFila": 2, "CantidadPaginas": 1, "AnchoTalonario": 200, "AltoTalonario": 300}`, http.StatusBadRequest},
+		{"rango con negativos", http.MethodPost, `{"NumeroMinimo": -100000, "NumeroMaximo": 100000,
+			"BoletasPorPagina": 4, "BoletasPorFila": 2, "CantidadPaginas": 1, "AnchoTalonario": 200, "AltoTalonario": 300}`, http.StatusBadRequest},
+		{"demasiado grande", http.MethodPost, `{"TextoPie": "` + strings.Repeat("x", 1<<17) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(c.metodo, "/talonarios", strings.NewReader(c.cuerpo))
+			manejadorTalonarios(opcionesServidorPrueba()).ServeHTTP(rec, req)
+			if rec.Code != c.estado {
+				t.Errorf("estado = %d, se esperaba %d: %s", rec.Code, c.estado, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// Tema es un juego de colores y fuentes con nombre, p. ej. el de una marca,
+// que Config.Tema aplica de una vez. Los campos vacíos del tema no cambian
+// nada y los de Config que no estén vacíos tienen prioridad sobre el tema.
+type Tema struct {
+	ColorTexto     color.RGBA
+	ColorBorde     color.RGBA
+	ColorLinea     color.RGBA
+	ColorGuia      color.RGBA
+	FondoTexto     color.RGBA
+	ContornoTexto  color.RGBA
+	ColorSombra    color.RGBA
+	GradienteTexto []color.RGBA
+	RutaFuente     string
+	TamanoFuente   float64
+	FuenteNumero   FuenteConfig
+	FuenteEtiqueta FuenteConfig
+	FuenteRespaldo string
+}
+
+// temas es el registro de RegistrarTema. "clasico" reproduce los colores y la
+// fuente por defecto del programa.
+var temas = struct {
+	sync.RWMutex
+	porNombre map[string]Tema
+}{porNombre: map[string]Tema{
+	"clasico": {
+		ColorTexto:   color.RGBA{248, 220, 191, 255},
+		ColorBorde:   color.RGBA{248, 220, 191, 255},
+		ColorLinea:   color.RGBA{248, 220, 191, 255},
+		RutaFuente:   "calibri-bold.ttf",
+		TamanoFuente: 38,
+	},
+}}
+
+// RegistrarTema agrega tema con nombre al registro, o reemplaza el que ya
+// tenía ese nombre. Es seguro llamarla desde varias goroutines.
+func RegistrarTema(nombre string, tema Tema) error {
+	if nombre == "" {
+		return errors.New("el tema necesita un nombre")
+	}
+	temas.Lock()
+	defer temas.Unlock()
+	temas.porNombre[nombre] = tema
+	return nil
+}
+
+// BuscarTema devuelve el tema registrado con nombre.
+func BuscarTema(nombre string) (Tema, bool) {
+	temas.RLock()
+	defer temas.RUnlock()
+	tema, ok := temas.porNombre[nombre]
+	return tema, ok
+}
+
+// Temas devuelve los nombres de los temas registrados en orden alfabético.
+func Temas() []string {
+	temas.RLock()
+	defer temas.RUnlock()
+	nombres := make([]string, 0, len(temas.porNombre))
+	for nombre := range temas.porNombre {
+		nombres = append(nombres, nombre)
+	}
+	slices.Sort(nombres)
+	return nombres
+}
+
+// CargarTemas registra los temas de un archivo JSON o YAML cuyas claves son
+// los nombres y sus valores los campos de Tema, con los colores en
+// hexadecimal como en CargarConfig.
+func CargarTemas(ruta string) error {
+	valores, err := leerValores(ruta)
+	if err != nil {
+		return err
+	}
+
+	leidos := make(map[string]Tema, len(valores))
+	for nombre, valor := range valores {
+		campos, ok := valor.(map[string]any)
+		if !ok {
+			return fmt.Errorf("error en %s: el tema %q no es un objeto", ruta, nombre)
+		}
+		if err := normalizarColores(campos, reflect.TypeOf(Tema{})); err != nil {
+			return fmt.Errorf("error en %s, tema %q: %v", ruta, nombre, err)
+		}
+		normalizado, err := json.Marshal(campos)
+		if err != nil {
+			return err
+		}
+		var tema Tema
+		dec := json.NewDecoder(bytes.NewReader(normalizado))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&tema); err != nil {
+			return fmt.Errorf("error en %s, tema %q: %v", ruta, nombre, err)
+		}
+		leidos[nombre] = tema
+	}
+
+	// Se registran todos juntos para no dejar el archivo a medias
+	for nombre, tema := range leidos {
+		if err := RegistrarTema(nombre, tema); err != nil {
+			return fmt.Errorf("error en %s: %v", ruta, err)
+		}
+	}
+	return nil
+}
+
+// aplicarTema completa los campos vacíos de config con los de Config.Tema.
+func aplicarTema(config Config) (Config, error) {
+	if config.Tema == "" {
+		return config, nil
+	}
+	tema, ok := BuscarTema(config.Tema)
+	if !ok {
+		return config, fmt.Errorf("tema desconocido: %q (temas registrados: %v)", config.Tema, Temas())
+	}
+
+	completar := func(campo *color.RGBA, valor color.RGBA) {
+		if *campo == (color.RGBA{}) {
+			*campo = valor
+		}
+	}
+	completar(&config.ColorTexto, tema.ColorTexto)
+	completar(&config.ColorBorde, tema.ColorBorde)
+	completar(&config.ColorLinea, tema.ColorLinea)
+	completar(&config.ColorGuia, tema.ColorGuia)
+	completar(&config.FondoTexto, tema.FondoTexto)
+	completar(&config.ContornoTexto, tema.ContornoTexto)
+	completar(&config.ColorSombra, tema.ColorSombra)
+	if len(config.GradienteTexto) == 0 {
+		config.GradienteTexto = slices.Clone(tema.GradienteTexto)
+	}
+	if config.RutaFuente == "" {
+		config.RutaFuente = tema.RutaFuente
+	}
+	if config.TamanoFuente == 0 {
+		config.TamanoFuente = tema.TamanoFuente
+	}
+	if config.FuenteNumero == (FuenteConfig{}) {
+		config.FuenteNumero = tema.FuenteNumero
+	}
+	if config.FuenteEtiqueta == (FuenteConfig{}) {
+		config.FuenteEtiqueta = tema.FuenteEtiqueta
+	}
+	if config.FuenteRespaldo == "" {
+		config.FuenteRespaldo = tema.FuenteRespaldo
+	}
+	return config, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestTema(t *testing.T) {
+	rojo := color.RGBA{255, 0, 0, 255}
+	if err := RegistrarTema("prueba-rojo", Tema{ColorTexto: rojo, ColorBorde: rojo, ColorLinea: rojo, TamanoFuente: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegistrarTema("", Tema{}); err == nil {
+		t.Error("se esperaba un error con un tema sin nombre")
+	}
+	nombres := Temas()
+	if !slices.Contains(nombres, "clasico") || !slices.Contains(nombres, "prueba-rojo") || !slices.IsSorted(nombres) {
+		t.Errorf("Temas() = %v", nombres)
+	}
+
+	// ColorTexto y ColorBorde vienen de configPrueba y tienen prioridad
+	config := configPrueba(t)
+	config.Tema = "prueba-rojo"
+	gen := nuevoGeneradorPrueba(t, config)
+	blanco := color.RGBA{255, 255, 255, 255}
+	if gen.config.ColorTexto != blanco || gen.config.ColorBorde != blanco {
+		t.Errorf("el tema reemplazó colores de la configuración: %v, %v", gen.config.ColorTexto, gen.config.ColorBorde)
+	}
+	if gen.config.ColorLinea != rojo || gen.config.TamanoFuente != 20 {
+		t.Errorf("el tema no completó los campos vacíos: %v, %v", gen.config.ColorLinea, gen.config.TamanoFuente)
+	}
+
+	config.Tema = "inexistente"
+	if _, err := NewGeneradorTalonarios(config); err == nil {
+		t.Error("se esperaba un error con un tema desconocido")
+	}
+	if err := ValidarConfig(config); err == nil {
+		t.Error("ValidarConfig debería rechazar un tema desconocido")
+	}
+	if _, err := NumerosRequeridos(config); err == nil {
+		t.Error("NumerosRequeridos debería rechazar un tema desconocido")
+	}
+}
+
+func TestCargarTemas(t *testing.T) {
+	ruta := escribirArchivo(t, "temas.yaml", `
+prueba-azul:
+  ColorTexto: "#0000FF"
+  GradienteTexto: ["#000000", "#FFFFFF"]
+  FuenteEtiqueta:
+    Ruta: etiqueta.ttf
+    Tamano: 12
+`)
+	if err := CargarTemas(ruta); err != nil {
+		t.Fatalf("CargarTemas: %v", err)
+	}
+	tema, ok := BuscarTema("prueba-azul")
+	if !ok {
+		t.Fatal("no se registró el tema del archivo")
+	}
+	if tema.ColorTexto != (color.RGBA{0, 0, 255, 255}) || len(tema.GradienteTexto) != 2 || tema.FuenteEtiqueta.Tamano != 12 {
+		t.Errorf("tema = %+v", tema)
+	}
+
+	for nombre, contenido := range map[string]string{
+		"campo.json": `{"prueba-mal": {"Colortexto": "#000000", "Sombra": true}}`,
+		"color.yaml": "prueba-mal:\n  ColorBorde: \"#XYZ\"\n",
+		"valor.json": `{"prueba-mal": 3}`,
+	} {
+		if err := CargarTemas(escribirArchivo(t, nombre, contenido)); err == nil {
+			t.Errorf("%s: se esperaba un error", nombre)
+		}
+	}
+	if _, ok := BuscarTema("prueba-mal"); ok {
+		t.Error("un archivo con errores no debería registrar temas")
+	}
+}